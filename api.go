@@ -0,0 +1,1176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// API exposes the configured pins over HTTP, {id} is either the GPIO number
+// or the alias of a pin, either of which may be prefixed by its board such
+// as expander/3 for a pin of a GPIO expander, see BoardConfig
+//
+//	GET  /                                                dashboard
+//	POST /mode?mode=on|off|sync[&duration=30s]            cycle, stop or blink every pin together
+//	GET  /status                                          state of every pin
+//	GET  /pins/{id}                                       state of a single pin, PUT sets its complete desired state
+//	GET  /pins/{id}/info                                  function and header position reported by the GPIO driver
+//	POST /pins/{id}/on[?duration=30s]                     start cycling a single pin
+//	POST /pins/{id}/solid                                 turn a single pin on without blinking
+//	POST /pins/{id}/toggle                                stop a pin which is on, or start cycling it
+//	POST /pins/{id}/pattern?name=heartbeat                blink with random, steady, pulse or heartbeat
+//	POST /pins/{id}/off                                   stop a single pin
+//	POST /pins/{id}/disable                               ignore every command for a pin, turning it off
+//	POST /pins/{id}/enable                                accept commands for a disabled pin again
+//	POST /pins/{id}/release                               hand a pin back to the schedules
+//	POST /pins/{id}/reset                                 clear the failures and last error of a pin and check it can be driven
+//	POST /pins/{id}/brightness?value=0.5                  dim a single pin
+//	POST /pins/{id}/fade?to=0&ms=2000[&curve=perceptual]  fade a single pin
+//	POST /pins/{id}/morse[?unit=150ms]                    flash the request body in Morse code
+//	POST /pins/{id}/blink?times=3[&on=150ms&off=150ms]    flash a pin a number of times then turn it off
+//	POST /pins/{id}/sequence                              loop the steps in the request body, such as on:200,off:200
+//	POST /batch                                           apply a JSON array of pin commands in order
+//	POST /selftest                                        light each pin in turn to check the wiring
+//	POST /reload                                          re-read the config file, as SIGHUP does
+//	GET  /config                                          the config in use, PUT replaces it as a reload does
+//	GET  /audit[?limit=100]                               most recent operations on the pins, newest first
+//	POST /record/start?file=show.jsonl                    record every level change to a file
+//	POST /record/stop                                     stop recording
+//	POST /replay?file=show.jsonl[&speed=2]                replay a recording, stopped by turning the pins off
+//	POST /all/on[?duration=30s]                           start cycling every pin
+//	POST /all/off                                         emergency stop, drive every pin low whatever its state
+//	POST /all/release                                     hand every pin back to the schedules
+//	GET  /groups                                          groups and their members
+//	POST /groups/{name}/on[?duration=30s]                 start cycling every pin in a group
+//	POST /groups/{name}/off                               stop every pin in a group
+//	POST /groups/{name}/twinkle?intensity=0.3             sparkle the pins of a group at random
+//	GET  /schedules                                       schedules and when they next fire
+//	POST /pattern/chase?interval=120ms                    sweep a single lit pin across all pins
+//	POST /pattern/sync?interval=500ms                     blink all pins in lock-step
+//	POST /pattern/traffic/start[?pins=14,15,18&red=5s]    run a traffic light sequence
+//	POST /pattern/traffic/stop                            stop the traffic light
+//	POST /pattern/stop                                    stop the running pattern
+//	GET  /simulator/timeline                              writes made by the simulated pins, DELETE clears them
+//	GET  /stats                                           uptime, request and blink counts
+//	GET  /healthz[?verbose=1]                             ok once the server is ready, 503 during startup and shutdown
+//	GET  /version                                         version, commit and build date of the server and the board it runs on
+//	GET  /metrics                                         Prometheus metrics
+//	GET  /ws                                              WebSocket stream of pin events
+//	GET  /events                                          Server-Sent Events stream of pin events
+//	GET  /openapi.json                                    OpenAPI 3 description of these routes
+//	GET  /docs                                            Swagger UI for /openapi.json
+//
+// The original POST /?mode= and deprecated GET /?mode= forms of /mode are
+// still accepted. Only an explicit mode=off turns the pins off, a GET with
+// an empty mode replies with the state of every pin as /status does.
+//
+// /status, /stats and /pins/{id} and its actions reply with JSON unless the
+// Accept header prefers text/plain or is only */*, as curl sends, when they
+// reply with a line of text per pin.
+//
+// The on, solid, toggle, off, pattern and brightness actions of a pin are
+// queued and applied in order by the pin, they reply 202 with the position
+// of the command in the queue, such as {"id":"23","action":"on",
+// "position":1}, as the pin has not been driven yet, or 429 when too many
+// are waiting. The new state is reported by /pins/{id} and the events once
+// the command applies.
+//
+// PUT /pins/{id} takes a JSON body such as {"state":"solid",
+// "brightness":0.5} and only drives the pin where it differs, so repeating
+// it changes nothing, replying with the resulting state. Brightness only dims
+// a solid pin, a cycling pin is driven at full brightness. See DesiredState.
+//
+// PUT /config takes a complete config, it is validated as for a reload and
+// rejected without changing anything if invalid. Once applied it is saved
+// to the -config file, when one is in use.
+//
+// /simulator/timeline is only served when running with -simulate, it keeps
+// the most recent 10000 writes oldest first.
+//
+// The traffic light uses pins as its red, amber and green lights, defaulting to
+// the first three pins, and takes the duration of each phase from red,
+// redamber, green and amber.
+//
+// Groups may overlap, the last command sent to a pin wins so turning a group
+// off stops every member even if another group it belongs to was turned on.
+// A twinkle runs as a pattern, replacing any running pattern, and takes the
+// typical time each pin is lit from interval.
+//
+// A manual command holds a pin against the schedules until it is released,
+// the pin then does whatever the schedules last asked of it, or turns off if
+// they have not. A timed on releases the pin when it ends.
+//
+// A disabled pin is left off and replies to its actions with its state
+// without applying them, patterns across several pins leave it out.
+type API struct {
+	manager *Manager
+	events  *Bus
+	mux     *http.ServeMux
+	handler http.Handler
+
+	// configMu guards config, groups and schedules which are replaced by
+	// Reload
+	configMu  sync.RWMutex
+	config    *Config
+	groups    map[string][]int
+	schedules *Scheduler
+
+	// reloadMu serialises reloads of configFile, setupPin is applied to the
+	// pins a reload adds or changes. Once closed is set for shutdown reloads
+	// fail.
+	reloadMu   sync.Mutex
+	configFile string
+	setupPin   func(n int, p *PinCycle)
+	closed     bool
+
+	// streams is closed by CloseStreams to end the /events streams on
+	// shutdown, Shutdown of the server would otherwise wait for them
+	streams     chan struct{}
+	streamsOnce sync.Once
+
+	// AllowGETMode keeps the deprecated GET /?mode= form working, when it is
+	// false only POST is accepted
+	AllowGETMode bool
+
+	// AuthToken, when set, must be sent as a bearer token with every request
+	// which changes the state of a pin
+	AuthToken string
+
+	// ready is reported by /healthz, it is atomic so that health checks
+	// never wait on the pins
+	ready atomic.Bool
+
+	// Drivers are the host drivers reported by /healthz?verbose=1
+	Drivers []DriverStatus
+
+	// Build is the build and board reported by /version
+	Build BuildInfo
+
+	// requests counts the HTTP requests served for /stats
+	requests atomic.Uint64
+
+	// CoalesceWindow is the window within which on, off and solid commands
+	// sent to the same pin over gRPC, or mode changes, are coalesced, see
+	// Coalescer. Commands queued for a pin use Manager.CoalesceWindow.
+	CoalesceWindow time.Duration
+
+	// coalescersMu guards coalescers, keyed by the target of the commands
+	coalescersMu sync.Mutex
+	coalescers   map[string]*Coalescer
+
+	// RecordingsDir is the directory recordings are written to and replayed
+	// from
+	RecordingsDir string
+	recorder      *Recorder
+
+	// batchMu serialises /batch requests so the commands of two batches
+	// never interleave
+	batchMu sync.Mutex
+
+	// selfTestMu is held while a self-test runs
+	selfTestMu sync.Mutex
+
+	// patternMu guards stopPattern which cancels the running multi-pin
+	// pattern
+	patternMu   sync.Mutex
+	stopPattern context.CancelFunc
+}
+
+// maxMorseLength is the longest message accepted by /pins/{id}/morse
+const maxMorseLength = 1024
+
+// PinStatus is the JSON representation of a single pin
+type PinStatus struct {
+	// ID addresses the pin in the API, GPIO is its number on Board
+	ID      string  `json:"id"`
+	Board   string  `json:"board"`
+	GPIO    int     `json:"gpio"`
+	Alias   string  `json:"alias,omitempty"`
+	Name    string  `json:"name"`
+	Running bool    `json:"running"`
+	Mode    Mode    `json:"mode"`
+	Pattern Pattern `json:"pattern,omitempty"`
+	Level   string  `json:"level"`
+
+	// Brightness is the duty cycle the pin is driven at, 1 or 0 when it is
+	// simply on or off
+	Brightness float64 `json:"brightness"`
+
+	// Available is false for a pin which could not be initialised, Error
+	// gives the reason
+	Available bool   `json:"available"`
+	Error     string `json:"error,omitempty"`
+
+	// Failures is the number of consecutive failed writes and LastError the
+	// most recent write error, a panic in the goroutine driving the pin
+	// counts as a failure. Both are cleared by /pins/{id}/reset.
+	Failures  int    `json:"failures,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+
+	// Info is what the GPIO driver reports about an available pin, also
+	// served by /pins/{id}/info
+	Info *PinInfo `json:"info,omitempty"`
+
+	// Source is the priority of the commands an available pin follows,
+	// manual, schedule or default
+	Source string `json:"source,omitempty"`
+
+	// Disabled is set while every command for the pin is ignored, see
+	// /pins/{id}/disable
+	Disabled bool `json:"disabled,omitempty"`
+
+	// n orders the pins by board and GPIO number, see boardStride
+	n int
+}
+
+// NewAPI creates an API for the pins of manager, groups of those pins keyed
+// by GPIO number and the schedules driving them. Pins which could not be
+// initialised are reported as unavailable. events is the bus the pins publish
+// to.
+func NewAPI(manager *Manager, groups map[string][]int, schedules *Scheduler, events *Bus) *API {
+	a := &API{manager: manager, groups: groups, schedules: schedules, events: events, streams: make(chan struct{}), mux: http.NewServeMux()}
+	a.recorder = NewRecorder(events, manager)
+
+	a.mux.HandleFunc("/", a.handleRoot)
+	a.mux.HandleFunc("/mode", a.handleMode)
+	a.mux.HandleFunc("/pins/", a.handlePin)
+	a.mux.HandleFunc("/status", a.handleStatus)
+	a.mux.HandleFunc("/batch", a.handleBatch)
+	a.mux.HandleFunc("/selftest", a.handleSelfTest)
+	a.mux.HandleFunc("/reload", a.handleReload)
+	a.mux.HandleFunc("/config", a.handleConfig)
+	a.mux.HandleFunc("/audit", a.handleAudit)
+	a.mux.HandleFunc("/record/", a.handleRecord)
+	a.mux.HandleFunc("/replay", a.handleReplay)
+	a.mux.HandleFunc("/all/", a.handleAll)
+	a.mux.HandleFunc("/groups", a.handleGroups)
+	a.mux.HandleFunc("/groups/", a.handleGroup)
+	a.mux.HandleFunc("/schedules", a.handleSchedules)
+	a.mux.HandleFunc("/pattern/", a.handlePattern)
+	a.mux.HandleFunc("/stats", a.handleStats)
+	a.mux.HandleFunc("/healthz", a.handleHealth)
+	a.mux.HandleFunc("/version", a.handleVersion)
+	a.mux.Handle("/metrics", newMetricsHandler(a))
+	a.mux.HandleFunc("/ws", a.handleWS)
+	a.mux.HandleFunc("/events", a.handleEvents)
+	a.mux.HandleFunc("/openapi.json", a.handleOpenAPI)
+	a.mux.HandleFunc("/docs", a.handleDocs)
+
+	a.handler = promhttp.InstrumentHandlerDuration(httpDuration, a.mux)
+
+	return a
+}
+
+func (a *API) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	a.requests.Add(1)
+
+	identity := ""
+	if a.AuthToken != "" {
+		if authorized(r, a.AuthToken) {
+			identity = "token"
+		} else if mutating(r) {
+			rw.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(rw, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	ctx := contextWithSource(r.Context(), SourceHTTP, identity, r.RemoteAddr)
+	a.handler.ServeHTTP(rw, r.WithContext(ctx))
+}
+
+// SetReady sets whether /healthz reports the server as ready
+func (a *API) SetReady(ready bool) {
+	a.ready.Store(ready)
+}
+
+// Health is the JSON returned by /healthz?verbose=1
+type Health struct {
+	Ready   bool           `json:"ready"`
+	Drivers []DriverStatus `json:"drivers"`
+}
+
+// handleHealth reports whether the server is ready to accept commands, with
+// verbose set it also reports the host drivers as JSON
+func (a *API) handleHealth(rw http.ResponseWriter, r *http.Request) {
+	ready := a.ready.Load()
+
+	if v, _ := strconv.ParseBool(r.URL.Query().Get("verbose")); v {
+		status := http.StatusOK
+		if !ready {
+			status = http.StatusServiceUnavailable
+		}
+
+		writeJSON(rw, status, Health{Ready: ready, Drivers: a.Drivers})
+		return
+	}
+
+	if !ready {
+		http.Error(rw, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	rw.Write([]byte("ok\n"))
+}
+
+// handleMode is the original all-or-nothing handler, cycling every pin for
+// mode=on, blinking them together for mode=sync and stopping them for
+// mode=off. It replies with the new state of every pin.
+func (a *API) handleMode(rw http.ResponseWriter, r *http.Request) {
+	mode := r.FormValue("mode")
+
+	switch r.Method {
+	case http.MethodPost:
+	case http.MethodGet:
+		if !a.AllowGETMode || r.URL.Path != "/" {
+			methodNotAllowed(rw, http.MethodPost)
+			return
+		}
+
+		logger.WarnContext(r.Context(), "GET /?mode= is deprecated and will be removed, use POST /mode", "event", "deprecated", "mode", mode)
+	default:
+		methodNotAllowed(rw, http.MethodPost)
+		return
+	}
+
+	var apply func()
+
+	switch mode {
+	case "on":
+		d, err := durationParam(r.FormValue("duration"), 0)
+		if err != nil || d < 0 {
+			http.Error(rw, "duration must be a positive duration such as 30s", http.StatusBadRequest)
+			return
+		}
+
+		apply = func() {
+			logger.InfoContext(r.Context(), "On", "event", "on")
+			a.manager.OnAll(r.Context(), d)
+		}
+	case "sync":
+		apply = func() {
+			logger.InfoContext(r.Context(), "Sync", "event", "sync")
+			a.manager.audit(r.Context(), "all", "sync", nil)
+
+			pins := enabledPins(a.manager.Ordered())
+			a.manager.hold(r.Context(), pins...)
+			a.startPattern(r.Context(), func(ctx context.Context) {
+				SyncCycle(ctx, pins, DefaultSyncInterval)
+			})
+		}
+	case "off":
+		apply = func() {
+			logger.InfoContext(r.Context(), "Off", "event", "off")
+			a.manager.OffAll(r.Context())
+		}
+	default:
+		http.Error(rw, "mode must be on, off or sync", http.StatusBadRequest)
+		return
+	}
+
+	modeRequests.WithLabelValues(mode).Inc()
+	if err := a.coalescer("mode").Do(r.Context(), apply); err != nil {
+		logger.WarnContext(r.Context(), "Request cancelled before it was applied", "event", "cancelled", "mode", mode)
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, a.manager.Status())
+}
+
+// handleStatus returns the state of every pin ordered by GPIO number
+func (a *API) handleStatus(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(rw, http.MethodGet)
+		return
+	}
+
+	writeResponse(rw, r, http.StatusOK, a.manager.Status())
+}
+
+// handlePin handles /pins/{id} and /pins/{id}/{action} where id is either
+// the GPIO number or alias of the pin
+func (a *API) handlePin(rw http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/pins/"), "/"), "/")
+	parts = a.manager.pinPath(parts)
+
+	if len(parts) > 2 {
+		http.NotFound(rw, r)
+		return
+	}
+
+	n, p, err := a.manager.Lookup(parts[0])
+	if err != nil {
+		a.handleFailedPin(rw, r, parts, err)
+		return
+	}
+
+	id := strconv.Itoa(n)
+
+	if len(parts) == 1 {
+		switch r.Method {
+		case http.MethodGet:
+			writeResponse(rw, r, http.StatusOK, a.manager.status(n, p))
+		case http.MethodPut:
+			a.handlePutPin(rw, r, n, p)
+		default:
+			methodNotAllowed(rw, http.MethodGet+", "+http.MethodPut)
+		}
+		return
+	}
+
+	if parts[1] == "info" {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(rw, http.MethodGet)
+			return
+		}
+
+		writeJSON(rw, http.StatusOK, pinInfo(n%boardStride, p.Pin))
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		methodNotAllowed(rw, http.MethodPost)
+		return
+	}
+
+	// a disabled pin ignores anything which would drive it
+	switch parts[1] {
+	case "on", "solid", "toggle", "pattern", "off", "brightness", "reset", "fade", "morse", "sequence", "blink":
+		if a.manager.ignored(r.Context(), p, parts[1]) {
+			writeResponse(rw, r, http.StatusOK, a.manager.status(n, p))
+			return
+		}
+	}
+
+	switch parts[1] {
+	case "on":
+		d, err := durationParam(r.URL.Query().Get("duration"), 0)
+		if err != nil || d < 0 {
+			http.Error(rw, "duration must be a positive duration such as 30s", http.StatusBadRequest)
+			return
+		}
+
+		modeRequests.WithLabelValues("on").Inc()
+		a.enqueue(rw, r, n, p, "on", true, func(ctx context.Context) error {
+			logger.InfoContext(ctx, "On", "event", "on", "pin", p.Pin.Name())
+			return a.manager.On(ctx, id, d)
+		})
+		return
+	case "solid":
+		modeRequests.WithLabelValues("solid").Inc()
+		a.enqueue(rw, r, n, p, "solid", true, func(ctx context.Context) error {
+			logger.InfoContext(ctx, "Solid", "event", "solid", "pin", p.Pin.Name())
+			return a.manager.Solid(ctx, id)
+		})
+		return
+	case "toggle":
+		// not coalesced, two quick toggles should cancel each other out
+		modeRequests.WithLabelValues("toggle").Inc()
+		a.enqueue(rw, r, n, p, "toggle", false, func(ctx context.Context) error {
+			logger.InfoContext(ctx, "Toggle", "event", "toggle", "pin", p.Pin.Name())
+			return a.manager.Toggle(ctx, id)
+		})
+		return
+	case "pattern":
+		pattern, err := ParsePattern(r.URL.Query().Get("name"))
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		a.enqueue(rw, r, n, p, "pattern", false, func(ctx context.Context) error {
+			logger.InfoContext(ctx, "Pattern", "event", "pattern", "pin", p.Pin.Name(), "pattern", pattern)
+			p.SetPattern(ctx, pattern)
+			a.manager.audit(ctx, p.Pin.Name(), "pattern "+string(pattern), nil)
+			return nil
+		})
+		return
+	case "off":
+		modeRequests.WithLabelValues("off").Inc()
+		a.enqueue(rw, r, n, p, "off", true, func(ctx context.Context) error {
+			logger.InfoContext(ctx, "Off", "event", "off", "pin", p.Pin.Name())
+			return a.manager.Off(ctx, id)
+		})
+		return
+	case "brightness":
+		duty, err := strconv.ParseFloat(r.URL.Query().Get("value"), 64)
+		if err != nil {
+			http.Error(rw, "value must be a number between 0 and 1", http.StatusBadRequest)
+			return
+		}
+
+		a.enqueue(rw, r, n, p, "brightness", false, func(ctx context.Context) error {
+			logger.InfoContext(ctx, "Brightness", "event", "brightness", "pin", p.Pin.Name(), "duty", duty)
+			err := p.SetBrightness(ctx, duty)
+			a.manager.audit(ctx, p.Pin.Name(), "brightness", err)
+			a.manager.hold(ctx, p)
+
+			return err
+		})
+		return
+	case "release":
+		logger.InfoContext(r.Context(), "Release", "event", "release", "pin", p.Pin.Name())
+
+		if err := a.manager.Release(r.Context(), id); err != nil {
+			logger.ErrorContext(r.Context(), "Unable to release pin", "event", "error", "pin", p.Pin.Name(), "error", err)
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	case "enable":
+		logger.InfoContext(r.Context(), "Enable", "event", "enable", "pin", p.Pin.Name())
+		a.manager.Enable(r.Context(), id)
+	case "disable":
+		logger.InfoContext(r.Context(), "Disable", "event", "disable", "pin", p.Pin.Name())
+
+		if err := a.manager.Disable(r.Context(), id); err != nil {
+			logger.ErrorContext(r.Context(), "Unable to drive pin low", "event", "error", "pin", p.Pin.Name(), "error", err)
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	case "reset":
+		logger.InfoContext(r.Context(), "Reset", "event", "reset", "pin", p.Pin.Name())
+
+		if err := a.manager.Reset(r.Context(), id); err != nil {
+			logger.ErrorContext(r.Context(), "Unable to reset pin", "event", "error", "pin", p.Pin.Name(), "error", err)
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	case "fade":
+		q := r.URL.Query()
+
+		to, err := strconv.ParseFloat(q.Get("to"), 64)
+		if err != nil {
+			http.Error(rw, "to must be a number between 0 and 1", http.StatusBadRequest)
+			return
+		}
+
+		ms, err := strconv.Atoi(q.Get("ms"))
+		if err != nil || ms < 0 {
+			http.Error(rw, "ms must be a positive number of milliseconds", http.StatusBadRequest)
+			return
+		}
+
+		curve := CurveLinear
+		switch q.Get("curve") {
+		case "", "linear":
+		case "perceptual":
+			curve = CurvePerceptual
+		default:
+			http.Error(rw, "curve must be linear or perceptual", http.StatusBadRequest)
+			return
+		}
+
+		logger.InfoContext(r.Context(), "Fade", "event", "fade", "pin", p.Pin.Name(), "to", to, "ms", ms)
+		err = p.FadeCurve(r.Context(), to, time.Duration(ms)*time.Millisecond, curve)
+		a.manager.audit(r.Context(), p.Pin.Name(), "fade", err)
+		a.manager.hold(r.Context(), p)
+
+		if err != nil {
+			logger.ErrorContext(r.Context(), "Unable to fade pin", "event", "error", "pin", p.Pin.Name(), "error", err)
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	case "morse":
+		unit, err := durationParam(r.URL.Query().Get("unit"), DefaultMorseUnit)
+		if err != nil || unit <= 0 {
+			http.Error(rw, "unit must be a positive duration such as 150ms", http.StatusBadRequest)
+			return
+		}
+
+		text, err := io.ReadAll(io.LimitReader(r.Body, maxMorseLength))
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		logger.InfoContext(r.Context(), "Morse", "event", "morse", "pin", p.Pin.Name(), "text", string(text))
+		_, err = p.startMorse(r.Context(), string(text), unit)
+		a.manager.audit(r.Context(), p.Pin.Name(), "morse", err)
+		a.manager.hold(r.Context(), p)
+
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case "blink":
+		q := r.URL.Query()
+
+		times, err := strconv.Atoi(q.Get("times"))
+		if err != nil || times <= 0 {
+			http.Error(rw, "times must be a number greater than 0", http.StatusBadRequest)
+			return
+		}
+
+		on, err := durationParam(q.Get("on"), DefaultBlinkDuration)
+		if err != nil || on <= 0 {
+			http.Error(rw, "on must be a positive duration such as 150ms", http.StatusBadRequest)
+			return
+		}
+
+		off, err := durationParam(q.Get("off"), DefaultBlinkDuration)
+		if err != nil || off <= 0 {
+			http.Error(rw, "off must be a positive duration such as 150ms", http.StatusBadRequest)
+			return
+		}
+
+		logger.InfoContext(r.Context(), "Blink", "event", "blink", "pin", p.Pin.Name(), "times", times, "on", on.String(), "off", off.String())
+		err = p.Blink(r.Context(), times, on, off)
+		a.manager.audit(r.Context(), p.Pin.Name(), "blink", err)
+		a.manager.hold(r.Context(), p)
+
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case "sequence":
+		text, err := io.ReadAll(io.LimitReader(r.Body, maxSequenceLength))
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		steps, err := ParseSequence(string(text))
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		logger.InfoContext(r.Context(), "Sequence", "event", "sequence", "pin", p.Pin.Name(), "steps", len(steps))
+		err = p.RunPattern(r.Context(), steps)
+		a.manager.audit(r.Context(), p.Pin.Name(), "sequence", err)
+		a.manager.hold(r.Context(), p)
+
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.NotFound(rw, r)
+		return
+	}
+
+	writeResponse(rw, r, http.StatusOK, a.manager.status(n, p))
+}
+
+// QueuedCommand is the reply to an action queued for a pin, the pin has not
+// been driven yet and a later on, off or solid may still replace it
+type QueuedCommand struct {
+	ID     string `json:"id"`
+	Action string `json:"action"`
+
+	// Position is the place of the command in the queue of the pin, 1 when
+	// nothing is ahead of it
+	Position int `json:"position"`
+}
+
+// Text returns the command on one line, such as "23 on queued at 1"
+func (c QueuedCommand) Text() string {
+	return fmt.Sprintf("%s %s queued at %d", c.ID, c.Action, c.Position)
+}
+
+// enqueue adds fn to the queue of pin n, see Manager.Enqueue, and replies
+// 202 with a QueuedCommand
+func (a *API) enqueue(rw http.ResponseWriter, r *http.Request, n int, p *PinCycle, action string, coalesce bool, fn func(ctx context.Context) error) {
+	position, err := a.manager.Enqueue(r.Context(), n, action, coalesce, fn)
+	if err != nil {
+		logger.WarnContext(r.Context(), "Unable to queue command", "event", "error", "pin", p.Pin.Name(), "action", action, "error", err)
+
+		status := http.StatusTooManyRequests
+		if errors.Is(err, ErrShuttingDown) {
+			status = http.StatusServiceUnavailable
+		}
+
+		http.Error(rw, err.Error(), status)
+		return
+	}
+
+	writeResponse(rw, r, http.StatusAccepted, QueuedCommand{ID: pinID(p.Board, n%boardStride), Action: action, Position: position})
+}
+
+// GroupStatus is the JSON representation of a group
+type GroupStatus struct {
+	Name string   `json:"name"`
+	Pins []PinRef `json:"pins"`
+}
+
+// handleFailedPin reports the status of an unavailable pin, any action on it
+// fails as the pin can not be driven. err is the error returned looking the
+// pin up.
+func (a *API) handleFailedPin(rw http.ResponseWriter, r *http.Request, parts []string, err error) {
+	var e *PinError
+	if !errors.As(err, &e) {
+		http.NotFound(rw, r)
+		return
+	}
+
+	if len(parts) == 1 && r.Method == http.MethodGet {
+		writeResponse(rw, r, http.StatusOK, failedStatus(e))
+		return
+	}
+
+	http.Error(rw, e.Error(), http.StatusServiceUnavailable)
+}
+
+// handleAll handles /all/on, cycling every pin, and /all/off, an emergency
+// stop which cancels any pattern and pending command and drives every pin
+// low whatever state it is thought to be in
+func (a *API) handleAll(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(rw, http.MethodPost)
+		return
+	}
+
+	switch strings.TrimPrefix(r.URL.Path, "/all/") {
+	case "on":
+		d, err := durationParam(r.URL.Query().Get("duration"), 0)
+		if err != nil || d < 0 {
+			http.Error(rw, "duration must be a positive duration such as 30s", http.StatusBadRequest)
+			return
+		}
+
+		logger.InfoContext(r.Context(), "All on", "event", "on")
+		modeRequests.WithLabelValues("on").Inc()
+
+		a.manager.OnAll(r.Context(), d)
+	case "off":
+		logger.WarnContext(r.Context(), "All off", "event", "off")
+		modeRequests.WithLabelValues("off").Inc()
+
+		a.startPattern(r.Context(), nil)
+
+		a.coalescersMu.Lock()
+		for _, c := range a.coalescers {
+			c.Discard()
+		}
+		a.coalescersMu.Unlock()
+		a.manager.DiscardQueued()
+
+		if err := a.manager.OffAll(r.Context()); err != nil {
+			writeJSON(rw, http.StatusInternalServerError, a.manager.Status())
+			return
+		}
+	case "release":
+		logger.InfoContext(r.Context(), "Release all", "event", "release")
+
+		if err := a.manager.ReleaseAll(r.Context()); err != nil {
+			writeJSON(rw, http.StatusInternalServerError, a.manager.Status())
+			return
+		}
+	default:
+		http.NotFound(rw, r)
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, a.manager.Status())
+}
+
+// handleGroups lists the groups and their members ordered by name
+func (a *API) handleGroups(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(rw, http.MethodGet)
+		return
+	}
+
+	a.configMu.RLock()
+	groups := a.groups
+	a.configMu.RUnlock()
+
+	names := []string{}
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	status := []GroupStatus{}
+	for _, name := range names {
+		pins := []PinRef{}
+		for _, n := range groups[name] {
+			pins = append(pins, PinRef(a.manager.ID(n)))
+		}
+
+		status = append(status, GroupStatus{Name: name, Pins: pins})
+	}
+
+	writeJSON(rw, http.StatusOK, status)
+}
+
+// handleGroup handles /groups/{name}/{on|off} sending the command to every
+// member of the group
+func (a *API) handleGroup(rw http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/groups/"), "/"), "/")
+	if len(parts) != 2 {
+		http.NotFound(rw, r)
+		return
+	}
+
+	a.configMu.RLock()
+	members, ok := a.groups[parts[0]]
+	a.configMu.RUnlock()
+	if !ok {
+		http.NotFound(rw, r)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		methodNotAllowed(rw, http.MethodPost)
+		return
+	}
+
+	switch parts[1] {
+	case "on":
+		d, err := durationParam(r.URL.Query().Get("duration"), 0)
+		if err != nil || d < 0 {
+			http.Error(rw, "duration must be a positive duration such as 30s", http.StatusBadRequest)
+			return
+		}
+
+		logger.InfoContext(r.Context(), "On", "event", "on", "group", parts[0])
+		modeRequests.WithLabelValues("on").Inc()
+
+		a.manager.OnPins(r.Context(), members, d)
+	case "twinkle":
+		q := r.URL.Query()
+
+		intensity := DefaultTwinkleIntensity
+		if v := q.Get("intensity"); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil || f <= 0 || f > 1 {
+				http.Error(rw, "intensity must be a number greater than 0 and at most 1", http.StatusBadRequest)
+				return
+			}
+
+			intensity = f
+		}
+
+		interval, err := durationParam(q.Get("interval"), DefaultTwinkleInterval)
+		if err != nil || interval <= 0 {
+			http.Error(rw, "interval must be a positive duration such as 400ms", http.StatusBadRequest)
+			return
+		}
+
+		logger.InfoContext(r.Context(), "Twinkle", "event", "twinkle", "group", parts[0], "intensity", intensity, "interval", interval.String())
+
+		pins := []*PinCycle{}
+		for _, n := range members {
+			if p, ok := a.manager.Pin(n); ok && p.Enabled() {
+				pins = append(pins, p)
+				a.manager.audit(r.Context(), p.Pin.Name(), "twinkle", nil)
+			}
+		}
+		a.manager.hold(r.Context(), pins...)
+
+		a.startPattern(r.Context(), func(ctx context.Context) {
+			Twinkle(ctx, pins, intensity, interval)
+		})
+	case "off":
+		logger.InfoContext(r.Context(), "Off", "event", "off", "group", parts[0])
+		modeRequests.WithLabelValues("off").Inc()
+
+		for _, n := range members {
+			if err := a.manager.Off(r.Context(), strconv.Itoa(n)); err != nil {
+				logger.ErrorContext(r.Context(), "Unable to turn off pin", "event", "error", "pin", a.manager.Label(n), "error", err)
+			}
+		}
+	default:
+		http.NotFound(rw, r)
+		return
+	}
+
+	status := []PinStatus{}
+	for _, n := range members {
+		s, _ := a.manager.Get(strconv.Itoa(n))
+		status = append(status, s)
+	}
+
+	writeJSON(rw, http.StatusOK, status)
+}
+
+// handleSchedules lists the schedules in configuration order
+func (a *API) handleSchedules(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(rw, http.MethodGet)
+		return
+	}
+
+	a.configMu.RLock()
+	schedules := a.schedules
+	a.configMu.RUnlock()
+
+	writeJSON(rw, http.StatusOK, schedules.Status())
+}
+
+// handlePattern handles /pattern/{name} starting a pattern across every pin
+// in GPIO order, and /pattern/stop
+func (a *API) handlePattern(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(rw, http.MethodPost)
+		return
+	}
+
+	q := r.URL.Query()
+
+	switch strings.TrimPrefix(r.URL.Path, "/pattern/") {
+	case "chase":
+		interval, err := durationParam(q.Get("interval"), DefaultChaseInterval)
+		if err != nil || interval <= 0 {
+			http.Error(rw, "interval must be a positive duration such as 120ms", http.StatusBadRequest)
+			return
+		}
+
+		logger.InfoContext(r.Context(), "Chase", "event", "chase", "interval", interval.String())
+		a.manager.audit(r.Context(), "all", "pattern chase", nil)
+		pins := enabledPins(a.manager.Ordered())
+		a.manager.hold(r.Context(), pins...)
+		a.startPattern(r.Context(), func(ctx context.Context) {
+			Chase(ctx, pins, interval)
+		})
+	case "sync":
+		interval, err := durationParam(q.Get("interval"), DefaultSyncInterval)
+		if err != nil || interval <= 0 {
+			http.Error(rw, "interval must be a positive duration such as 500ms", http.StatusBadRequest)
+			return
+		}
+
+		logger.InfoContext(r.Context(), "Sync", "event", "sync", "interval", interval.String())
+		a.manager.audit(r.Context(), "all", "pattern sync", nil)
+		pins := enabledPins(a.manager.Ordered())
+		a.manager.hold(r.Context(), pins...)
+		a.startPattern(r.Context(), func(ctx context.Context) {
+			SyncCycle(ctx, pins, interval)
+		})
+	case "traffic/start":
+		t, err := a.trafficLight(q)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		logger.InfoContext(r.Context(), "Traffic light", "event", "traffic", "red", t.Red.Pin.Name(), "amber", t.Amber.Pin.Name(), "green", t.Green.Pin.Name())
+		a.manager.audit(r.Context(), "all", "pattern traffic", nil)
+		a.manager.hold(r.Context(), t.Red, t.Amber, t.Green)
+		a.startPattern(r.Context(), t.Run)
+	case "stop", "traffic/stop":
+		// only one pattern runs at a time so stopping the traffic light is
+		// the same as stopping any pattern
+		logger.InfoContext(r.Context(), "Stop pattern", "event", "off")
+		a.manager.audit(r.Context(), "all", "pattern stop", nil)
+		a.startPattern(r.Context(), nil)
+	default:
+		http.NotFound(rw, r)
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, a.manager.Status())
+}
+
+// coalescer returns the Coalescer for commands to target
+func (a *API) coalescer(target string) *Coalescer {
+	a.coalescersMu.Lock()
+	defer a.coalescersMu.Unlock()
+
+	if a.coalescers == nil {
+		a.coalescers = map[string]*Coalescer{}
+	}
+
+	c, ok := a.coalescers[target]
+	if !ok {
+		c = &Coalescer{Window: a.CoalesceWindow}
+		a.coalescers[target] = c
+	}
+
+	return c
+}
+
+// trafficLight builds a TrafficLight from the query parameters of
+// /pattern/traffic/start, the lights default to the first three enabled pins
+func (a *API) trafficLight(q url.Values) (*TrafficLight, error) {
+	pins := enabledPins(a.manager.Ordered())
+	if len(pins) > 3 {
+		pins = pins[:3]
+	}
+
+	if ids := q.Get("pins"); ids != "" {
+		pins = []*PinCycle{}
+
+		for _, id := range strings.Split(ids, ",") {
+			_, p, err := a.manager.Lookup(strings.TrimSpace(id))
+			if err != nil {
+				return nil, fmt.Errorf("unknown pin %q", id)
+			}
+
+			if !p.Enabled() {
+				return nil, fmt.Errorf("pin %q is disabled", id)
+			}
+
+			pins = append(pins, p)
+		}
+	}
+
+	if len(pins) != 3 {
+		return nil, fmt.Errorf("pins must list exactly three pins, red, amber and green")
+	}
+
+	t := &TrafficLight{Red: pins[0], Amber: pins[1], Green: pins[2]}
+
+	for _, d := range []struct {
+		name  string
+		value *time.Duration
+	}{
+		{"red", &t.RedTime},
+		{"redamber", &t.RedAmberTime},
+		{"green", &t.GreenTime},
+		{"amber", &t.AmberTime},
+	} {
+		v, err := durationParam(q.Get(d.name), 0)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("%s must be a positive duration such as 5s", d.name)
+		}
+
+		*d.value = v
+	}
+
+	return t, nil
+}
+
+// startPattern cancels the running pattern and runs fn with a context
+// carrying the values of parent, when fn is nil the running pattern is only
+// cancelled
+func (a *API) startPattern(parent context.Context, fn func(ctx context.Context)) {
+	a.patternMu.Lock()
+	defer a.patternMu.Unlock()
+
+	if a.stopPattern != nil {
+		a.stopPattern()
+		a.stopPattern = nil
+	}
+
+	if fn == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.WithoutCancel(parent))
+	a.stopPattern = cancel
+
+	go func() {
+		defer recoverPattern(ctx)
+		fn(ctx)
+	}()
+}
+
+// cycle starts cycling p, stopping it after d when d is not zero
+func cycle(ctx context.Context, p *PinCycle, d time.Duration) {
+	if d > 0 {
+		p.CycleFor(ctx, d)
+		return
+	}
+
+	p.Cycle(ctx)
+}
+
+// sortedPins returns the pins in ascending GPIO order
+func sortedPins(pins map[int]*PinCycle) []*PinCycle {
+	sorted := []*PinCycle{}
+	for _, n := range pinNumbers(pins) {
+		sorted = append(sorted, pins[n])
+	}
+
+	return sorted
+}
+
+func pinStatus(n int, p *PinCycle) PinStatus {
+	mode, level := p.State()
+	failures, lastErr := p.Errors()
+
+	s := PinStatus{
+		ID:      pinID(p.Board, n%boardStride),
+		Board:   boardName(p.Board),
+		GPIO:    n % boardStride,
+		Alias:   p.alias(),
+		Name:    p.Pin.Name(),
+		Running: mode != ModeOff,
+		Mode:    mode,
+		Pattern: p.Pattern(),
+		Level:   level.String(),
+
+		Brightness: p.Brightness(),
+		Available:  true,
+		Failures:   failures,
+		Disabled:   !p.Enabled(),
+
+		n: n,
+	}
+
+	if lastErr != nil {
+		s.LastError = lastErr.Error()
+	}
+
+	info := pinInfo(n%boardStride, p.Pin)
+	s.Info = &info
+
+	return s
+}
+
+// failedStatus returns the status of a pin which could not be initialised
+func failedStatus(e *PinError) PinStatus {
+	return PinStatus{
+		ID:    pinID(e.Board, e.GPIO),
+		Board: boardName(e.Board),
+		GPIO:  e.GPIO,
+		Alias: e.Alias,
+		Name:  pinLabel(e.Board, e.GPIO),
+		Mode:  ModeOff,
+
+		Available: false,
+		Error:     e.Err.Error(),
+
+		n: e.n,
+	}
+}
+
+// pinNumbers returns the GPIO numbers of the pins in ascending order
+func pinNumbers(pins map[int]*PinCycle) []int {
+	numbers := make([]int, 0, len(pins))
+	for n := range pins {
+		numbers = append(numbers, n)
+	}
+
+	sort.Ints(numbers)
+	return numbers
+}
+
+// durationParam parses a duration query parameter, returning def when it is
+// empty
+func durationParam(v string, def time.Duration) (time.Duration, error) {
+	if v == "" {
+		return def, nil
+	}
+
+	return time.ParseDuration(v)
+}
+
+func methodNotAllowed(rw http.ResponseWriter, allow string) {
+	rw.Header().Set("Allow", allow)
+	http.Error(rw, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+}
+
+func writeJSON(rw http.ResponseWriter, status int, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+
+	if err := json.NewEncoder(rw).Encode(v); err != nil {
+		logger.Error("Unable to write response", "error", err)
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Sources of the operations recorded in the audit log
+const (
+	SourceHTTP     = "http"
+	SourceGRPC     = "grpc"
+	SourceMQTT     = "mqtt"
+	SourceSchedule = "schedule"
+	SourceInput    = "input"
+
+	// SourceSystem is recorded for operations with no source in their
+	// context, such as stopping the pins on shutdown
+	SourceSystem = "system"
+)
+
+// maxAuditEntries is the number of entries kept in memory for /audit
+const maxAuditEntries = 1000
+
+// auditQueueSize is the number of entries which may be waiting to be written
+// before further entries are dropped from the file
+const auditQueueSize = 256
+
+// AuditEntry is a single state changing operation on a pin
+type AuditEntry struct {
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"`
+
+	// Identity is who was authenticated for the operation, if anyone, and
+	// Remote the address the request came from
+	Identity string `json:"identity,omitempty"`
+	Remote   string `json:"remote,omitempty"`
+
+	RequestID string `json:"request_id,omitempty"`
+	Pin       string `json:"pin"`
+	Action    string `json:"action"`
+	Error     string `json:"error,omitempty"`
+}
+
+type sourceKey struct{}
+
+type auditSource struct {
+	source   string
+	identity string
+	remote   string
+}
+
+// contextWithSource returns a copy of ctx recording where the operations
+// made with it came from, identity and remote may be empty
+func contextWithSource(ctx context.Context, source, identity, remote string) context.Context {
+	return context.WithValue(ctx, sourceKey{}, auditSource{source, identity, remote})
+}
+
+// AuditLog keeps the most recent entries in memory and appends every entry
+// to a file as a JSON line. Entries are written in the background so a slow
+// or unavailable file never holds up a pin, failures are logged and the file
+// is reopened for the next entry.
+type AuditLog struct {
+	path string
+
+	// mu guards entries, the most recent last, and closed which is set once
+	// the queue has been closed
+	mu      sync.Mutex
+	entries []AuditEntry
+	closed  bool
+
+	queue chan AuditEntry
+	done  chan struct{}
+}
+
+// NewAuditLog creates an AuditLog appending to the file at path, the most
+// recent entries already in the file are read back for /audit. With an empty
+// path entries are only kept in memory.
+func NewAuditLog(path string) *AuditLog {
+	l := &AuditLog{path: path}
+	if path == "" {
+		return l
+	}
+
+	l.entries = readAudit(path)
+	l.queue = make(chan AuditEntry, auditQueueSize)
+	l.done = make(chan struct{})
+
+	go l.write()
+
+	return l
+}
+
+// readAudit returns the last maxAuditEntries entries of the file at path,
+// lines which can not be read are skipped
+func readAudit(path string) []AuditEntry {
+	f, err := os.Open(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warn("Unable to read audit log", "event", "audit", "file", path, "error", err)
+		}
+
+		return nil
+	}
+	defer f.Close()
+
+	entries := []AuditEntry{}
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var e AuditEntry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			continue
+		}
+
+		entries = append(entries, e)
+		if len(entries) > maxAuditEntries {
+			entries = entries[1:]
+		}
+	}
+
+	return entries
+}
+
+// Add records e, it never blocks. Once the log is closed entries are only
+// kept in memory.
+func (l *AuditLog) Add(e AuditEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = append(l.entries, e)
+	if len(l.entries) > maxAuditEntries {
+		l.entries = l.entries[len(l.entries)-maxAuditEntries:]
+	}
+
+	if l.queue == nil || l.closed {
+		return
+	}
+
+	select {
+	case l.queue <- e:
+	default:
+		logger.Warn("Audit log is behind, entry not written to file", "event", "audit", "pin", e.Pin, "action", e.Action)
+	}
+}
+
+// Recent returns up to limit entries, the most recent first
+func (l *AuditLog) Recent(limit int) []AuditEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := []AuditEntry{}
+	for i := len(l.entries) - 1; i >= 0 && len(entries) < limit; i-- {
+		entries = append(entries, l.entries[i])
+	}
+
+	return entries
+}
+
+// Close writes any queued entries and closes the file
+func (l *AuditLog) Close() {
+	l.mu.Lock()
+	if l.queue == nil || l.closed {
+		l.mu.Unlock()
+		return
+	}
+
+	l.closed = true
+	close(l.queue)
+	l.mu.Unlock()
+
+	<-l.done
+}
+
+// write appends queued entries to the file until the queue is closed
+func (l *AuditLog) write() {
+	defer close(l.done)
+
+	var f *os.File
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+
+	for e := range l.queue {
+		if f == nil {
+			var err error
+			f, err = os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+			if err != nil {
+				logger.Error("Unable to open audit log", "event", "error", "file", l.path, "error", err)
+				f = nil
+				continue
+			}
+		}
+
+		line, _ := json.Marshal(e)
+		if _, err := f.Write(append(line, '\n')); err != nil {
+			logger.Error("Unable to write audit log", "event", "error", "file", l.path, "error", err)
+			f.Close()
+			f = nil
+		}
+	}
+}
+
+// audit records action on pin for the source in ctx, err is the result of
+// the operation. It does nothing if m has no AuditLog.
+func (m *Manager) audit(ctx context.Context, pin, action string, err error) {
+	if m.Audit == nil {
+		return
+	}
+
+	s, ok := ctx.Value(sourceKey{}).(auditSource)
+	if !ok {
+		s.source = SourceSystem
+	}
+
+	e := AuditEntry{
+		Time:      time.Now(),
+		Source:    s.source,
+		Identity:  s.identity,
+		Remote:    s.remote,
+		RequestID: requestID(ctx),
+		Pin:       pin,
+		Action:    action,
+	}
+
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	m.Audit.Add(e)
+}
+
+// handleAudit replies with the most recent audit entries, the most recent
+// first
+func (a *API) handleAudit(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(rw, http.MethodGet)
+		return
+	}
+
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAuditEntries {
+			http.Error(rw, "limit must be a number between 1 and "+strconv.Itoa(maxAuditEntries), http.StatusBadRequest)
+			return
+		}
+
+		limit = n
+	}
+
+	entries := []AuditEntry{}
+	if a.manager.Audit != nil {
+		entries = a.manager.Audit.Recent(limit)
+	}
+
+	writeJSON(rw, http.StatusOK, entries)
+}
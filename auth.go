@@ -0,0 +1,33 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// mutating returns true if r can change the state of a pin, reads such as
+// /status, /healthz and /metrics never need a token
+func mutating(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return true
+	}
+
+	// the deprecated GET /?mode= form
+	return r.URL.Path == "/" && r.URL.Query().Has("mode")
+}
+
+// authorized returns true if r carries the bearer token
+func authorized(r *http.Request, token string) bool {
+	return validBearer(r.Header.Get("Authorization"), token)
+}
+
+// validBearer returns true if the Authorization header value h is the bearer
+// token
+func validBearer(h, token string) bool {
+	if !strings.HasPrefix(h, "Bearer ") {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(h, "Bearer ")), []byte(token)) == 1
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxBatchSize bounds the size of a /batch request body
+const maxBatchSize = 1 << 20
+
+// BatchCommand is a single command in a /batch request. Pin is the GPIO number
+// or alias of the pin. Pattern, when set, is applied before Action. Value is
+// required by brightness.
+type BatchCommand struct {
+	Pin      json.RawMessage `json:"pin"`
+	Action   string          `json:"action"`
+	Pattern  string          `json:"pattern,omitempty"`
+	Duration string          `json:"duration,omitempty"`
+	Value    *float64        `json:"value,omitempty"`
+}
+
+// validate checks the fields of c which do not depend on the pin, a batch
+// containing an invalid command is rejected before any command is applied
+func (c BatchCommand) validate() error {
+	if c.Action != "brightness" {
+		return nil
+	}
+
+	if c.Value == nil || *c.Value <= 0 || *c.Value > 1 {
+		return fmt.Errorf("brightness value must be greater than 0 and at most 1, use the off action to turn the pin off")
+	}
+
+	return nil
+}
+
+// BatchResult reports the outcome of a BatchCommand
+type BatchResult struct {
+	Pin    string     `json:"pin"`
+	Action string     `json:"action"`
+	OK     bool       `json:"ok"`
+	Error  string     `json:"error,omitempty"`
+	Status *PinStatus `json:"status,omitempty"`
+}
+
+// handleBatch applies a JSON array of commands in order, a command which
+// fails is reported in its result without stopping the rest of the batch
+func (a *API) handleBatch(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(rw, http.MethodPost)
+		return
+	}
+
+	commands := []BatchCommand{}
+	if err := json.NewDecoder(http.MaxBytesReader(rw, r.Body, maxBatchSize)).Decode(&commands); err != nil {
+		http.Error(rw, fmt.Sprintf("body must be a JSON array of commands: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	for i, c := range commands {
+		if err := c.validate(); err != nil {
+			http.Error(rw, fmt.Sprintf("command %d: %s", i, err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	a.batchMu.Lock()
+	defer a.batchMu.Unlock()
+
+	results := []BatchResult{}
+	for _, c := range commands {
+		results = append(results, a.apply(r.Context(), c))
+	}
+
+	writeJSON(rw, http.StatusOK, results)
+}
+
+// apply runs a single batch command
+func (a *API) apply(ctx context.Context, c BatchCommand) BatchResult {
+	// the pin may be given as a number or a string
+	id := strings.Trim(string(c.Pin), `"`)
+	res := BatchResult{Pin: id, Action: c.Action}
+
+	n, p, err := a.manager.Lookup(id)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	if a.manager.ignored(ctx, p, c.Action) {
+		status := a.manager.status(n, p)
+		res.OK = true
+		res.Status = &status
+
+		return res
+	}
+
+	if c.Pattern != "" {
+		pattern, err := ParsePattern(c.Pattern)
+		if err != nil {
+			res.Error = err.Error()
+			return res
+		}
+
+		p.SetPattern(ctx, pattern)
+		a.manager.audit(ctx, p.Pin.Name(), "pattern "+string(pattern), nil)
+	}
+
+	switch id := strconv.Itoa(n); c.Action {
+	case "on":
+		d, derr := durationParam(c.Duration, 0)
+		if derr != nil || d < 0 {
+			res.Error = "duration must be a positive duration such as 30s"
+			return res
+		}
+
+		err = a.manager.On(ctx, id, d)
+	case "off":
+		err = a.manager.Off(ctx, id)
+	case "solid":
+		err = a.manager.Solid(ctx, id)
+	case "brightness":
+		err = p.SetBrightness(ctx, *c.Value)
+		a.manager.audit(ctx, p.Pin.Name(), "brightness", err)
+		a.manager.hold(ctx, p)
+	case "":
+		// only the pattern was changed
+	default:
+		res.Error = fmt.Sprintf("unknown action %q, expected on, off, solid or brightness", c.Action)
+		return res
+	}
+
+	if err != nil {
+		logger.ErrorContext(ctx, "Batch command failed", "event", "error", "pin", p.Pin.Name(), "action", c.Action, "error", err)
+		res.Error = err.Error()
+		return res
+	}
+
+	if c.Action != "" {
+		logger.InfoContext(ctx, "Batch", "event", c.Action, "pin", p.Pin.Name())
+		modeRequests.WithLabelValues(c.Action).Inc()
+	}
+
+	status := a.manager.status(n, p)
+	res.OK = true
+	res.Status = &status
+
+	return res
+}
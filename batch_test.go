@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBatchBrightness(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{"dimmed", `[{"pin":14,"action":"brightness","value":0.5}]`, http.StatusOK},
+		{"full", `[{"pin":14,"action":"brightness","value":1}]`, http.StatusOK},
+		{"missing", `[{"pin":14,"action":"brightness"}]`, http.StatusBadRequest},
+		{"zero", `[{"pin":14,"action":"brightness","value":0}]`, http.StatusBadRequest},
+		{"negative", `[{"pin":14,"action":"brightness","value":-0.5}]`, http.StatusBadRequest},
+		{"too bright", `[{"pin":14,"action":"brightness","value":1.5}]`, http.StatusBadRequest},
+		{"after a valid command", `[{"pin":14,"action":"on"},{"pin":14,"action":"brightness","value":2}]`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &fakePin{name: "GPIO14"}
+			f := &PinCycle{Pin: p}
+			a := NewAPI(NewManager(map[int]*PinCycle{14: f}, nil), nil, nil, nil)
+			defer f.Stop(context.Background())
+
+			rw := httptest.NewRecorder()
+			a.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(tt.body)))
+
+			if rw.Code != tt.code {
+				t.Fatalf("expected %d, got %d: %s", tt.code, rw.Code, rw.Body)
+			}
+
+			if tt.code != http.StatusOK {
+				// a rejected batch applies none of its commands
+				if mode, _ := f.State(); mode != ModeOff || len(p.Levels()) != 0 {
+					t.Fatalf("expected the pin to be untouched, got %s and %v", mode, p.Levels())
+				}
+
+				return
+			}
+
+			var results []BatchResult
+			if err := json.Unmarshal(rw.Body.Bytes(), &results); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(results) != 1 || !results[0].OK {
+				t.Fatalf("expected the command to succeed, got %+v", results)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"periph.io/x/periph/conn/gpio"
+)
+
+// Pattern selects how a cycling pin blinks
+type Pattern string
+
+// Patterns accepted by PinCycle.SetPattern
+const (
+	// PatternRandom flips the pin after a random time between MinInterval
+	// and MaxInterval, the original behaviour
+	PatternRandom Pattern = "random"
+	// PatternSteady flips the pin every MinInterval
+	PatternSteady Pattern = "steady"
+	// PatternPulse fades the pin up and down with PWM over PulsePeriod
+	PatternPulse Pattern = "pulse"
+	// PatternHeartbeat gives two quick flashes followed by a pause
+	PatternHeartbeat Pattern = "heartbeat"
+)
+
+// PulsePeriod is the time taken for PatternPulse to fade up and back down
+const PulsePeriod = 2 * time.Second
+
+// heartbeat is the time each level is held for PatternHeartbeat, starting
+// with the first flash
+var heartbeat = []time.Duration{
+	100 * time.Millisecond,
+	150 * time.Millisecond,
+	100 * time.Millisecond,
+	650 * time.Millisecond,
+}
+
+// DefaultBlinkDuration is how long each flash of Blink, and the gap after
+// it, lasts unless given
+const DefaultBlinkDuration = 150 * time.Millisecond
+
+// ParsePattern returns the Pattern named s, an empty name is PatternRandom
+func ParsePattern(s string) (Pattern, error) {
+	switch p := Pattern(s); p {
+	case "":
+		return PatternRandom, nil
+	case PatternRandom, PatternSteady, PatternPulse, PatternHeartbeat:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown pattern %q, expected random, steady, pulse or heartbeat", s)
+	}
+}
+
+// SetPattern changes how the pin blinks when cycling, a pin which is already
+// cycling indefinitely switches immediately while one started by CycleFor
+// uses the pattern next time it is cycled
+func (f *PinCycle) SetPattern(ctx context.Context, p Pattern) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.pattern == p {
+		return
+	}
+
+	f.pattern = p
+
+	if f.cancel != nil && f.mode == ModeCycling && f.until.IsZero() {
+		f.start(ctx, ModeCycling, f.cycle)
+	}
+}
+
+// Pattern returns the pattern used when the pin is cycling
+func (f *PinCycle) Pattern() Pattern {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.pattern == "" {
+		return PatternRandom
+	}
+
+	return f.pattern
+}
+
+// cycle blinks the pin with its pattern until ctx is cancelled
+func (f *PinCycle) cycle(ctx context.Context) {
+	switch f.Pattern() {
+	case PatternSteady:
+		f.blink(ctx, func(int) time.Duration {
+			min, _ := f.bounds()
+			return min
+		})
+	case PatternHeartbeat:
+		f.blink(ctx, func(step int) time.Duration {
+			return heartbeat[step%len(heartbeat)]
+		})
+	case PatternPulse:
+		f.breathe(ctx)
+	default:
+		f.blink(ctx, func(int) time.Duration {
+			return f.interval()
+		})
+	}
+}
+
+// blink flips the pin starting with High, holding each level for the
+// duration returned by hold for that step. hold is called with f.mu held.
+func (f *PinCycle) blink(ctx context.Context, hold func(step int) time.Duration) {
+	state := gpio.High
+
+	for step := 0; ; step++ {
+		if err := f.write(ctx, state); err != nil {
+			return
+		}
+
+		f.mu.Lock()
+		// level only matches state when the write succeeded
+		if f.level == state {
+			f.flips++
+		}
+		sleepDuration := hold(step)
+		f.mu.Unlock()
+
+		if !f.sleep(ctx, sleepDuration) {
+			return
+		}
+
+		// flip the state
+		if state == gpio.High {
+			state = gpio.Low
+		} else {
+			state = gpio.High
+		}
+	}
+}
+
+// breathe repeatedly fades the pin up and back down over PulsePeriod
+func (f *PinCycle) breathe(ctx context.Context) {
+	c := f.carrier()
+	half := PulsePeriod / 2
+
+	for {
+		start := f.clock().Now()
+
+		for {
+			elapsed := f.clock().Now().Sub(start)
+			if elapsed >= PulsePeriod {
+				break
+			}
+
+			p := float64(elapsed) / float64(half)
+			if elapsed > half {
+				p = 2 - p
+			}
+
+			duty := CurvePerceptual.at(0, 1, p)
+
+			// too frequent to publish, but reported by Brightness
+			f.mu.Lock()
+			if ctx.Err() == nil {
+				f.duty = duty
+			}
+			f.mu.Unlock()
+
+			if !c.pulse(ctx, duty) {
+				return
+			}
+		}
+	}
+}
+
+// Blink flashes the pin times times in a background goroutine, on for on and
+// then off for off each time, replacing anything else the pin was doing.
+// Unlike Cycle it then drives the pin low and exits, Stop ends it early.
+func (f *PinCycle) Blink(ctx context.Context, times int, on, off time.Duration) error {
+	if times <= 0 {
+		return fmt.Errorf("times must be greater than 0")
+	}
+
+	if on <= 0 || off <= 0 {
+		return fmt.Errorf("on and off must be positive durations")
+	}
+
+	steps := make([]Step, 0, 2*times)
+	for i := 0; i < times; i++ {
+		steps = append(steps, Step{gpio.High, on}, Step{gpio.Low, off})
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.start(ctx, ModeBlink, func(ctx context.Context) {
+		if f.play(ctx, steps) == nil {
+			f.finish(ctx)
+		}
+	})
+
+	return nil
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"periph.io/x/periph/conn/gpio"
+	"periph.io/x/periph/conn/gpio/gpioreg"
+	"periph.io/x/periph/conn/gpio/gpiotest"
+)
+
+// nativeBoard is the name of the GPIO header of the Raspberry Pi itself, the
+// board of pins which do not name one
+const nativeBoard = "rpi"
+
+// boardStride separates the pin numbers of each board. The pins of the
+// native board are keyed by their GPIO number and the pins of the Nth
+// configured board by N*boardStride plus their number, so a numeric id still
+// finds any pin and topics which can not contain / can address them.
+const boardStride = 1000
+
+// simulatedBoardPins is the number of pins simulated for each configured
+// board, as many as an MCP23017 has
+const simulatedBoardPins = 16
+
+// BoardConfig describes a GPIO expander, such as an MCP23017 on I²C or an
+// MCP23S17 on SPI, whose pins are addressed as name/pin. The pins are found
+// in the gpio registry, so the driver of the expander must be loaded and
+// register them, otherwise they are reported unavailable.
+type BoardConfig struct {
+	// Name is the namespace of the pins of the board, it must not be rpi,
+	// which is the native header, or contain /
+	Name string `json:"name"`
+
+	// Prefix is prepended to the number of a pin to find it in the gpio
+	// registry, such as "MCP23017_20_" for a driver which registers its pins
+	// as MCP23017_20_0 to MCP23017_20_15
+	Prefix string `json:"prefix"`
+}
+
+// PinRef refers to a configured output pin by its GPIO number on the native
+// board or as board/pin, in JSON it is either a number or a string
+type PinRef string
+
+// UnmarshalJSON accepts a GPIO number as well as a string
+func (r *PinRef) UnmarshalJSON(b []byte) error {
+	var n int
+	if err := json.Unmarshal(b, &n); err == nil {
+		*r = PinRef(strconv.Itoa(n))
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("pin must be a GPIO number or a board/pin string")
+	}
+
+	*r = PinRef(s)
+	return nil
+}
+
+// MarshalJSON writes a pin of the native board as a number, so configs are
+// written back as they were read
+func (r PinRef) MarshalJSON() ([]byte, error) {
+	if n, err := strconv.Atoi(string(r)); err == nil {
+		return json.Marshal(n)
+	}
+
+	return json.Marshal(string(r))
+}
+
+// isNative returns true if board names the native header
+func isNative(board string) bool {
+	return board == "" || board == nativeBoard
+}
+
+// boardName returns the name of board as reported by the API
+func boardName(board string) string {
+	if isNative(board) {
+		return nativeBoard
+	}
+
+	return board
+}
+
+// pinID returns the id of pin number n of board in the API, the bare number
+// for the native board and board/n otherwise
+func pinID(board string, n int) string {
+	if isNative(board) {
+		return strconv.Itoa(n)
+	}
+
+	return board + "/" + strconv.Itoa(n)
+}
+
+// pinLabel names pin number n of board in logs and errors
+func pinLabel(board string, n int) string {
+	if isNative(board) {
+		return fmt.Sprintf("GPIO%d", n)
+	}
+
+	return fmt.Sprintf("%s/GPIO%d", board, n)
+}
+
+// label names the pin in logs and errors
+func (pc PinConfig) label() string {
+	return pinLabel(pc.Board, pc.GPIO)
+}
+
+// validateBoards checks the configured boards have unique names and prefixes
+func (c *Config) validateBoards() error {
+	names := map[string]bool{}
+	prefixes := map[string]bool{}
+
+	for _, b := range c.Boards {
+		if b.Name == "" || isNative(b.Name) || strings.Contains(b.Name, "/") {
+			return fmt.Errorf("board name %q must not be empty, %s or contain /", b.Name, nativeBoard)
+		}
+
+		if names[b.Name] {
+			return fmt.Errorf("board %q is configured more than once", b.Name)
+		}
+		names[b.Name] = true
+
+		if b.Prefix == "" || prefixes[b.Prefix] {
+			return fmt.Errorf("board %q prefix %q must not be empty or used by another board", b.Name, b.Prefix)
+		}
+		prefixes[b.Prefix] = true
+	}
+
+	return nil
+}
+
+// board returns the index of the configured board called name
+func (c *Config) board(name string) (int, bool) {
+	for i, b := range c.Boards {
+		if b.Name == name {
+			return i, true
+		}
+	}
+
+	return 0, false
+}
+
+// key returns the number pin number n of board is keyed by, see boardStride
+func (c *Config) key(board string, n int) (int, error) {
+	if isNative(board) {
+		return n, nil
+	}
+
+	i, ok := c.board(board)
+	if !ok {
+		return 0, fmt.Errorf("unknown board %q", board)
+	}
+
+	if n < 0 || n >= boardStride {
+		return 0, fmt.Errorf("pin %d of board %q must be between 0 and %d", n, board, boardStride-1)
+	}
+
+	return (i+1)*boardStride + n, nil
+}
+
+// resolve returns the number a pin is keyed by and its label, r must be the
+// GPIO number of a native pin or board/pin
+func (c *Config) resolve(r PinRef) (int, string, error) {
+	board, pin, ok := strings.Cut(string(r), "/")
+	if !ok {
+		board, pin = "", string(r)
+	}
+
+	n, err := strconv.Atoi(pin)
+	if err != nil {
+		return 0, "", fmt.Errorf("pin %q must be a GPIO number or board/pin", r)
+	}
+
+	key, err := c.key(board, n)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return key, pinLabel(board, n), nil
+}
+
+// registryName returns the name the pin is registered as in the gpio registry
+func (c *Config) registryName(pc PinConfig) string {
+	if i, ok := c.board(pc.Board); ok {
+		return c.Boards[i].Prefix + strconv.Itoa(pc.GPIO)
+	}
+
+	return strconv.Itoa(pc.GPIO)
+}
+
+// registerBoards registers simulatedBoardPins in memory pins for each
+// configured board in place of the driver of the expander, wrap returns the
+// pin to register for each. Pins already registered are left alone.
+func (c *Config) registerBoards(wrap func(p *gpiotest.Pin) gpio.PinIO) error {
+	for _, b := range c.Boards {
+		for n := 0; n < simulatedBoardPins; n++ {
+			name := b.Prefix + strconv.Itoa(n)
+			if gpioreg.ByName(name) != nil {
+				continue
+			}
+
+			p := wrap(&gpiotest.Pin{N: name, Num: n, EdgesChan: make(chan gpio.Level)})
+			if err := gpioreg.Register(p); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// lookupBoard implements Lookup for an id of the form board/pin, where pin is
+// the number or alias of a pin of board, m.mu must be held
+func (m *Manager) lookupBoard(board, pin string) (int, *PinCycle, error) {
+	for n, p := range m.pins {
+		if boardName(p.Board) != board {
+			continue
+		}
+
+		if strconv.Itoa(n%boardStride) == pin || (p.Alias != "" && p.Alias == pin) {
+			return n, p, nil
+		}
+	}
+
+	for _, e := range m.failed {
+		if boardName(e.Board) == board && (strconv.Itoa(e.GPIO) == pin || (e.Alias != "" && e.Alias == pin)) {
+			return 0, nil, e
+		}
+	}
+
+	return 0, nil, ErrUnknownPin
+}
+
+// pinPath joins a leading board and pin of parts, a path split at each /,
+// back into a single board/pin id
+func (m *Manager) pinPath(parts []string) []string {
+	if len(parts) < 2 || !m.isBoard(parts[0]) {
+		return parts
+	}
+
+	return append([]string{parts[0] + "/" + parts[1]}, parts[2:]...)
+}
+
+// isBoard returns true if name is rpi or the board of any configured pin
+func (m *Manager) isBoard(name string) bool {
+	if name == nativeBoard {
+		return true
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, p := range m.pins {
+		if p.Board == name {
+			return true
+		}
+	}
+
+	for _, e := range m.failed {
+		if e.Board == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ID returns the id of the pin keyed by n in the API, see pinID
+func (m *Manager) ID(n int) string {
+	if p, ok := m.Pin(n); ok {
+		return pinID(p.Board, n%boardStride)
+	}
+
+	return strconv.Itoa(n)
+}
+
+// Label names the pin keyed by n in logs, see pinLabel
+func (m *Manager) Label(n int) string {
+	if p, ok := m.Pin(n); ok {
+		return pinLabel(p.Board, n%boardStride)
+	}
+
+	return fmt.Sprintf("GPIO%d", n)
+}
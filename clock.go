@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// Clock is the source of time for PinCycle, Manager and Scheduler, replacing
+// the system clock lets tests drive their timing by hand
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks at intervals like time.Ticker
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// SystemClock is the Clock used when none is set
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+func (systemClock) NewTicker(d time.Duration) Ticker { return systemTicker{time.NewTicker(d)} }
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time { return t.Ticker.C }
+
+// clockOr returns c, or SystemClock when c is nil
+func clockOr(c Clock) Clock {
+	if c == nil {
+		return SystemClock
+	}
+
+	return c
+}
+
+// sleepClock pauses for d as measured by c, returning false if ctx is
+// cancelled first
+func sleepClock(ctx context.Context, c Clock, d time.Duration) bool {
+	select {
+	case <-c.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// withClockTimeout is context.WithTimeout with d measured by c
+func withClockTimeout(ctx context.Context, c Clock, d time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	after := c.After(d)
+
+	go func() {
+		select {
+		case <-after:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"periph.io/x/periph/conn/gpio"
+)
+
+// FakeClock is a Clock which only moves when Advance is called, so time based
+// behaviour can be checked instantly and deterministically
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+// fakeWaiter is a pending After or Ticker, period is zero for After
+type fakeWaiter struct {
+	at     time.Time
+	period time.Duration
+	c      chan time.Time
+}
+
+// NewFakeClock returns a FakeClock reading now
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now implements Clock
+func (f *FakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.now
+}
+
+// After implements Clock
+func (f *FakeClock) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w := &fakeWaiter{at: f.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		w.c <- f.now
+		return w.c
+	}
+
+	f.waiters = append(f.waiters, w)
+	return w.c
+}
+
+// NewTicker implements Clock, it panics if d is not positive as
+// time.NewTicker does
+func (f *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for FakeClock.NewTicker")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w := &fakeWaiter{at: f.now.Add(d), period: d, c: make(chan time.Time, 1)}
+	f.waiters = append(f.waiters, w)
+
+	return &fakeTicker{clock: f, w: w}
+}
+
+// Waiters returns the number of pending After calls and running tickers, so a
+// caller can wait for a goroutine to start sleeping before advancing
+func (f *FakeClock) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return len(f.waiters)
+}
+
+// Advance moves the clock forward by d, firing in order every After and tick
+// which falls due. As with time.Ticker a tick is dropped if the previous one
+// has not been received.
+func (f *FakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	end := f.now.Add(d)
+
+	for {
+		sort.SliceStable(f.waiters, func(i, j int) bool { return f.waiters[i].at.Before(f.waiters[j].at) })
+
+		if len(f.waiters) == 0 || f.waiters[0].at.After(end) {
+			break
+		}
+
+		w := f.waiters[0]
+		f.now = w.at
+
+		select {
+		case w.c <- f.now:
+		default:
+		}
+
+		if w.period > 0 {
+			w.at = w.at.Add(w.period)
+		} else {
+			f.waiters = f.waiters[1:]
+		}
+	}
+
+	f.now = end
+}
+
+// remove stops w from firing
+func (f *FakeClock) remove(w *fakeWaiter) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, o := range f.waiters {
+		if o == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+type fakeTicker struct {
+	clock *FakeClock
+	w     *fakeWaiter
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.w.c }
+
+func (t *fakeTicker) Stop() { t.clock.remove(t.w) }
+
+// waitForWaiters waits until n Afters and tickers are pending on c, so the
+// goroutines using it are asleep before it is advanced
+func waitForWaiters(t *testing.T, c *FakeClock, n int) {
+	t.Helper()
+
+	waitFor(t, "the clock to be waited on", func() bool { return c.Waiters() >= n })
+}
+
+func TestSchedulerFiresOnAdvance(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 10, 14, 6, 59, 0, 0, time.Local))
+	p := &fakePin{name: "GPIO14"}
+	f := &PinCycle{Pin: p, Clock: clock, MinInterval: time.Second, MaxInterval: time.Second}
+	m := NewManager(map[int]*PinCycle{14: f}, nil)
+
+	s, err := NewScheduler([]*Schedule{
+		{Spec: "0 7 * * *", Action: ScheduleOn, Target: "GPIO14", pins: []int{14}},
+		{Spec: "30 7 * * *", Action: ScheduleOff, Target: "GPIO14", pins: []int{14}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Clock = clock
+	s.drive(m)
+	s.Start()
+	defer s.Stop(t.Context())
+
+	waitForWaiters(t, clock, 1)
+	clock.Advance(59 * time.Second)
+	if mode, _ := f.State(); mode != ModeOff {
+		t.Fatalf("expected the pin to be off before 07:00, got %s", mode)
+	}
+
+	// the pin cycles on the fake clock too, so waits after its first write
+	clock.Advance(time.Second)
+	waitForWaiters(t, clock, 2)
+	if mode, l := f.State(); mode != ModeCycling || l != gpio.High {
+		t.Fatalf("expected the pin to be cycling and High at 07:00, got %s and %s", mode, l)
+	}
+
+	// each second of the fake clock is one flip
+	for i := 0; i < 3; i++ {
+		clock.Advance(time.Second)
+		waitForWaiters(t, clock, 2)
+	}
+
+	if flips := f.Flips(); flips != 4 {
+		t.Fatalf("expected 4 flips after 3 seconds, got %d", flips)
+	}
+
+	clock.Advance(30*time.Minute - 3*time.Second)
+	waitFor(t, "the pin to be turned off", func() bool { mode, _ := f.State(); return mode == ModeOff })
+
+	want := time.Date(2026, 10, 15, 7, 0, 0, 0, time.Local)
+	if next := s.Status()[0].Next; !next.Equal(want) {
+		t.Fatalf("expected the schedule to next fire at %s, got %s", want, next)
+	}
+}
+
+func TestRampLimitOnAdvance(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	pins := map[int]*PinCycle{}
+	for _, n := range []int{14, 15, 18} {
+		pins[n] = &PinCycle{Pin: &fakePin{name: pinLabel("", n)}, Clock: clock, MinInterval: time.Hour, MaxInterval: time.Hour}
+	}
+
+	m := NewManager(pins, nil)
+	m.Clock = clock
+	m.RampLimit = 1
+	m.RampWindow = time.Second
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.OnAll(t.Context(), 0)
+	}()
+	defer m.OffAll(t.Context())
+
+	running := func() int {
+		n := 0
+		for _, p := range pins {
+			if p.Running() {
+				n++
+			}
+		}
+
+		return n
+	}
+
+	// the first pin starts at once and the rest wait a window each, each
+	// running pin sleeps on the clock as does the ramp until the last pin
+	for want := 1; want < 3; want++ {
+		waitForWaiters(t, clock, want+1)
+		if n := running(); n != want {
+			t.Fatalf("expected %d pins to be running, got %d", want, n)
+		}
+
+		clock.Advance(time.Second)
+	}
+
+	<-done
+	if n := running(); n != 3 {
+		t.Fatalf("expected every pin to be running, got %d", n)
+	}
+}
+
+func TestSyncCycleOnAdvance(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	pins := []*PinCycle{}
+	for _, n := range []int{14, 15} {
+		pins = append(pins, &PinCycle{Pin: &fakePin{name: pinLabel("", n)}, Clock: clock})
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		SyncCycle(ctx, pins, time.Second)
+	}()
+
+	written := func(n int) bool {
+		for _, p := range pins {
+			if len(p.Pin.(*fakePin).Levels()) != n {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	// each tick writes every pin, then stopping turns them off
+	for writes := 1; writes <= 5; writes++ {
+		waitFor(t, "the pins to be written", func() bool { return written(writes) })
+		if writes < 5 {
+			clock.Advance(time.Second)
+		}
+	}
+
+	cancel()
+	<-done
+
+	for _, p := range pins {
+		want := []gpio.Level{gpio.High, gpio.Low, gpio.High, gpio.Low, gpio.High, gpio.Low}
+		if levels := p.Pin.(*fakePin).Levels(); !slices.Equal(levels, want) {
+			t.Fatalf("expected %s to be written %v, got %v", p.Pin.Name(), want, levels)
+		}
+	}
+}
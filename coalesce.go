@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultCoalesceWindow is the time during which rapid commands to the same
+// target are coalesced so only the latest is applied
+const DefaultCoalesceWindow = 50 * time.Millisecond
+
+// Coalescer applies the latest of the commands submitted within Window of the
+// first, so a client flipping a pin on and off rapidly results in a single
+// write rather than restarting the pin for every request
+type Coalescer struct {
+	Window time.Duration
+
+	mu      sync.Mutex
+	pending func()
+	gen     uint64
+	done    chan struct{}
+}
+
+// Do submits fn and blocks until it, or a command submitted after it, has
+// been applied. Commands it replaces are never run. If ctx is done first, fn
+// is withdrawn unless it has already been replaced and ctx.Err is returned.
+// With a zero Window fn runs immediately.
+func (c *Coalescer) Do(ctx context.Context, fn func()) error {
+	if c.Window <= 0 {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		fn()
+		return nil
+	}
+
+	c.mu.Lock()
+	c.pending = fn
+	c.gen++
+	gen := c.gen
+	if c.done == nil {
+		c.done = make(chan struct{})
+		time.AfterFunc(c.Window, c.flush)
+	}
+	done := c.done
+	c.mu.Unlock()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		c.mu.Lock()
+		if c.gen == gen && c.done == done {
+			c.pending = nil
+		}
+		c.mu.Unlock()
+
+		return ctx.Err()
+	}
+}
+
+// flush applies the pending command and releases everyone waiting for it
+func (c *Coalescer) flush() {
+	c.mu.Lock()
+	fn, done := c.pending, c.done
+	c.pending, c.done = nil, nil
+	c.mu.Unlock()
+
+	if fn != nil {
+		fn()
+	}
+	close(done)
+}
+
+// Discard drops the pending command without running it, anyone waiting for
+// it is released as if it had been replaced
+func (c *Coalescer) Discard() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pending = nil
+}
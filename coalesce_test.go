@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"periph.io/x/periph/conn/gpio"
+)
+
+func TestCoalesceAlternatingRequests(t *testing.T) {
+	tests := []struct {
+		name     string
+		requests int
+		mode     Mode
+	}{
+		{"ending off", 100, ModeOff},
+		{"ending on", 101, ModeCycling},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &fakePin{name: "GPIO14"}
+			f := &PinCycle{Pin: p, MinInterval: time.Millisecond, MaxInterval: time.Millisecond}
+			m := NewManager(map[int]*PinCycle{14: f}, nil)
+			a := NewAPI(m, nil, nil, nil)
+			a.CoalesceWindow = 20 * time.Millisecond
+			defer f.Stop(context.Background())
+
+			c := a.coalescer("mode")
+			codes := make([]int, tt.requests)
+
+			var wg sync.WaitGroup
+			for i := 0; i < tt.requests; i++ {
+				mode := "on"
+				if i%2 == 1 {
+					mode = "off"
+				}
+
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					rw := httptest.NewRecorder()
+					a.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/mode?mode="+mode, nil))
+					codes[i] = rw.Code
+				}()
+
+				// submit the requests in order, each replaces the last
+				waitFor(t, "the request to be submitted", func() bool {
+					c.mu.Lock()
+					defer c.mu.Unlock()
+
+					return c.gen == uint64(i+1)
+				})
+			}
+			wg.Wait()
+
+			for i, code := range codes {
+				if code != http.StatusOK {
+					t.Fatalf("request %d returned %d", i, code)
+				}
+			}
+
+			mode, _ := f.State()
+			if mode != tt.mode {
+				t.Fatalf("expected the pin to be %s after the last request, got %s", tt.mode, mode)
+			}
+
+			if tt.mode == ModeOff {
+				if levels := p.Levels(); len(levels) > 0 && levels[len(levels)-1] != gpio.Low {
+					t.Fatalf("expected the pin to be Low, got %v", levels)
+				}
+			}
+		})
+	}
+}
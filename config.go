@@ -0,0 +1,632 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"periph.io/x/periph/conn/gpio"
+	"periph.io/x/periph/conn/gpio/gpioreg"
+)
+
+// defaultPins are the BCM GPIO numbers used when no configuration is given
+var defaultPins = []int{14, 15, 18, 23, 24, 25}
+
+// Config describes the pins driven by the application
+type Config struct {
+	Pins   []PinConfig   `json:"pins"`
+	Inputs []InputConfig `json:"inputs,omitempty"`
+
+	// Boards are the GPIO expanders pins may be on besides the native
+	// header, see BoardConfig
+	Boards []BoardConfig `json:"boards,omitempty"`
+
+	// Groups maps a group name to its members, a pin may belong to more
+	// than one group
+	Groups map[string][]PinRef `json:"groups,omitempty"`
+
+	Schedules []ScheduleConfig `json:"schedules,omitempty"`
+
+	// StatusPin is the GPIO number of an LED showing the health of the
+	// server, see StatusLED. It must not be one of Pins.
+	StatusPin *int `json:"status_pin,omitempty"`
+}
+
+// PinConfig describes a single output pin
+type PinConfig struct {
+	// GPIO is the BCM GPIO number of the pin, or its number on Board
+	GPIO int `json:"gpio"`
+
+	// Board is the name of the board the pin is on, one of Boards, it
+	// defaults to rpi, the native header
+	Board string `json:"board,omitempty"`
+
+	// Alias is an optional unique name for the pin such as "porch", it can
+	// be used in place of the GPIO number in the API
+	Alias string `json:"alias,omitempty"`
+
+	// MinIntervalMS and MaxIntervalMS bound the time in milliseconds between
+	// flips when cycling, see PinCycle
+	MinIntervalMS int `json:"min_interval_ms,omitempty"`
+	MaxIntervalMS int `json:"max_interval_ms,omitempty"`
+
+	// Inverted is set for active-low wiring, see PinCycle
+	Inverted bool `json:"inverted,omitempty"`
+
+	// Pattern is how the pin blinks when cycling, random, steady, pulse or
+	// heartbeat, defaults to random
+	Pattern string `json:"pattern,omitempty"`
+
+	// MinWriteIntervalMS is the shortest time in milliseconds between
+	// changes of level, see PinCycle
+	MinWriteIntervalMS int `json:"min_write_interval_ms,omitempty"`
+
+	// MinOnTimeMS and MaxOnTimeMS are the shortest and longest times in
+	// milliseconds the pin stays on once turned on, see PinCycle
+	MinOnTimeMS int `json:"min_on_time_ms,omitempty"`
+	MaxOnTimeMS int `json:"max_on_time_ms,omitempty"`
+
+	// OffMode is what the pin is left as when stopped, low, high or input,
+	// defaults to low, see PinCycle
+	OffMode string `json:"off_mode,omitempty"`
+
+	// PWMFrequencyHz and PWMSteps override the -pwm-frequency and -pwm-steps
+	// flags for this pin, see PinCycle
+	PWMFrequencyHz int `json:"pwm_frequency_hz,omitempty"`
+	PWMSteps       int `json:"pwm_steps,omitempty"`
+
+	// InitialLevel is the logical level, low or high, the pin is first
+	// driven to when acquired at startup, where it stays until the first
+	// command. It defaults to stopping the pin as OffMode. Pull, up, down or
+	// none, is enabled before that first write on boards which support it,
+	// see PinCycle.acquire.
+	InitialLevel string `json:"initial_level,omitempty"`
+	Pull         string `json:"pull,omitempty"`
+
+	// Enabled set to false starts the pin disabled, every command for it is
+	// ignored until it is enabled, see Manager.Disable. Defaults to true.
+	Enabled *bool `json:"enabled,omitempty"`
+}
+
+// InputConfig describes a push button connected to an input pin which
+// toggles an output pin
+type InputConfig struct {
+	// GPIO is the BCM GPIO number of the input pin
+	GPIO int `json:"gpio"`
+
+	// Pull is the internal resistor to enable, up, down or none, defaults to
+	// up for a button connecting the pin to ground
+	Pull string `json:"pull,omitempty"`
+
+	// DebounceMS is the debounce window in milliseconds, see InputPin
+	DebounceMS int `json:"debounce_ms,omitempty"`
+
+	// Toggle is the output pin toggled by each press, its GPIO number or
+	// board/pin
+	Toggle PinRef `json:"toggle"`
+
+	// RawEvents publishes every edge before debouncing as well as the
+	// debounced presses and releases
+	RawEvents bool `json:"raw_events,omitempty"`
+}
+
+// ScheduleConfig describes a pin or group which is turned on or off at the
+// times matched by a cron expression
+type ScheduleConfig struct {
+	// Spec is a standard five field cron expression such as "30 18 * * *",
+	// evaluated in the local time zone of the host
+	Spec string `json:"spec"`
+
+	// Action is either on or off
+	Action string `json:"action"`
+
+	// Pin is the target pin, its GPIO number or board/pin, exactly one of
+	// Pin and Group must be set
+	Pin PinRef `json:"pin,omitempty"`
+
+	// Group is the name of the target group
+	Group string `json:"group,omitempty"`
+}
+
+// LoadConfig reads the configuration from the JSON file at path, when path is
+// empty the GPIO_PINS environment variable, a comma separated list of GPIO
+// numbers, is used and failing that the default pins. Pins which do not set
+// their own pattern or blink intervals take them from the environment, see
+// envDefaults.
+func LoadConfig(path string) (*Config, error) {
+	c, err := loadPins(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.envDefaults(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// loadPins implements LoadConfig without the environment defaults
+func loadPins(path string) (*Config, error) {
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open config file: %s", err)
+		}
+
+		if err := validateConfigSchema(b); err != nil {
+			return nil, fmt.Errorf("invalid config file %s: %s", path, err)
+		}
+
+		c := &Config{}
+		if err := json.Unmarshal(b, c); err != nil {
+			return nil, fmt.Errorf("unable to parse config file %s: %s", path, err)
+		}
+
+		return c, nil
+	}
+
+	if env := os.Getenv("GPIO_PINS"); env != "" {
+		c := &Config{}
+		for _, s := range strings.Split(env, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil {
+				return nil, fmt.Errorf("invalid pin %q in GPIO_PINS", s)
+			}
+
+			c.Pins = append(c.Pins, PinConfig{GPIO: n})
+		}
+
+		return c, nil
+	}
+
+	c := &Config{}
+	for _, n := range defaultPins {
+		c.Pins = append(c.Pins, PinConfig{GPIO: n})
+	}
+
+	return c, nil
+}
+
+// envDefaults sets the pattern and blink intervals of the pins which leave
+// them unset from the DEFAULT_PATTERN, BLINK_MIN_MS and BLINK_MAX_MS
+// environment variables. A setting in the config of a pin takes precedence
+// over the environment, which takes precedence over the built in defaults.
+// An invalid variable is an error naming it.
+func (c *Config) envDefaults() error {
+	pattern := os.Getenv("DEFAULT_PATTERN")
+	if _, err := ParsePattern(pattern); err != nil {
+		return fmt.Errorf("invalid DEFAULT_PATTERN: %s", err)
+	}
+
+	minMS, err := envMS("BLINK_MIN_MS")
+	if err != nil {
+		return err
+	}
+
+	maxMS, err := envMS("BLINK_MAX_MS")
+	if err != nil {
+		return err
+	}
+
+	if maxMS != 0 && maxMS < minMS {
+		return fmt.Errorf("invalid BLINK_MAX_MS %d, it is less than BLINK_MIN_MS %d", maxMS, minMS)
+	}
+
+	for i := range c.Pins {
+		pc := &c.Pins[i]
+
+		if pc.Pattern == "" {
+			pc.Pattern = pattern
+		}
+
+		// a pin setting either bound keeps the built in default for the
+		// other, so the pair stays consistent
+		if pc.MinIntervalMS == 0 && pc.MaxIntervalMS == 0 {
+			pc.MinIntervalMS = minMS
+			pc.MaxIntervalMS = maxMS
+		}
+	}
+
+	return nil
+}
+
+// envMS reads the environment variable key as a number of milliseconds, zero
+// when it is not set
+func envMS(key string) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return 0, nil
+	}
+
+	ms, err := strconv.Atoi(v)
+	if err != nil || ms < 0 {
+		return 0, fmt.Errorf("invalid %s %q, it must be a positive number of milliseconds", key, v)
+	}
+
+	return ms, nil
+}
+
+// PinError records a configured pin which could not be used
+type PinError struct {
+	GPIO  int
+	Board string
+	Alias string
+	Err   error
+
+	// n is the number the pin would be keyed by, see boardStride
+	n int
+}
+
+func (e *PinError) Error() string {
+	return fmt.Sprintf("pin %s is unavailable: %s", pinLabel(e.Board, e.GPIO), e.Err)
+}
+
+// Build resolves each configured pin through the gpio registry and turns it
+// off to check it can be driven, returning the PinCycles keyed by GPIO number
+// or, for the pins of other boards, as described by boardStride.
+// Pins which are missing on this host or fail to turn off are returned as
+// PinErrors so the remaining pins can still be used, an error is only
+// returned for an invalid config or when no pins are usable.
+func (c *Config) Build() (map[int]*PinCycle, []*PinError, error) {
+	if err := c.validatePins(); err != nil {
+		return nil, nil, err
+	}
+
+	pins := map[int]*PinCycle{}
+	failed := []*PinError{}
+
+	for _, pc := range c.Pins {
+		n, _ := c.key(pc.Board, pc.GPIO)
+
+		pin, err := c.build(pc)
+		if err != nil {
+			failed = append(failed, &PinError{GPIO: pc.GPIO, Board: pc.Board, Alias: pc.Alias, Err: err, n: n})
+			continue
+		}
+
+		pins[n] = pin
+	}
+
+	if len(pins) == 0 {
+		return nil, nil, fmt.Errorf("no usable pins: %s", failed[0])
+	}
+
+	return pins, failed, nil
+}
+
+// validatePins checks the configured pins without touching the hardware
+func (c *Config) validatePins() error {
+	if len(c.Pins) == 0 {
+		return fmt.Errorf("no pins configured")
+	}
+
+	if err := c.validateBoards(); err != nil {
+		return err
+	}
+
+	seen := map[int]bool{}
+	aliases := map[string]string{}
+
+	for _, pc := range c.Pins {
+		n, err := c.key(pc.Board, pc.GPIO)
+		if err != nil {
+			return fmt.Errorf("pin %s: %s", pc.label(), err)
+		}
+
+		if seen[n] {
+			return fmt.Errorf("pin %s is configured more than once", pc.label())
+		}
+		seen[n] = true
+
+		if pc.Alias != "" {
+			if other, ok := aliases[pc.Alias]; ok {
+				return fmt.Errorf("alias %q is used by both %s and %s", pc.Alias, other, pc.label())
+			}
+
+			if _, err := strconv.Atoi(pc.Alias); err == nil || strings.Contains(pc.Alias, "/") {
+				return fmt.Errorf("pin %s alias %q must not be a number or contain /", pc.label(), pc.Alias)
+			}
+
+			if _, ok := c.board(pc.Alias); ok || pc.Alias == nativeBoard {
+				return fmt.Errorf("pin %s alias %q must not be the name of a board", pc.label(), pc.Alias)
+			}
+
+			aliases[pc.Alias] = pc.label()
+		}
+
+		if pc.MinIntervalMS < 0 || pc.MaxIntervalMS < 0 {
+			return fmt.Errorf("pin %s has a negative interval", pc.label())
+		}
+
+		if pc.MaxIntervalMS != 0 && pc.MaxIntervalMS < pc.MinIntervalMS {
+			return fmt.Errorf("pin %s max_interval_ms is less than min_interval_ms", pc.label())
+		}
+
+		if pc.MinWriteIntervalMS < 0 {
+			return fmt.Errorf("pin %s has a negative min_write_interval_ms", pc.label())
+		}
+
+		if pc.MinOnTimeMS < 0 || pc.MaxOnTimeMS < 0 {
+			return fmt.Errorf("pin %s has a negative on time", pc.label())
+		}
+
+		if pc.MaxOnTimeMS != 0 && pc.MaxOnTimeMS <= pc.MinOnTimeMS {
+			return fmt.Errorf("pin %s max_on_time_ms must be greater than min_on_time_ms", pc.label())
+		}
+
+		off, err := ParseOffMode(pc.OffMode)
+		if err != nil {
+			return fmt.Errorf("pin %s: %s", pc.label(), err)
+		}
+
+		// the pin would be stopped again every max_on_time_ms
+		if off == OffHigh && pc.MaxOnTimeMS != 0 {
+			return fmt.Errorf("pin %s off_mode high can not be used with max_on_time_ms", pc.label())
+		}
+
+		if err := validPWM(pc.PWMFrequencyHz, pc.PWMSteps); err != nil {
+			return fmt.Errorf("pin %s: %s", pc.label(), err)
+		}
+
+		if _, _, err := parseInitialLevel(pc.InitialLevel); err != nil {
+			return fmt.Errorf("pin %s: %s", pc.label(), err)
+		}
+
+		if _, err := parsePull(pc.Pull, gpio.PullNoChange); err != nil {
+			return fmt.Errorf("pin %s: %s", pc.label(), err)
+		}
+
+		if _, err := ParsePattern(pc.Pattern); err != nil {
+			return fmt.Errorf("pin %s: %s", pc.label(), err)
+		}
+	}
+
+	return nil
+}
+
+// build resolves pc through the gpio registry, by its GPIO number or the
+// prefix of its board, and turns it off, or to its InitialLevel, to check it
+// can be driven, pc must have been validated
+func (c *Config) build(pc PinConfig) (*PinCycle, error) {
+	p := gpioreg.ByName(c.registryName(pc))
+	if p == nil {
+		return nil, fmt.Errorf("not available on this host")
+	}
+
+	pin := &PinCycle{Pin: p}
+	pc.apply(pin)
+
+	pattern, _ := ParsePattern(pc.Pattern)
+	pin.SetPattern(context.Background(), pattern)
+
+	pull, _ := parsePull(pc.Pull, gpio.PullNoChange)
+	l, set, _ := parseInitialLevel(pc.InitialLevel)
+	if err := pin.acquire(context.Background(), pull, l, set); err != nil {
+		return nil, err
+	}
+
+	return pin, nil
+}
+
+// apply sets the fields of p described by pc other than the pattern, which
+// must be set with SetPattern
+func (pc PinConfig) apply(p *PinCycle) {
+	p.Alias = pc.Alias
+	p.Board = pc.Board
+	p.MinInterval = time.Duration(pc.MinIntervalMS) * time.Millisecond
+	p.MaxInterval = time.Duration(pc.MaxIntervalMS) * time.Millisecond
+	p.Inverted = pc.Inverted
+	p.MinWriteInterval = time.Duration(pc.MinWriteIntervalMS) * time.Millisecond
+	p.MinOnTime = time.Duration(pc.MinOnTimeMS) * time.Millisecond
+	p.MaxOnTime = time.Duration(pc.MaxOnTimeMS) * time.Millisecond
+	p.OffMode, _ = ParseOffMode(pc.OffMode)
+	p.PWMFrequency = pc.PWMFrequencyHz
+	p.PWMSteps = pc.PWMSteps
+	p.disabled.Store(pc.Enabled != nil && !*pc.Enabled)
+}
+
+// configured returns true if the pin keyed by n is one of the configured
+// output pins, even if it could not be used
+func (c *Config) configured(n int) bool {
+	for _, pc := range c.Pins {
+		if k, err := c.key(pc.Board, pc.GPIO); err == nil && k == n {
+			return true
+		}
+	}
+
+	return false
+}
+
+// BuildInputs resolves each configured input pin, wiring it to toggle the
+// matching output pin of m
+func (c *Config) BuildInputs(m *Manager) ([]*InputPin, error) {
+	inputs := []*InputPin{}
+	seen := map[int]bool{}
+
+	for _, ic := range c.Inputs {
+		if _, ok := m.Pin(ic.GPIO); ok || seen[ic.GPIO] {
+			return nil, fmt.Errorf("input pin GPIO%d is configured more than once", ic.GPIO)
+		}
+		seen[ic.GPIO] = true
+
+		target, label, err := c.resolve(ic.Toggle)
+		if err != nil {
+			return nil, fmt.Errorf("input pin GPIO%d toggle: %s", ic.GPIO, err)
+		}
+
+		_, ok := m.Pin(target)
+		if !ok && c.configured(target) {
+			logger.Warn("Ignoring input pin which toggles an unavailable pin", "pin", fmt.Sprintf("GPIO%d", ic.GPIO), "toggle", label)
+			continue
+		}
+
+		if !ok {
+			return nil, fmt.Errorf("input pin GPIO%d toggles %s which is not a configured pin", ic.GPIO, label)
+		}
+
+		pull, err := parsePull(ic.Pull, gpio.PullUp)
+		if err != nil {
+			return nil, fmt.Errorf("input pin GPIO%d: %s", ic.GPIO, err)
+		}
+
+		if ic.DebounceMS < 0 {
+			return nil, fmt.Errorf("input pin GPIO%d has a negative debounce_ms", ic.GPIO)
+		}
+
+		p := gpioreg.ByName(strconv.Itoa(ic.GPIO))
+		if p == nil {
+			return nil, fmt.Errorf("input pin GPIO%d is not available on this host", ic.GPIO)
+		}
+
+		inputs = append(inputs, &InputPin{
+			Pin:      p,
+			Pull:     pull,
+			Debounce: time.Duration(ic.DebounceMS) * time.Millisecond,
+			OnPress:  func() { Toggle(m, target) },
+			Raw:      ic.RawEvents,
+		})
+	}
+
+	return inputs, nil
+}
+
+// BuildGroups validates the configured groups against the pins of m, members
+// which are configured but unavailable are left out of their groups
+func (c *Config) BuildGroups(m *Manager) (map[string][]int, error) {
+	groups := map[string][]int{}
+
+	for name, members := range c.Groups {
+		if name == "" || strings.Contains(name, "/") {
+			return nil, fmt.Errorf("group name %q must not be empty or contain /", name)
+		}
+
+		if len(members) == 0 {
+			return nil, fmt.Errorf("group %q has no pins", name)
+		}
+
+		groups[name] = []int{}
+
+		for _, r := range members {
+			n, label, err := c.resolve(r)
+			if err != nil {
+				return nil, fmt.Errorf("group %q: %s", name, err)
+			}
+
+			_, ok := m.Pin(n)
+			if !ok && c.configured(n) {
+				logger.Warn("Leaving unavailable pin out of group", "group", name, "pin", label)
+				continue
+			}
+
+			if !ok {
+				return nil, fmt.Errorf("group %q contains %s which is not a configured pin", name, label)
+			}
+
+			groups[name] = append(groups[name], n)
+		}
+	}
+
+	return groups, nil
+}
+
+// BuildSchedules resolves the target of each configured schedule against the
+// pins of m and groups and parses its cron spec
+func (c *Config) BuildSchedules(m *Manager, groups map[string][]int) (*Scheduler, error) {
+	schedules := []*Schedule{}
+
+	for _, sc := range c.Schedules {
+		if sc.Action != ScheduleOn && sc.Action != ScheduleOff {
+			return nil, fmt.Errorf("schedule %q has unknown action %q, expected on or off", sc.Spec, sc.Action)
+		}
+
+		s := &Schedule{Spec: sc.Spec, Action: sc.Action, manager: m}
+
+		switch {
+		case sc.Pin != "" && sc.Group != "":
+			return nil, fmt.Errorf("schedule %q must set only one of pin and group", sc.Spec)
+		case sc.Group != "":
+			members, ok := groups[sc.Group]
+			if !ok {
+				return nil, fmt.Errorf("schedule %q targets group %q which is not configured", sc.Spec, sc.Group)
+			}
+
+			s.pins = members
+			s.Target = sc.Group
+		default:
+			n, label, err := c.resolve(sc.Pin)
+			if err != nil {
+				return nil, fmt.Errorf("schedule %q: %s", sc.Spec, err)
+			}
+
+			_, ok := m.Pin(n)
+			if !ok && c.configured(n) {
+				logger.Warn("Ignoring schedule for an unavailable pin", "spec", sc.Spec, "pin", label)
+				continue
+			}
+
+			if !ok {
+				return nil, fmt.Errorf("schedule %q targets %s which is not a configured pin", sc.Spec, label)
+			}
+
+			s.pins = []int{n}
+			s.Target = label
+		}
+
+		schedules = append(schedules, s)
+	}
+
+	return NewScheduler(schedules)
+}
+
+// validateTargets checks the groups and schedules against the configured
+// pins without touching the hardware, every configured pin is taken to be
+// available
+func (c *Config) validateTargets() error {
+	pins := map[int]*PinCycle{}
+	for _, pc := range c.Pins {
+		n, _ := c.key(pc.Board, pc.GPIO)
+		pins[n] = &PinCycle{}
+	}
+
+	m := NewManager(pins, nil)
+
+	groups, err := c.BuildGroups(m)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.BuildSchedules(m, groups)
+	return err
+}
+
+// BuildStatus resolves the status pin, returning nil when none is configured
+// or it is not available on this host
+func (c *Config) BuildStatus() (*StatusLED, error) {
+	if c.StatusPin == nil {
+		return nil, nil
+	}
+
+	n := *c.StatusPin
+	if c.configured(n) {
+		return nil, fmt.Errorf("status pin GPIO%d is also configured as an output pin", n)
+	}
+
+	for _, ic := range c.Inputs {
+		if ic.GPIO == n {
+			return nil, fmt.Errorf("status pin GPIO%d is also configured as an input pin", n)
+		}
+	}
+
+	p := gpioreg.ByName(strconv.Itoa(n))
+	if p == nil {
+		logger.Warn("Status pin is not available on this host, continuing without it", "pin", fmt.Sprintf("GPIO%d", n))
+		return nil, nil
+	}
+
+	return NewStatusLED(&PinCycle{Pin: p}), nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// maxDesiredSize is the largest body accepted by PUT /pins/{id}
+const maxDesiredSize = 4 << 10
+
+// optional is a field of DesiredState which records whether it was present
+// in the body, Value is nil when it was null
+type optional[T any] struct {
+	Set   bool
+	Value *T
+}
+
+// UnmarshalJSON implements json.Unmarshaler, it is called for null as well
+func (o *optional[T]) UnmarshalJSON(b []byte) error {
+	o.Set = true
+	if string(b) == "null" {
+		return nil
+	}
+
+	o.Value = new(T)
+	return json.Unmarshal(b, o.Value)
+}
+
+// DesiredState is the body of PUT /pins/{id}, the state a pin is reconciled
+// to. A field which is omitted keeps its current value and one which is
+// null is reset to its default, off, the pattern of the config, full
+// brightness and the enabled setting of the config. State is off, cycling
+// or solid, a Brightness below 1 dims a solid pin and is rejected for any
+// other state, a cycling pin is always driven at full brightness. A pin
+// busy with something which ends on its own, such as a fade or a blink, is
+// taken to be in the state it ends in.
+type DesiredState struct {
+	State      optional[Mode]    `json:"state"`
+	Pattern    optional[Pattern] `json:"pattern"`
+	Brightness optional[float64] `json:"brightness"`
+	Enabled    optional[bool]    `json:"enabled"`
+}
+
+// pinConfig returns the config of the pin keyed by n, empty when there is no
+// config
+func (a *API) pinConfig(n int) PinConfig {
+	a.configMu.RLock()
+	defer a.configMu.RUnlock()
+
+	if a.config == nil {
+		return PinConfig{}
+	}
+
+	for _, pc := range a.config.Pins {
+		if k, err := a.config.key(pc.Board, pc.GPIO); err == nil && k == n {
+			return pc
+		}
+	}
+
+	return PinConfig{}
+}
+
+// handlePutPin handles PUT /pins/{id}, driving the pin only where it differs
+// from the DesiredState in the body so repeating a request changes nothing,
+// and replies with the resulting state of the pin
+func (a *API) handlePutPin(rw http.ResponseWriter, r *http.Request, n int, p *PinCycle) {
+	b, err := io.ReadAll(http.MaxBytesReader(rw, r.Body, maxDesiredSize))
+	if err != nil {
+		http.Error(rw, fmt.Sprintf("unable to read body: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var d DesiredState
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&d); err != nil {
+		http.Error(rw, fmt.Sprintf("body must be a JSON desired state: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	t, err := d.resolve(p, a.pinConfig(n))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	changed, err := a.reconcile(r.Context(), strconv.Itoa(n), p, t)
+	logger.InfoContext(r.Context(), "Desired state", "event", "desired", "pin", p.Pin.Name(), "state", t.state, "changed", changed)
+
+	if err != nil {
+		logger.ErrorContext(r.Context(), "Unable to reconcile pin", "event", "error", "pin", p.Pin.Name(), "error", err)
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(rw, r, http.StatusOK, a.manager.status(n, p))
+}
+
+// target is a DesiredState resolved against the current state of a pin
+type target struct {
+	state      Mode
+	pattern    Pattern
+	brightness float64
+	enabled    bool
+}
+
+// resolve fills the fields of d which were omitted from the current state of
+// p and those which were null from the defaults of pc, the config of p
+func (d DesiredState) resolve(p *PinCycle, pc PinConfig) (target, error) {
+	mode, brightness := p.settledMode()
+	t := target{state: mode, pattern: p.Pattern(), brightness: brightness, enabled: p.Enabled()}
+
+	if d.State.Set {
+		t.state = ModeOff
+		if d.State.Value != nil {
+			t.state = *d.State.Value
+		}
+
+		switch t.state {
+		case ModeOff, ModeCycling, ModeSolid:
+		default:
+			return t, fmt.Errorf("unknown state %q, expected off, cycling or solid", t.state)
+		}
+	}
+
+	if d.Pattern.Set {
+		name := pc.Pattern
+		if d.Pattern.Value != nil {
+			name = string(*d.Pattern.Value)
+		}
+
+		var err error
+		if t.pattern, err = ParsePattern(name); err != nil {
+			return t, err
+		}
+	}
+
+	if d.Brightness.Set {
+		t.brightness = 1
+		if d.Brightness.Value != nil {
+			t.brightness = *d.Brightness.Value
+		}
+
+		if t.brightness <= 0 || t.brightness > 1 {
+			return t, fmt.Errorf("brightness must be greater than 0 and at most 1, use state off to turn the pin off")
+		}
+
+	}
+
+	if t.brightness < 1 && t.state != ModeSolid {
+		return t, fmt.Errorf("brightness can only dim a solid pin, a %s pin is driven at full brightness", t.state)
+	}
+
+	if d.Enabled.Set {
+		t.enabled = pc.Enabled == nil || *pc.Enabled
+		if d.Enabled.Value != nil {
+			t.enabled = *d.Enabled.Value
+		}
+	}
+
+	if !t.enabled && t.state != ModeOff {
+		return t, fmt.Errorf("a disabled pin can only be off")
+	}
+
+	return t, nil
+}
+
+// settledMode returns the state of DesiredState the pin is in or heading to,
+// off, cycling or solid, along with the brightness it is held at. A fade is
+// reported as what it ends at, anything else which ends on its own, such as
+// a blink or a Morse message, as off. Unlike desiredMode a timed cycle is
+// cycling.
+func (f *PinCycle) settledMode() (Mode, float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.cancel == nil {
+		return ModeOff, 1
+	}
+
+	switch f.mode {
+	case ModeCycling, ModeSolid:
+		return f.mode, 1
+	case ModeDimmed:
+		return ModeSolid, f.duty
+	case ModeFading:
+		if f.fadeTo > 0 {
+			return ModeSolid, f.fadeTo
+		}
+	}
+
+	return ModeOff, 1
+}
+
+// reconcile drives p, the pin with the given id, to t where it differs,
+// returning true if anything had to be changed
+func (a *API) reconcile(ctx context.Context, id string, p *PinCycle, t target) (bool, error) {
+	changed := false
+
+	if t.enabled && !p.Enabled() {
+		if err := a.manager.Enable(ctx, id); err != nil {
+			return changed, err
+		}
+		changed = true
+	}
+
+	if t.pattern != p.Pattern() {
+		p.SetPattern(ctx, t.pattern)
+		a.manager.audit(ctx, p.Pin.Name(), "pattern "+string(t.pattern), nil)
+		changed = true
+	}
+
+	if !t.enabled {
+		if p.Enabled() {
+			return true, a.manager.Disable(ctx, id)
+		}
+
+		return changed, nil
+	}
+
+	// a fade or blink already heading to t is left to finish
+	mode, brightness := p.settledMode()
+
+	switch {
+	case t.state == ModeOff && mode != ModeOff:
+		return true, a.manager.Off(ctx, id)
+	case t.state == ModeCycling && mode != ModeCycling:
+		return true, a.manager.On(ctx, id, 0)
+	case t.state == ModeSolid && t.brightness == 1 && (mode != ModeSolid || brightness != 1):
+		return true, a.manager.Solid(ctx, id)
+	case t.state == ModeSolid && t.brightness < 1 && (mode != ModeSolid || brightness != t.brightness):
+		err := p.SetBrightness(ctx, t.brightness)
+		a.manager.audit(ctx, p.Pin.Name(), "brightness", err)
+		a.manager.hold(ctx, p)
+
+		return true, err
+	}
+
+	return changed, nil
+}
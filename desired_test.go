@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPutPinResolvesSettledState(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		setup func(f *PinCycle) error
+		body  string
+		code  int
+		mode  Mode
+	}{
+		{
+			name: "cycling can not be dimmed",
+			body: `{"state":"cycling","pattern":"heartbeat","brightness":0.5,"enabled":true}`,
+			code: http.StatusBadRequest,
+			mode: ModeOff,
+		},
+		{
+			name:  "a blink is left to finish",
+			setup: func(f *PinCycle) error { return f.Blink(ctx, 3, time.Second, time.Second) },
+			body:  `{"pattern":"heartbeat"}`,
+			code:  http.StatusOK,
+			mode:  ModeBlink,
+		},
+		{
+			name:  "a fade is taken to be at its target",
+			setup: func(f *PinCycle) error { return f.Fade(ctx, 0.5, time.Minute) },
+			body:  `{"brightness":0.5}`,
+			code:  http.StatusOK,
+			mode:  ModeFading,
+		},
+		{
+			name: "a fade out is taken to be off",
+			setup: func(f *PinCycle) error {
+				if err := f.SetBrightness(ctx, 1); err != nil {
+					return err
+				}
+
+				return f.Fade(ctx, 0, time.Minute)
+			},
+			body: `{"brightness":0.5}`,
+			code: http.StatusBadRequest,
+			mode: ModeFading,
+		},
+		{
+			name:  "dimmed is solid",
+			setup: func(f *PinCycle) error { return f.SetBrightness(ctx, 0.5) },
+			body:  `{"pattern":"pulse"}`,
+			code:  http.StatusOK,
+			mode:  ModeDimmed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// nothing which ends on its own does so while the clock is held
+			f := &PinCycle{Pin: &fakePin{name: "GPIO20"}, Clock: NewFakeClock(time.Now())}
+			m := NewManager(map[int]*PinCycle{20: f}, nil)
+			a := NewAPI(m, nil, nil, nil)
+			defer m.CloseQueues(ctx)
+			defer f.Stop(ctx)
+
+			if tt.setup != nil {
+				if err := tt.setup(f); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			rw := httptest.NewRecorder()
+			a.ServeHTTP(rw, httptest.NewRequest(http.MethodPut, "/pins/20", strings.NewReader(tt.body)))
+			if rw.Code != tt.code {
+				t.Fatalf("expected %d, got %d: %s", tt.code, rw.Code, rw.Body)
+			}
+
+			if mode, _ := f.State(); mode != tt.mode {
+				t.Fatalf("expected the pin to be %s, got %s", tt.mode, mode)
+			}
+		})
+	}
+}
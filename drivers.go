@@ -0,0 +1,72 @@
+package main
+
+import (
+	"periph.io/x/periph"
+)
+
+// Driver states reported by DriverStatus
+const (
+	DriverLoaded  = "loaded"
+	DriverSkipped = "skipped"
+	DriverFailed  = "failed"
+)
+
+// gpioDrivers are the periph drivers which provide the GPIO pins, at least
+// one must load for the server to be of any use
+var gpioDrivers = []string{"bcm283x-gpio", "sysfs-gpio"}
+
+// DriverStatus reports how a host driver fared when the GPIO backend was
+// initialised
+type DriverStatus struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+	Error string `json:"error,omitempty"`
+}
+
+// driverStatus flattens the result of host.Init, skipped drivers are those
+// which do not apply to this board
+func driverStatus(s *periph.State) []DriverStatus {
+	drivers := []DriverStatus{}
+
+	for _, d := range s.Loaded {
+		drivers = append(drivers, DriverStatus{Name: d.String(), State: DriverLoaded})
+	}
+
+	for _, f := range s.Skipped {
+		drivers = append(drivers, DriverStatus{Name: f.D.String(), State: DriverSkipped, Error: f.Err.Error()})
+	}
+
+	for _, f := range s.Failed {
+		drivers = append(drivers, DriverStatus{Name: f.D.String(), State: DriverFailed, Error: f.Err.Error()})
+	}
+
+	return drivers
+}
+
+// gpioLoaded returns true if one of the gpioDrivers loaded
+func gpioLoaded(drivers []DriverStatus) bool {
+	for _, d := range drivers {
+		for _, name := range gpioDrivers {
+			if d.Name == name && d.State == DriverLoaded {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// logDrivers logs the outcome of each driver, failures are only warnings as
+// drivers other than the gpioDrivers are not needed
+func logDrivers(drivers []DriverStatus) {
+	for _, d := range drivers {
+		switch d.State {
+		case DriverLoaded:
+			logger.Info("Loaded driver", "driver", d.Name)
+		case DriverSkipped:
+			logger.Debug("Skipped driver", "driver", d.Name, "reason", d.Error)
+		default:
+			logger.Warn("Driver failed to load", "driver", d.Name, "error", d.Error)
+		}
+	}
+}
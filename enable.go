@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+)
+
+// Enabled returns false while the pin is disabled, see Manager.Disable
+func (f *PinCycle) Enabled() bool {
+	return !f.disabled.Load()
+}
+
+// Disable stops the pin, drives it off and ignores every command for it
+// until it is enabled again, so an LED can be disconnected for maintenance
+// without stray commands driving the pin
+func (m *Manager) Disable(ctx context.Context, id string) error {
+	_, p, err := m.Lookup(id)
+	if err != nil {
+		return err
+	}
+
+	p.disabled.Store(true)
+	err = p.Stop(ctx)
+	m.audit(ctx, p.Pin.Name(), "disable", err)
+
+	return err
+}
+
+// Enable accepts commands for a disabled pin again, it is left off until the
+// next command
+func (m *Manager) Enable(ctx context.Context, id string) error {
+	_, p, err := m.Lookup(id)
+	if err != nil {
+		return err
+	}
+
+	p.disabled.Store(false)
+	m.audit(ctx, p.Pin.Name(), "enable", nil)
+
+	return nil
+}
+
+// ignored returns true if p is disabled, logging that the command action is
+// ignored
+func (m *Manager) ignored(ctx context.Context, p *PinCycle, action string) bool {
+	if p.Enabled() {
+		return false
+	}
+
+	logger.InfoContext(ctx, "Pin is disabled, ignoring command", "event", "disabled", "pin", p.Pin.Name(), "action", action)
+
+	return true
+}
+
+// enabledPins returns the pins which are not disabled, in order, for patterns
+// which drive several pins
+func enabledPins(pins []*PinCycle) []*PinCycle {
+	enabled := make([]*PinCycle, 0, len(pins))
+	for _, p := range pins {
+		if p.Enabled() {
+			enabled = append(enabled, p)
+		}
+	}
+
+	return enabled
+}
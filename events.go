@@ -0,0 +1,255 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// eventBufferSize is the number of events buffered for the bus, and by
+// default for each subscriber, before the Backpressure policy applies
+const eventBufferSize = 64
+
+// ErrTooManySubscribers is returned by Bus.Subscribe once the subscriber
+// limit has been reached
+var ErrTooManySubscribers = errors.New("too many subscribers")
+
+// Backpressure is what the Bus does with an event for a subscriber whose
+// buffer is full
+type Backpressure string
+
+// Backpressure policies, under either drop policy the subscriber keeps
+// receiving events but misses some
+const (
+	// DropOldest discards the oldest buffered event so the subscriber
+	// receives the most recent ones
+	DropOldest Backpressure = "drop-oldest"
+
+	// DropNewest discards the event being published
+	DropNewest Backpressure = "drop-newest"
+
+	// DisconnectSlow ends the subscription, closing its channel
+	DisconnectSlow Backpressure = "disconnect-slow"
+)
+
+// ParseBackpressure returns the Backpressure named s
+func ParseBackpressure(s string) (Backpressure, error) {
+	switch b := Backpressure(s); b {
+	case DropOldest, DropNewest, DisconnectSlow:
+		return b, nil
+	default:
+		return "", fmt.Errorf("unknown backpressure policy %q, expected drop-oldest, drop-newest or disconnect-slow", s)
+	}
+}
+
+// Event describes a change to the mode or level of a pin, or an edge seen on
+// an input pin
+type Event struct {
+	Time  time.Time `json:"time"`
+	Pin   string    `json:"pin"`
+	Mode  Mode      `json:"mode,omitempty"`
+	Level string    `json:"level"`
+
+	// Edge is EdgeRising or EdgeFalling for events from input pins, which
+	// have no mode. Raw is set for edges reported before debouncing.
+	Edge string `json:"edge,omitempty"`
+	Raw  bool   `json:"raw,omitempty"`
+
+	// Brightness is the duty cycle of an output pin, 1 or 0 when it is
+	// simply on or off
+	Brightness *float64 `json:"brightness,omitempty"`
+}
+
+// Bus fans events published by the pins out to subscribers such as
+// WebSocket clients. Publishing never blocks, a subscriber which falls
+// behind has the Backpressure policy applied to it rather than holding up
+// the pins or other subscribers.
+type Bus struct {
+	in     chan Event
+	max    int
+	buffer int
+	policy Backpressure
+
+	mu   sync.Mutex
+	subs map[chan Event]subscriber
+
+	// dropped counts the events discarded because the bus or a subscriber
+	// fell behind, disconnected the subscribers ended by DisconnectSlow
+	dropped      atomic.Uint64
+	disconnected atomic.Uint64
+
+	// full is set while Publish is dropping events, so a burst is logged
+	// once
+	full atomic.Bool
+}
+
+// subscriber is a subscription to a Bus
+type subscriber struct {
+	name string
+
+	// internal is set for the subscribers of the server itself, see
+	// SubscribeInternal
+	internal bool
+}
+
+// BusStats is the event bus as reported by /stats
+type BusStats struct {
+	Policy       Backpressure `json:"policy"`
+	Buffer       int          `json:"buffer"`
+	Subscribers  int          `json:"subscribers"`
+	Dropped      uint64       `json:"dropped"`
+	Disconnected uint64       `json:"disconnected"`
+}
+
+// NewBus creates a Bus allowing at most maxSubscribers concurrent
+// subscribers, zero means unlimited, each buffering buffer events before
+// policy applies
+func NewBus(maxSubscribers, buffer int, policy Backpressure) *Bus {
+	b := &Bus{
+		in:     make(chan Event, eventBufferSize),
+		max:    maxSubscribers,
+		buffer: buffer,
+		policy: policy,
+		subs:   map[chan Event]subscriber{},
+	}
+
+	go b.run()
+
+	return b
+}
+
+// Publish queues e for delivery to every subscriber, it is dropped and
+// counted if the bus is full
+func (b *Bus) Publish(e Event) {
+	select {
+	case b.in <- e:
+		if b.full.Load() {
+			b.full.Store(false)
+		}
+	default:
+		b.dropped.Add(1)
+		if !b.full.Swap(true) {
+			logger.Warn("Event bus is full, dropping events until it catches up", "event", "dropped", "buffer", eventBufferSize)
+		}
+	}
+}
+
+// Subscribe returns a channel receiving published events and a function to
+// cancel the subscription, name identifies the subscriber in logs. The
+// channel is closed if the subscriber is disconnected for falling behind.
+func (b *Bus) Subscribe(name string) (<-chan Event, func(), error) {
+	return b.subscribe(subscriber{name: name})
+}
+
+// SubscribeInternal subscribes as Subscribe does for a part of the server
+// such as MQTT or the state file, which must keep receiving events for as
+// long as it runs. It does not count towards the subscriber limit and is
+// never disconnected, under DisconnectSlow it loses its oldest events
+// instead.
+func (b *Bus) SubscribeInternal(name string) (<-chan Event, func()) {
+	ch, unsubscribe, _ := b.subscribe(subscriber{name: name, internal: true})
+	return ch, unsubscribe
+}
+
+func (b *Bus) subscribe(s subscriber) (<-chan Event, func(), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !s.internal && b.max > 0 && b.clients() >= b.max {
+		return nil, nil, ErrTooManySubscribers
+	}
+
+	ch := make(chan Event, b.buffer)
+	b.subs[ch] = s
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			delete(b.subs, ch)
+		})
+	}
+
+	return ch, unsubscribe, nil
+}
+
+// clients returns the number of subscribers which count towards the limit,
+// b.mu must be held
+func (b *Bus) clients() int {
+	n := 0
+	for _, s := range b.subs {
+		if !s.internal {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Stats returns the policy and counters of the bus
+func (b *Bus) Stats() BusStats {
+	b.mu.Lock()
+	subscribers := len(b.subs)
+	b.mu.Unlock()
+
+	return BusStats{
+		Policy:       b.policy,
+		Buffer:       b.buffer,
+		Subscribers:  subscribers,
+		Dropped:      b.dropped.Load(),
+		Disconnected: b.disconnected.Load(),
+	}
+}
+
+func (b *Bus) run() {
+	for e := range b.in {
+		b.mu.Lock()
+		for ch, s := range b.subs {
+			b.deliver(ch, s, e)
+		}
+		b.mu.Unlock()
+	}
+}
+
+// deliver sends e to the subscriber ch, applying the policy if its buffer is
+// full, b.mu must be held
+func (b *Bus) deliver(ch chan Event, s subscriber, e Event) {
+	policy := b.policy
+	if s.internal && policy == DisconnectSlow {
+		policy = DropOldest
+	}
+
+	for {
+		select {
+		case ch <- e:
+			return
+		default:
+		}
+
+		switch policy {
+		case DropOldest:
+			// only run sends so once one event is taken, or the subscriber
+			// takes one, there is room
+			select {
+			case <-ch:
+				b.dropped.Add(1)
+			default:
+			}
+
+			continue
+		case DisconnectSlow:
+			logger.Warn("Disconnecting event subscriber which is not keeping up", "event", "disconnect", "subscriber", s.name, "buffer", b.buffer)
+			delete(b.subs, ch)
+			close(ch)
+			b.disconnected.Add(1)
+		default:
+			b.dropped.Add(1)
+		}
+
+		return
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestBusBackpressure(t *testing.T) {
+	const events, buffer = 20, 4
+
+	tests := []struct {
+		policy       Backpressure
+		received     []string
+		dropped      uint64
+		disconnected uint64
+	}{
+		{DropNewest, []string{"0", "1", "2", "3"}, events - buffer, 0},
+		{DropOldest, []string{"16", "17", "18", "19"}, events - buffer, 0},
+		{DisconnectSlow, []string{"0", "1", "2", "3"}, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			b := NewBus(0, buffer, tt.policy)
+
+			fast, unsubscribe, err := b.Subscribe("fast")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer unsubscribe()
+
+			slow, unsubscribe, err := b.Subscribe("slow")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer unsubscribe()
+
+			// the fast subscriber takes each event before the next is
+			// published, the slow one takes none until the end
+			for i := 0; i < events; i++ {
+				b.Publish(Event{Pin: strconv.Itoa(i)})
+
+				select {
+				case e := <-fast:
+					if e.Pin != strconv.Itoa(i) {
+						t.Fatalf("expected the fast subscriber to receive event %d, got %s", i, e.Pin)
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("the fast subscriber did not receive event %d", i)
+				}
+			}
+
+			waitFor(t, "the policy to be applied", func() bool {
+				s := b.Stats()
+				return s.Dropped == tt.dropped && s.Disconnected == tt.disconnected
+			})
+
+			// the last delivery has completed once the bus is unlocked
+			b.mu.Lock()
+			b.mu.Unlock()
+
+			received := []string{}
+			for len(received) < buffer {
+				received = append(received, (<-slow).Pin)
+			}
+
+			if !slices.Equal(received, tt.received) {
+				t.Fatalf("expected the slow subscriber to receive %v, got %v", tt.received, received)
+			}
+
+			select {
+			case e, ok := <-slow:
+				if ok {
+					t.Fatalf("expected no more events for the slow subscriber, got %s", e.Pin)
+				}
+
+				if tt.policy != DisconnectSlow {
+					t.Fatal("expected the slow subscriber to stay subscribed")
+				}
+			default:
+				if tt.policy == DisconnectSlow {
+					t.Fatal("expected the slow subscriber to be disconnected")
+				}
+			}
+
+			want := 2 - int(tt.disconnected)
+			if s := b.Stats(); s.Policy != tt.policy || s.Buffer != buffer || s.Subscribers != want {
+				t.Fatalf("expected %s with %d subscribers, got %+v", tt.policy, want, s)
+			}
+		})
+	}
+}
+
+func TestBusInternalSubscriberIsNotDisconnected(t *testing.T) {
+	const buffer = 4
+
+	b := NewBus(1, buffer, DisconnectSlow)
+
+	internal, unsubscribe := b.SubscribeInternal("state")
+	defer unsubscribe()
+
+	// internal subscribers leave the limit to clients
+	_, unsubscribe, err := b.Subscribe("client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unsubscribe()
+
+	for i := 0; i < buffer*2; i++ {
+		b.Publish(Event{Pin: strconv.Itoa(i)})
+	}
+
+	waitFor(t, "the slow client to be disconnected", func() bool { return b.Stats().Disconnected == 1 })
+	waitFor(t, "the oldest events to be dropped", func() bool { return b.Stats().Dropped == buffer })
+
+	b.mu.Lock()
+	b.mu.Unlock()
+
+	received := []string{}
+	for len(received) < buffer {
+		e, ok := <-internal
+		if !ok {
+			t.Fatal("expected the internal subscriber to stay subscribed")
+		}
+
+		received = append(received, e.Pin)
+	}
+
+	if want := []string{"4", "5", "6", "7"}; !slices.Equal(received, want) {
+		t.Fatalf("expected the internal subscriber to receive %v, got %v", want, received)
+	}
+}
+
+func TestPublishCountsEventsDroppedByAFullBus(t *testing.T) {
+	b := NewBus(0, eventBufferSize, DropNewest)
+
+	// holding the bus stops it taking more than one event from its queue
+	b.mu.Lock()
+	for i := 0; i < eventBufferSize+5; i++ {
+		b.Publish(Event{Pin: strconv.Itoa(i)})
+	}
+	b.mu.Unlock()
+
+	if n := b.Stats().Dropped; n < 4 || n > 5 {
+		t.Fatalf("expected 4 or 5 events dropped by the full bus, got %d", n)
+	}
+}
@@ -1,37 +1,27 @@
 module github.com/nicholasjackson/pi-gpio-project
 
+go 1.25.0
+
 require (
-	9fans.net/go v0.0.0-20181112161441-237454027057 // indirect
-	github.com/alecthomas/gometalinter v2.0.11+incompatible // indirect
-	github.com/alecthomas/units v0.0.0-20151022065526-2efee857e7cf // indirect
-	github.com/cosiner/argv v0.0.0-20181111161405-36fdb9e0bb2d // indirect
-	github.com/davidrjenni/reftools v0.0.0-20180914123528-654d0ba4f96d // indirect
-	github.com/derekparker/delve v1.1.0 // indirect
-	github.com/fatih/gomodifytags v0.0.0-20180914191908-141225bf62b6 // indirect
-	github.com/fatih/motion v0.0.0-20180408211639-218875ebe238 // indirect
-	github.com/google/shlex v0.0.0-20181106134648-c34317bd91bf // indirect
-	github.com/josharian/impl v0.0.0-20180228163738-3d0f908298c4 // indirect
-	github.com/jstemmer/gotags v1.4.1 // indirect
-	github.com/kisielk/errcheck v1.1.0 // indirect
-	github.com/klauspost/asmfmt v1.2.0 // indirect
-	github.com/koron/iferr v0.0.0-20180615142939-bb332a3b1d91 // indirect
-	github.com/mattn/go-isatty v0.0.4 // indirect
-	github.com/mdempsky/gocode v0.0.0-20181127203757-525aa8bb282c // indirect
-	github.com/nicholasjackson/periph-gpio-simulator v0.4.0
-	github.com/nicksnyder/go-i18n v1.10.0 // indirect
-	github.com/pelletier/go-toml v1.2.0 // indirect
-	github.com/peterh/liner v1.1.0 // indirect
-	github.com/rogpeppe/godef v1.0.0 // indirect
-	github.com/sirupsen/logrus v1.2.0 // indirect
-	github.com/spf13/cobra v0.0.3 // indirect
-	github.com/spf13/pflag v1.0.3 // indirect
-	github.com/stamblerre/gocode v0.0.0-20181128172141-22843d89bc5a // indirect
-	github.com/zmb3/gogetdoc v0.0.0-20181120020305-71611d8dcf25 // indirect
-	golang.org/x/arch v0.0.0-20180920145803-b19384d3c130 // indirect
-	golang.org/x/lint v0.0.0-20181026193005-c67002cb31c3 // indirect
-	golang.org/x/tools v0.0.0-20181130052023-1c3d964395ce // indirect
-	gopkg.in/alecthomas/kingpin.v3-unstable v3.0.0-20180810215634-df19058c872c // indirect
-	gopkg.in/yaml.v2 v2.2.2 // indirect
-	honnef.co/go/tools v0.0.0-20180920025451-e3ad64cb4ed3 // indirect
+	github.com/eclipse/paho.mqtt.golang v1.5.1
+	github.com/gorilla/websocket v1.5.3
+	github.com/prometheus/client_golang v1.24.1
+	github.com/robfig/cron/v3 v3.0.1
+	google.golang.org/grpc v1.84.0
+	google.golang.org/protobuf v1.36.11
 	periph.io/x/periph v3.3.0+incompatible
 )
+
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
+	github.com/prometheus/client_model v0.6.2 // indirect
+	github.com/prometheus/common v0.70.1 // indirect
+	github.com/prometheus/procfs v0.21.1 // indirect
+	golang.org/x/net v0.57.0 // indirect
+	golang.org/x/sync v0.22.0 // indirect
+	golang.org/x/sys v0.47.0 // indirect
+	golang.org/x/text v0.40.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20260706201446-f0a921348800 // indirect
+)
@@ -0,0 +1,241 @@
+package main
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative pincontrol/pincontrol.proto
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/nicholasjackson/pi-gpio-project/pincontrol"
+)
+
+// GRPC serves the PinControl service, it drives the same pins as the API and
+// uses its auth token and coalescing
+type GRPC struct {
+	pincontrol.UnimplementedPinControlServer
+
+	api *API
+
+	// done is closed to end the event streams on shutdown, GracefulStop
+	// would otherwise wait for them forever
+	done chan struct{}
+}
+
+// NewGRPC creates a gRPC server for the pins of api
+func NewGRPC(api *API, opts ...grpc.ServerOption) (*grpc.Server, *GRPC) {
+	g := &GRPC{api: api, done: make(chan struct{})}
+
+	opts = append(opts, grpc.UnaryInterceptor(g.authorize))
+	s := grpc.NewServer(opts...)
+	pincontrol.RegisterPinControlServer(s, g)
+
+	return s, g
+}
+
+// Close ends the event streams so the server can be stopped gracefully
+func (g *GRPC) Close() {
+	close(g.done)
+}
+
+// authorize requires the API auth token, when set, for SetPin. As with HTTP
+// reads need no token.
+func (g *GRPC) authorize(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if g.api.AuthToken == "" || info.FullMethod != pincontrol.PinControl_SetPin_FullMethodName {
+		return handler(ctx, req)
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, h := range md.Get("authorization") {
+		if validBearer(h, g.api.AuthToken) {
+			return handler(ctx, req)
+		}
+	}
+
+	return nil, status.Error(codes.Unauthenticated, "unauthorized")
+}
+
+// SetPin implements pincontrol.PinControlServer
+func (g *GRPC) SetPin(ctx context.Context, req *pincontrol.SetPinRequest) (*pincontrol.PinStatus, error) {
+	n, p, err := g.api.manager.Lookup(req.GetPin())
+	if err != nil {
+		return nil, lookupError(err)
+	}
+
+	if req.GetDurationMs() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "duration_ms must not be negative")
+	}
+
+	id := strconv.Itoa(n)
+	m := g.api.manager
+
+	// authorize has already checked the token
+	identity, remote := "", ""
+	if g.api.AuthToken != "" {
+		identity = "token"
+	}
+	if pr, ok := peer.FromContext(ctx); ok {
+		remote = pr.Addr.String()
+	}
+	ctx = contextWithSource(ctx, SourceGRPC, identity, remote)
+
+	var apply func() error
+	var action string
+
+	switch req.GetAction() {
+	case pincontrol.Action_ACTION_ON:
+		action = "on"
+		apply = func() error {
+			return m.On(ctx, id, time.Duration(req.GetDurationMs())*time.Millisecond)
+		}
+	case pincontrol.Action_ACTION_OFF:
+		action = "off"
+		apply = func() error { return m.Off(ctx, id) }
+	case pincontrol.Action_ACTION_SOLID:
+		action = "solid"
+		apply = func() error { return m.Solid(ctx, id) }
+	default:
+		return nil, status.Error(codes.InvalidArgument, "action must be ACTION_ON, ACTION_OFF or ACTION_SOLID")
+	}
+
+	modeRequests.WithLabelValues(action).Inc()
+
+	cerr := g.api.coalescer("pin/"+id).Do(ctx, func() {
+		logger.Info("SetPin", "event", action, "pin", p.Pin.Name(), "source", "grpc")
+		err = apply()
+	})
+
+	if cerr != nil {
+		logger.Warn("Request cancelled before it was applied", "event", "cancelled", "pin", p.Pin.Name())
+		return nil, status.FromContextError(cerr).Err()
+	}
+
+	if err != nil {
+		logger.Error("Unable to set pin", "event", "error", "pin", p.Pin.Name(), "error", err)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return pinStatusProto(g.api.manager.status(n, p)), nil
+}
+
+// GetStatus implements pincontrol.PinControlServer
+func (g *GRPC) GetStatus(ctx context.Context, req *pincontrol.GetStatusRequest) (*pincontrol.GetStatusResponse, error) {
+	res := &pincontrol.GetStatusResponse{}
+
+	if req.GetPin() == "" {
+		for _, s := range g.api.manager.Status() {
+			res.Pins = append(res.Pins, pinStatusProto(s))
+		}
+
+		return res, nil
+	}
+
+	s, err := g.api.manager.Get(req.GetPin())
+	if err != nil {
+		return nil, lookupError(err)
+	}
+
+	res.Pins = append(res.Pins, pinStatusProto(s))
+	return res, nil
+}
+
+// StreamEvents implements pincontrol.PinControlServer, sending the same events
+// as /ws
+func (g *GRPC) StreamEvents(_ *pincontrol.StreamEventsRequest, stream pincontrol.PinControl_StreamEventsServer) error {
+	name := "grpc"
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		name += " " + p.Addr.String()
+	}
+
+	events, unsubscribe, err := g.api.events.Subscribe(name)
+	if err != nil {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	defer unsubscribe()
+
+	for _, p := range g.api.manager.Ordered() {
+		if err := stream.Send(eventProto(p.Event())); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "not keeping up with the events")
+			}
+
+			if err := stream.Send(eventProto(e)); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		case <-g.done:
+			return status.Error(codes.Unavailable, "server is shutting down")
+		}
+	}
+}
+
+// lookupError returns the status for an error looking up a pin, distinguishing
+// pins which are configured but failed to initialise
+func lookupError(err error) error {
+	var e *PinError
+	if errors.As(err, &e) {
+		return status.Error(codes.Unavailable, e.Error())
+	}
+
+	return status.Error(codes.NotFound, err.Error())
+}
+
+func pinStatusProto(s PinStatus) *pincontrol.PinStatus {
+	p := &pincontrol.PinStatus{
+		Gpio:       int32(s.GPIO),
+		Alias:      s.Alias,
+		Name:       s.Name,
+		Running:    s.Running,
+		Mode:       string(s.Mode),
+		Pattern:    string(s.Pattern),
+		Level:      s.Level,
+		Available:  s.Available,
+		Error:      s.Error,
+		Failures:   int32(s.Failures),
+		LastError:  s.LastError,
+		Brightness: s.Brightness,
+		Source:     s.Source,
+		Disabled:   s.Disabled,
+		Id:         s.ID,
+		Board:      s.Board,
+	}
+
+	if s.Info != nil {
+		p.Info = &pincontrol.PinInfo{
+			Number:             int32(s.Info.Number),
+			Function:           s.Info.Function,
+			SupportedFunctions: s.Info.SupportedFunctions,
+			Header:             s.Info.Header,
+			HeaderPin:          int32(s.Info.HeaderPin),
+		}
+	}
+
+	return p
+}
+
+func eventProto(e Event) *pincontrol.Event {
+	return &pincontrol.Event{
+		TimeUnixNano: e.Time.UnixNano(),
+		Pin:          e.Pin,
+		Mode:         string(e.Mode),
+		Level:        e.Level,
+		Edge:         e.Edge,
+		Raw:          e.Raw,
+		Brightness:   e.Brightness,
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"periph.io/x/periph/conn/gpio"
+	"periph.io/x/periph/conn/pin"
+	"periph.io/x/periph/conn/pin/pinreg"
+)
+
+// PinInfo is what the GPIO driver knows about a pin, fields it does not
+// report are left empty
+type PinInfo struct {
+	// Number is the logical pin number reported by the driver, normally the
+	// GPIO number
+	Number int `json:"number"`
+
+	// Function is what the pin is currently configured as, such as Out, and
+	// SupportedFunctions the functions the pin can be set to
+	Function           string   `json:"function,omitempty"`
+	SupportedFunctions []string `json:"supported_functions,omitempty"`
+
+	// Header and HeaderPin are the physical header and 1 based pin the GPIO
+	// is wired to, such as P1 pin 8 for GPIO14 on a Raspberry Pi. They are
+	// empty for pins not on a registered header, such as simulated pins.
+	Header    string `json:"header,omitempty"`
+	HeaderPin int    `json:"header_pin,omitempty"`
+}
+
+// pinInfo queries the driver of p for what it knows about the pin, the
+// optional periph interfaces are used when p implements them
+func pinInfo(n int, p Pin) PinInfo {
+	info := PinInfo{Number: n}
+
+	// pins are usually looked up by an alias, which only forwards pin.Pin
+	if r, ok := p.(gpio.RealPin); ok {
+		p = r.Real()
+	}
+
+	pp, ok := p.(pin.Pin)
+	if !ok {
+		return info
+	}
+
+	info.Number = pp.Number()
+	info.Function = pp.Function()
+
+	if f, ok := pp.(pin.PinFunc); ok {
+		if fn := f.Func(); fn != "" {
+			info.Function = string(fn)
+		}
+
+		for _, s := range f.SupportedFuncs() {
+			info.SupportedFunctions = append(info.SupportedFunctions, string(s))
+		}
+	}
+
+	info.Header, info.HeaderPin = pinreg.Position(pp)
+
+	return info
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"periph.io/x/periph/conn/gpio"
+)
+
+// parsePull returns the internal resistor named s, up, down or none, an empty
+// name is def
+func parsePull(s string, def gpio.Pull) (gpio.Pull, error) {
+	switch s {
+	case "":
+		return def, nil
+	case "up":
+		return gpio.PullUp, nil
+	case "down":
+		return gpio.PullDown, nil
+	case "none":
+		return gpio.Float, nil
+	default:
+		return def, fmt.Errorf("unknown pull %q, expected up, down or none", s)
+	}
+}
+
+// parseInitialLevel returns the logical level named s, low or high, false
+// for an empty name
+func parseInitialLevel(s string) (gpio.Level, bool, error) {
+	switch s {
+	case "":
+		return gpio.Low, false, nil
+	case "low":
+		return gpio.Low, true, nil
+	case "high":
+		return gpio.High, true, nil
+	default:
+		return gpio.Low, false, fmt.Errorf("unknown initial_level %q, expected low or high", s)
+	}
+}
+
+// acquire prepares a pin which has just been acquired, before any command or
+// pattern drives it. pull is enabled first, while the pin is still an input,
+// so it holds a defined level as the driver takes over. Whether pulls can be
+// set varies by board and driver, the sysfs driver can not, so a pull which
+// can not be set is logged and skipped. The pin is then driven to the
+// logical level l when set, or stopped as OffMode.
+func (f *PinCycle) acquire(ctx context.Context, pull gpio.Pull, l gpio.Level, set bool) error {
+	if pull != gpio.PullNoChange {
+		in, ok := f.Pin.(gpio.PinIn)
+		if !ok {
+			logger.Warn("Pin does not support a pull, continuing without it", "pin", f.Pin.Name(), "pull", pull.String())
+		} else if err := in.In(pull, gpio.NoEdge); err != nil {
+			logger.Warn("Unable to set pull, continuing without it", "pin", f.Pin.Name(), "pull", pull.String(), "error", err)
+		}
+	}
+
+	if !set {
+		return f.Stop(ctx)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.out(ctx, l); err != nil {
+		return err
+	}
+
+	f.level = l
+	f.notify()
+
+	return nil
+}
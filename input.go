@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"periph.io/x/periph/conn/gpio"
+)
+
+// DefaultDebounce is the time after a press or release during which further
+// edges are ignored, the level is read again once it ends
+const DefaultDebounce = 50 * time.Millisecond
+
+// Edges reported in the events of input pins
+const (
+	EdgeRising  = "rising"
+	EdgeFalling = "falling"
+)
+
+// edgePollInterval bounds how long Watch waits for an edge before checking
+// whether it has been cancelled
+const edgePollInterval = 100 * time.Millisecond
+
+// InputPin watches a GPIO input, such as a push button, and calls OnPress
+// once for each press. Each debounced press and release is published to
+// Events, when set.
+type InputPin struct {
+	Pin gpio.PinIO
+
+	// Pull is the internal resistor to enable, with gpio.PullUp a press is a
+	// falling edge as the button connects the pin to ground, otherwise it is
+	// a rising edge
+	Pull gpio.Pull
+
+	// Debounce is the time after a press or release during which further
+	// edges are ignored, zero uses DefaultDebounce
+	Debounce time.Duration
+
+	// OnPress is called from the watching goroutine for each press
+	OnPress func()
+
+	// Events receives an event for each debounced edge, and with Raw set for
+	// every edge before debouncing as well
+	Events *Bus
+	Raw    bool
+}
+
+// Watch configures the pin as an input and calls OnPress for each press in a
+// background goroutine until ctx is cancelled
+func (i *InputPin) Watch(ctx context.Context) error {
+	// both edges are watched so releases can be reported, with gpio.PullUp a
+	// press pulls the pin low
+	pressed := gpio.High
+	if i.Pull == gpio.PullUp {
+		pressed = gpio.Low
+	}
+
+	if err := i.Pin.In(i.Pull, gpio.BothEdges); err != nil {
+		return err
+	}
+
+	debounce := i.Debounce
+	if debounce == 0 {
+		debounce = DefaultDebounce
+	}
+
+	go func() {
+		var last time.Time
+		state := i.Pin.Read()
+
+		// settling is set when an edge arrived inside the debounce window,
+		// the level is read again once it ends so a quick release is not
+		// lost
+		settling := false
+
+		for ctx.Err() == nil {
+			wait := edgePollInterval
+			if settling {
+				wait = min(wait, max(time.Until(last.Add(debounce)), time.Millisecond))
+			}
+
+			edge := i.Pin.WaitForEdge(wait)
+			now := time.Now()
+			level := i.Pin.Read()
+
+			if edge && i.Raw {
+				i.publish(now, level, true)
+			}
+
+			// bounces either arrive within the window or leave the level
+			// where it was
+			if now.Sub(last) < debounce {
+				settling = settling || edge
+				continue
+			}
+
+			if !edge && !settling {
+				continue
+			}
+			settling = false
+
+			if level == state {
+				continue
+			}
+
+			last, state = now, level
+			i.publish(now, level, false)
+
+			if level == pressed {
+				i.OnPress()
+			}
+		}
+	}()
+
+	return nil
+}
+
+// publish sends an event for an edge which left the pin at level
+func (i *InputPin) publish(t time.Time, level gpio.Level, raw bool) {
+	if i.Events == nil {
+		return
+	}
+
+	edge := EdgeFalling
+	if level == gpio.High {
+		edge = EdgeRising
+	}
+
+	i.Events.Publish(Event{Time: t, Pin: i.Pin.Name(), Level: level.String(), Edge: edge, Raw: raw})
+}
+
+// Toggle stops pin n of m if it is running and starts it cycling otherwise
+func Toggle(m *Manager, n int) {
+	if err := m.Toggle(contextWithSource(context.Background(), SourceInput, "", ""), strconv.Itoa(n)); err != nil {
+		logger.Error("Unable to turn off pin", "event", "error", "pin", m.Label(n), "error", err)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"periph.io/x/periph/conn/gpio"
+)
+
+func TestInputDebounce(t *testing.T) {
+	const debounce = 20 * time.Millisecond
+
+	tests := []struct {
+		name    string
+		edges   [][]gpio.Level
+		presses int64
+		levels  []string
+	}{
+		{
+			// the release arrives inside the window of the press, so is
+			// only seen once the window ends
+			name:    "quick release",
+			edges:   [][]gpio.Level{{gpio.Low, gpio.High}, {gpio.Low}},
+			presses: 2,
+			levels:  []string{"Low", "High", "Low"},
+		},
+		{
+			name:    "bouncing press",
+			edges:   [][]gpio.Level{{gpio.Low, gpio.High, gpio.Low}, {gpio.High}},
+			presses: 1,
+			levels:  []string{"Low", "High"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			p := newTestPin("BUTTON")
+			events := NewBus(0, eventBufferSize, DropNewest)
+			ch, unsubscribe, err := events.Subscribe("test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer unsubscribe()
+
+			var presses atomic.Int64
+			i := &InputPin{Pin: p, Pull: gpio.PullUp, Debounce: debounce, OnPress: func() { presses.Add(1) }, Events: events}
+			if err := i.Watch(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			// each burst of edges arrives well inside the debounce window,
+			// the bursts well apart
+			for _, burst := range tt.edges {
+				for _, l := range burst {
+					p.EdgesChan <- l
+				}
+
+				time.Sleep(5 * debounce)
+			}
+
+			waitFor(t, "the presses", func() bool { return presses.Load() == tt.presses })
+
+			levels := []string{}
+			for len(levels) < len(tt.levels) {
+				select {
+				case e := <-ch:
+					levels = append(levels, e.Level)
+				case <-time.After(time.Second):
+					t.Fatalf("expected debounced levels %v, got %v", tt.levels, levels)
+				}
+			}
+
+			if !slices.Equal(levels, tt.levels) {
+				t.Fatalf("expected debounced levels %v, got %v", tt.levels, levels)
+			}
+
+			time.Sleep(2 * debounce)
+			if n := presses.Load(); n != tt.presses {
+				t.Fatalf("expected %d presses, got %d", tt.presses, n)
+			}
+		})
+	}
+}
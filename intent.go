@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Priority orders the sources which set the state of a pin. A pin follows
+// the highest priority source holding it, a command from a lower priority
+// source is remembered and applied once the higher one is released.
+type Priority int
+
+const (
+	// PriorityDefault is a pin no source holds, it is left off
+	PriorityDefault Priority = iota
+	PrioritySchedule
+
+	// PriorityManual is every command from the HTTP, gRPC and MQTT
+	// servers and the input pins
+	PriorityManual
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PrioritySchedule:
+		return "schedule"
+	case PriorityManual:
+		return "manual"
+	}
+
+	return "default"
+}
+
+// sourcePriority returns the priority of the source in ctx, operations with
+// no source, such as stopping the pins on shutdown, hold nothing
+func sourcePriority(ctx context.Context) Priority {
+	s, ok := ctx.Value(sourceKey{}).(auditSource)
+	switch {
+	case !ok || s.source == SourceSystem:
+		return PriorityDefault
+	case s.source == SourceSchedule:
+		return PrioritySchedule
+	}
+
+	return PriorityManual
+}
+
+// manualHold is a manual command holding a pin, when the command was only
+// for a while it is released once the clock of the Manager reaches the end
+// unless stop is closed first
+type manualHold struct {
+	stop chan struct{}
+}
+
+// cancel stops h from being released when it expires
+func (h *manualHold) cancel() {
+	if h.stop != nil {
+		close(h.stop)
+	}
+}
+
+// intend records that the source in ctx wants pin n in the state set by
+// action, ScheduleOn or ScheduleOff for a schedule, d is how long a manual
+// command lasts when not zero. It returns false if a higher priority source
+// holds the pin or it is disabled, in which case the command must not be
+// applied.
+func (m *Manager) intend(ctx context.Context, n int, action string, d time.Duration) bool {
+	if p, ok := m.Pin(n); ok && m.ignored(ctx, p, action) {
+		return false
+	}
+
+	m.intentMu.Lock()
+	defer m.intentMu.Unlock()
+
+	switch sourcePriority(ctx) {
+	case PriorityDefault:
+		return true
+	case PrioritySchedule:
+		if m.scheduled == nil {
+			m.scheduled = map[int]string{}
+		}
+		m.scheduled[n] = action
+
+		if m.held[n] != nil {
+			logger.InfoContext(ctx, "Pin is held by a manual command, the schedule applies once it is released", "event", "held", "pin", m.Label(n), "action", action)
+			return false
+		}
+
+		return true
+	}
+
+	if m.held == nil {
+		m.held = map[int]*manualHold{}
+	}
+
+	if h := m.held[n]; h != nil {
+		h.cancel()
+	}
+
+	h := &manualHold{}
+	if d > 0 {
+		h.stop = make(chan struct{})
+		after := m.clock().After(d)
+
+		go func() {
+			select {
+			case <-after:
+				m.expire(n, h)
+			case <-h.stop:
+			}
+		}()
+	}
+	m.held[n] = h
+
+	return true
+}
+
+// hold records a manual command which set pins without going through the
+// Manager, such as a pattern or a fade, so schedules leave them alone
+func (m *Manager) hold(ctx context.Context, pins ...*PinCycle) {
+	for _, p := range pins {
+		if n, ok := m.number(p); ok {
+			m.intend(ctx, n, "", 0)
+		}
+	}
+}
+
+// number returns the GPIO number of p
+func (m *Manager) number(p *PinCycle) (int, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for n, o := range m.pins {
+		if o == p {
+			return n, true
+		}
+	}
+
+	return 0, false
+}
+
+// expire releases h once the timed command it was for has finished
+func (m *Manager) expire(n int, h *manualHold) {
+	m.intentMu.Lock()
+	if m.held[n] != h {
+		m.intentMu.Unlock()
+		return
+	}
+
+	delete(m.held, n)
+	m.intentMu.Unlock()
+
+	if p, ok := m.Pin(n); ok {
+		m.revert(context.Background(), p, n)
+	}
+}
+
+// Release drops any manual command holding the pin and returns it to what
+// the schedules last asked for, or off if they have not. A pin which is not
+// held is left alone.
+func (m *Manager) Release(ctx context.Context, id string) error {
+	n, p, err := m.Lookup(id)
+	if err != nil {
+		return err
+	}
+
+	if !m.release(n) {
+		return nil
+	}
+
+	err = m.revert(ctx, p, n)
+	m.audit(ctx, p.Pin.Name(), "release", err)
+
+	return err
+}
+
+// ReleaseAll releases every pin, as Release
+func (m *Manager) ReleaseAll(ctx context.Context) error {
+	var errs []error
+
+	for n, p := range m.Pins() {
+		if !m.release(n) {
+			continue
+		}
+
+		if err := m.revert(ctx, p, n); err != nil {
+			logger.ErrorContext(ctx, "Unable to release pin", "event", "error", "pin", p.Pin.Name(), "error", err)
+			errs = append(errs, err)
+		}
+	}
+
+	err := errors.Join(errs...)
+	m.audit(ctx, "all", "release", err)
+
+	return err
+}
+
+// release drops the manual command holding pin n, returning false if there
+// was none
+func (m *Manager) release(n int) bool {
+	m.intentMu.Lock()
+	defer m.intentMu.Unlock()
+
+	h, ok := m.held[n]
+	if !ok {
+		return false
+	}
+
+	h.cancel()
+	delete(m.held, n)
+
+	return true
+}
+
+// revert applies to p, pin n, what the schedules last asked for
+func (m *Manager) revert(ctx context.Context, p *PinCycle, n int) error {
+	m.intentMu.Lock()
+	action := m.scheduled[n]
+	m.intentMu.Unlock()
+
+	logger.InfoContext(ctx, "Pin released", "event", "release", "pin", p.Pin.Name(), "source", m.source(n).String())
+
+	if action == ScheduleOn && p.Enabled() {
+		p.Cycle(ctx)
+		return nil
+	}
+
+	return p.Stop(ctx)
+}
+
+// source returns the priority of the source pin n follows
+func (m *Manager) source(n int) Priority {
+	m.intentMu.Lock()
+	defer m.intentMu.Unlock()
+
+	if m.held[n] != nil {
+		return PriorityManual
+	}
+
+	if _, ok := m.scheduled[n]; ok {
+		return PrioritySchedule
+	}
+
+	return PriorityDefault
+}
+
+// forget drops the commands for pins which are no longer configured, m.mu
+// must be held
+func (m *Manager) forget() {
+	m.intentMu.Lock()
+	defer m.intentMu.Unlock()
+
+	for n, h := range m.held {
+		if _, ok := m.pins[n]; ok {
+			continue
+		}
+
+		h.cancel()
+		delete(m.held, n)
+	}
+
+	for n := range m.scheduled {
+		if _, ok := m.pins[n]; !ok {
+			delete(m.scheduled, n)
+		}
+	}
+}
+
+// status is pinStatus including the source pin n follows
+func (m *Manager) status(n int, p *PinCycle) PinStatus {
+	s := pinStatus(n, p)
+	s.Source = m.source(n).String()
+
+	return s
+}
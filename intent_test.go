@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestScheduleDefersToTimedManualCommand(t *testing.T) {
+	tests := []struct {
+		name       string
+		schedule   string
+		mode       Mode
+		goroutines int
+	}{
+		{"no schedule", "", ModeOff, 0},
+		{"schedule on", ScheduleOn, ModeCycling, 1},
+		{"schedule off", ScheduleOff, ModeOff, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := NewFakeClock(time.Now())
+			f := &PinCycle{Pin: &fakePin{name: "GPIO14"}, Clock: clock, MinInterval: time.Hour, MaxInterval: time.Hour}
+			m := NewManager(map[int]*PinCycle{14: f}, nil)
+			m.Clock = clock
+			defer f.Stop(context.Background())
+
+			manual := contextWithSource(t.Context(), SourceHTTP, "", "")
+			scheduled := contextWithSource(t.Context(), SourceSchedule, "", "")
+
+			if err := m.On(manual, "14", 10*time.Minute); err != nil {
+				t.Fatal(err)
+			}
+
+			// the cycle, its timer and the hold all wait on the clock
+			waitForWaiters(t, clock, 3)
+
+			switch tt.schedule {
+			case ScheduleOn:
+				m.OnPins(scheduled, []int{14}, 0)
+			case ScheduleOff:
+				m.Off(scheduled, "14")
+			}
+
+			clock.Advance(10*time.Minute - time.Second)
+			if mode, _ := f.State(); mode != ModeCycling {
+				t.Fatalf("expected the manual command to hold the pin cycling, got %s", mode)
+			}
+
+			if source := m.source(14); source != PriorityManual {
+				t.Fatalf("expected the pin to follow the manual command, got %s", source)
+			}
+
+			// the schedule applies once the manual command has expired
+			clock.Advance(time.Second)
+			waitFor(t, "the manual command to expire", func() bool { return m.source(14) != PriorityManual })
+			waitFor(t, "the pin to follow the schedule", func() bool {
+				mode, _ := f.State()
+				return mode == tt.mode && f.Goroutines() == tt.goroutines
+			})
+		})
+	}
+}
+
+func TestReplacedManualCommandDoesNotExpire(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	f := &PinCycle{Pin: &fakePin{name: "GPIO14"}, Clock: clock, MinInterval: time.Hour, MaxInterval: time.Hour}
+	m := NewManager(map[int]*PinCycle{14: f}, nil)
+	m.Clock = clock
+	defer f.Stop(context.Background())
+
+	manual := contextWithSource(t.Context(), SourceHTTP, "", "")
+	m.On(manual, "14", time.Minute)
+	m.On(manual, "14", 0)
+
+	// a later command without a duration holds the pin indefinitely
+	waitForWaiters(t, clock, 1)
+	clock.Advance(time.Hour)
+
+	if source := m.source(14); source != PriorityManual {
+		t.Fatalf("expected the pin to still be held, got %s", source)
+	}
+}
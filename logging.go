@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// logger is the package logger, it is replaced in main once the -log-format
+// flag has been parsed
+var logger = newLogger("text", os.Stdout)
+
+// Log formats accepted by -log-format
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// Log outputs accepted by -log-output, any other value is a file path
+const (
+	LogOutputStdout = "stdout"
+	LogOutputStderr = "stderr"
+	LogOutputSyslog = "syslog"
+)
+
+// newLogger returns a logger writing to w in the given format
+func newLogger(format string, w io.Writer) *slog.Logger {
+	return slog.New(newHandler(format, w))
+}
+
+// newHandler returns a handler writing to w in the given format. Text output
+// keeps the microsecond timestamps of the original log.Lmicroseconds logger,
+// JSON output emits one object per event with a timestamp field.
+func newHandler(format string, w io.Writer) slog.Handler {
+	if format == LogFormatJSON {
+		return contextHandler{slog.NewJSONHandler(w, &slog.HandlerOptions{
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if len(groups) == 0 && a.Key == slog.TimeKey {
+					a.Key = "timestamp"
+				}
+				return a
+			},
+		})}
+	}
+
+	return contextHandler{slog.NewTextHandler(w, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.String(slog.TimeKey, a.Value.Time().Format("15:04:05.000000"))
+			}
+			return a
+		},
+	})}
+}
+
+// requestIDKey is the context key for the ID of the request being handled
+type requestIDKey struct{}
+
+// contextWithRequestID returns a copy of ctx carrying the request ID id
+func contextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// requestID returns the request ID carried by ctx, empty if there is none
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// contextHandler adds the request ID carried by the context of a record, so
+// lines logged with the Context methods while handling a request, or by a pin
+// the request started, can be matched to it
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := requestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// openLogger returns a logger in the given format writing to output, one of
+// the LogOutput values or a file path. For a file the returned function
+// reopens it so logrotate can move it aside, otherwise it is nil.
+func openLogger(format, output string) (*slog.Logger, func() error, error) {
+	switch output {
+	case "", LogOutputStdout:
+		return newLogger(format, os.Stdout), nil, nil
+	case LogOutputStderr:
+		return newLogger(format, os.Stderr), nil, nil
+	case LogOutputSyslog:
+		l, err := newSyslogLogger(format)
+		return l, nil, err
+	}
+
+	f := &logFile{path: output}
+	if err := f.Reopen(); err != nil {
+		return nil, nil, err
+	}
+
+	return newLogger(format, f), f.Reopen, nil
+}
+
+// logFile is a log file which can be reopened while in use
+type logFile struct {
+	path string
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+func (l *logFile) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.f.Write(p)
+}
+
+// Reopen opens path for appending, creating it if needed, and closes the
+// previous file once the new one is in place
+func (l *logFile) Reopen() error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	old := l.f
+	l.f = f
+	l.mu.Unlock()
+
+	if old != nil {
+		return old.Close()
+	}
+
+	return nil
+}
+
+// validLogFormat returns an error if format is not a known log format
+func validLogFormat(format string) error {
+	if format != LogFormatText && format != LogFormatJSON {
+		return fmt.Errorf("unknown log format %q, expected %s or %s", format, LogFormatText, LogFormatJSON)
+	}
+
+	return nil
+}
+
+// fatal logs msg at error level and exits
+func fatal(msg string, args ...interface{}) {
+	logger.Error(msg, args...)
+	os.Exit(1)
+}
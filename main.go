@@ -1,120 +1,549 @@
 package main
 
 import (
-	"log"
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
 	"math/rand"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
 	"time"
 
-	"periph.io/x/periph/host/rpi"
-	//"github.com/nicholasjackson/periph-gpio-simulator/host/rpi"
-	"periph.io/x/periph/conn/gpio"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"periph.io/x/periph/host"
+	"periph.io/x/periph/host/distro"
 )
 
-// Connect LEDs to
+// By default connect LEDs to
 // GPIO 14
 // GPIO 15
 // GPIO 18
 // GPIO 23
 // GPIO 24
 // GPIO 25
+//
+// Other pins can be used with the -config flag or GPIO_PINS environment
+// variable, see LoadConfig. DEFAULT_PATTERN, BLINK_MIN_MS and BLINK_MAX_MS
+// set how every pin blinks unless its config says otherwise. Run with
+// -simulate to develop without a Pi.
+
+var addr = flag.String("addr", envOrDefault("LISTEN_ADDR", ":9000"), "Address the HTTP server listens on, defaults to $LISTEN_ADDR")
+var configFile = flag.String("config", "", "Path to a JSON file describing the pins to drive")
+var shutdownTimeout = flag.Duration("shutdown-timeout", 5*time.Second, "Time allowed for pins and the HTTP server to stop on shutdown")
+var seed = flag.Int64("seed", 0, "Seed for the random blink timing, 0 seeds from the current time")
+var maxFailures = flag.Int("max-failures", 3, "Consecutive write failures after which a pin stops cycling, 0 never stops")
+
+var maxSubscribers = flag.Int("max-subscribers", 16, "Maximum number of concurrent event stream clients, 0 is unlimited")
+var eventBuffer = flag.Int("event-buffer", eventBufferSize, "Number of events buffered for each event stream client and MQTT before -event-backpressure applies")
+var eventBackpressure = flag.String("event-backpressure", string(DropNewest), "What happens to a subscriber which is not keeping up with the events, drop-oldest, drop-newest or disconnect-slow, which MQTT and the state file are exempt from")
+var logFormat = flag.String("log-format", LogFormatText, "Log output format, text or json")
+var logOutput = flag.String("log-output", LogOutputStdout, "Where logs are written, stdout, stderr, syslog or a file path which is reopened on SIGHUP")
+var legacyGETMode = flag.Bool("legacy-get-mode", true, "Accept the deprecated GET /?mode= form, this will default to false in the next release")
+var authToken = flag.String("auth-token", envOrDefault("AUTH_TOKEN", ""), "Bearer token required by requests which change pin state, defaults to $AUTH_TOKEN, empty disables auth")
+var tlsCert = flag.String("tls-cert", "", "Path to a PEM certificate, serves HTTPS when set along with -tls-key")
+var tlsKey = flag.String("tls-key", "", "Path to the PEM private key for -tls-cert")
+var stateFile = flag.String("state-file", "", "Path of a JSON file recording the state of each pin so it survives restarts, empty disables it")
+var noRestore = flag.Bool("no-restore", false, "Start with every pin off rather than restoring the -state-file")
+var mqttBroker = flag.String("mqtt-broker", envOrDefault("MQTT_BROKER", ""), "MQTT broker such as tcp://localhost:1883, defaults to $MQTT_BROKER, empty disables MQTT")
+var mqttPrefix = flag.String("mqtt-prefix", "pigpio", "Prefix of the MQTT topics and client ID")
+var mqttUsername = flag.String("mqtt-username", envOrDefault("MQTT_USERNAME", ""), "MQTT username, defaults to $MQTT_USERNAME")
+var mqttPassword = flag.String("mqtt-password", envOrDefault("MQTT_PASSWORD", ""), "MQTT password, defaults to $MQTT_PASSWORD")
+var coalesceWindow = flag.Duration("coalesce-window", DefaultCoalesceWindow, "Window within which rapid on and off requests for the same pins are coalesced so only the latest is applied, 0 disables it")
+var noAccessLog = flag.Bool("no-access-log", false, "Do not log each HTTP request")
+var readTimeout = flag.Duration("read-timeout", 10*time.Second, "Maximum time to read an HTTP request including its body")
+var writeTimeout = flag.Duration("write-timeout", 30*time.Second, "Maximum time to handle an HTTP request and write the response, WebSocket and /events streams are not affected")
+var idleTimeout = flag.Duration("idle-timeout", 2*time.Minute, "Maximum time an idle keep-alive connection is kept open")
+var selfTest = flag.Bool("selftest", false, "Light each pin in turn at startup to check the wiring, exiting if a pin can not be driven")
+var auditFile = flag.String("audit-file", "", "File every operation on the pins is appended to as JSON lines, empty keeps only the most recent operations in memory for /audit")
+var recordingsDir = flag.String("recordings-dir", ".", "Directory recordings are written to by /record/start and replayed from by /replay")
+var statusPin = flag.Int("status-pin", -1, "GPIO number of an LED showing server health, overrides status_pin in the config file, -1 uses the config file")
+var grpcAddr = flag.String("grpc-addr", "", "Address the gRPC PinControl server listens on such as :9001, empty disables it")
+var pwmFrequency = flag.Int("pwm-frequency", DefaultPWMFrequency, "Software PWM carrier frequency in Hz used for dimming and fades, higher reduces flicker at the cost of CPU")
+var pwmSteps = flag.Int("pwm-steps", DefaultPWMSteps, "Number of distinct software PWM duty cycles, higher gives smoother fades")
+var basePath = flag.String("base-path", "", "Path prefix such as /pigpio the server is mounted at behind a reverse proxy, it is stripped before routing")
+var rampLimit = flag.Int("ramp-limit", 0, "Most pins turned on within each -ramp-window when every pin or a group is turned on, limiting power supply sag, further pins wait their turn, 0 is unlimited")
+var rampWindow = flag.Duration("ramp-window", 50*time.Millisecond, "Window -ramp-limit applies to")
+var watchdogTimeout = flag.Duration("watchdog-timeout", 0, "Force off a pin whose goroutine has stalled without writing to it for this long, 0 disables the watchdog")
+var stagger = flag.Duration("stagger", 0, "Delay between starting each pin when every pin is turned on at once, spreading the current draw, 0 starts them together")
+var startupDelay = flag.Duration("startup-delay", 0, "Time to wait at startup before driving any pin")
+var corsOrigins = flag.String("cors-origins", "", "Comma separated origins such as http://localhost:5173 allowed to call the API from a browser, * allows any, empty allows none")
+var validate = flag.Bool("validate", false, "Check the config file and print a summary of it without loading the host drivers or driving any pin, exiting non-zero if it is invalid")
+var simulate = flag.Bool("simulate", runtime.GOOS != "linux", "Use simulated pins which log writes instead of driving the GPIO hardware, defaults to true when not running on Linux")
 
 func main() {
-	logger := log.New(os.Stdout, "", log.Lmicroseconds)
-	logger.Println("Hello World")
+	flag.Parse()
+
+	if err := validLogFormat(*logFormat); err != nil {
+		fatal("Invalid flag", "error", err)
+	}
+
+	l, reopenLog, err := openLogger(*logFormat, *logOutput)
+	if err != nil {
+		fatal("Unable to open log output", "output", *logOutput, "error", err)
+	}
+	logger = l
+
+	// SIGHUP reloads the config, and reopens the log file for logrotate which
+	// moves it aside first. A SIGHUP during startup is handled once the API
+	// is running.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	if *pwmFrequency <= 0 || *pwmSteps <= 0 {
+		fatal("Invalid flag", "error", "-pwm-frequency and -pwm-steps must be greater than 0")
+	}
+
+	if err := validPWM(*pwmFrequency, *pwmSteps); err != nil {
+		fatal("Invalid flag", "error", err)
+	}
+
+	if *stagger < 0 || *startupDelay < 0 {
+		fatal("Invalid flag", "error", "-stagger and -startup-delay must not be negative")
+	}
+
+	if *rampLimit < 0 || *rampWindow <= 0 {
+		fatal("Invalid flag", "error", "-ramp-limit must not be negative and -ramp-window must be greater than 0")
+	}
+
+	if *watchdogTimeout < 0 {
+		fatal("Invalid flag", "error", "-watchdog-timeout must not be negative")
+	}
+
+	backpressure, err := ParseBackpressure(*eventBackpressure)
+	if err != nil {
+		fatal("Invalid flag", "error", err)
+	}
+
+	if *eventBuffer <= 0 {
+		fatal("Invalid flag", "error", "-event-buffer must be greater than 0")
+	}
+
+	if (*tlsCert == "") != (*tlsKey == "") {
+		fatal("Invalid flag", "error", "-tls-cert and -tls-key must be set together")
+	}
+
+	if *validate {
+		if err := validateConfig(os.Stdout, *configFile, *statusPin); err != nil {
+			fatal("Invalid config", "file", *configFile, "error", err)
+		}
+
+		return
+	}
+
+	var tlsConfig *tls.Config
+	if *tlsCert != "" {
+		// load the key pair now so a bad file fails at startup rather than
+		// on the first connection
+		cert, err := tls.LoadX509KeyPair(*tlsCert, *tlsKey)
+		if err != nil {
+			fatal("Unable to load TLS certificate", "cert", *tlsCert, "key", *tlsKey, "error", err)
+		}
+
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	logger.Info("Hello World", "version", Version, "commit", Commit, "build_date", BuildDate, "go", runtime.Version(), "os", runtime.GOOS, "arch", runtime.GOARCH)
+
+	var drivers []DriverStatus
+	var timeline *Timeline
+	board := "simulator"
+	if *simulate {
+		logger.Info("Using GPIO backend", "backend", "simulator")
+		drivers = []DriverStatus{{Name: "simulator", State: DriverLoaded}}
+
+		var err error
+		if timeline, err = registerSimulator(); err != nil {
+			fatal("Unable to register simulated pins", "error", err)
+		}
+	} else {
+		logger.Info("Using GPIO backend", "backend", "hardware")
+
+		// Load all drivers, some may fail on boards they do not apply to
+		// which only matters if it leaves no way to drive the pins
+		state, err := host.Init()
+		if err != nil {
+			fatal("Unable to initialize host drivers", "error", err)
+		}
 
-	// Load all drivers:
-	if _, err := host.Init(); err != nil {
-		log.Fatal(err)
+		drivers = driverStatus(state)
+		logDrivers(drivers)
+
+		board = distro.DTModel()
+		logger.Info("Detected board", "board", board)
+
+		if !gpioLoaded(drivers) {
+			fatal("Unable to initialize host drivers", "error", "no GPIO driver loaded", "expected", gpioDrivers)
+		}
+	}
+
+	config, err := LoadConfig(*configFile)
+	if err != nil {
+		fatal("Unable to load config", "error", err)
 	}
 
-	p14 := PinCycle{
-		Pin:     rpi.SO_51,
-		Running: false,
+	if *statusPin >= 0 {
+		config.StatusPin = statusPin
 	}
 
-	p15 := PinCycle{
-		Pin:     rpi.SO_53,
-		Running: false,
+	if *simulate {
+		if err := simulateBoards(config, timeline); err != nil {
+			fatal("Unable to register simulated pins", "error", err)
+		}
 	}
 
-	p18 := PinCycle{
-		Pin:     rpi.SO_63,
-		Running: false,
+	if *startupDelay > 0 {
+		logger.Info("Waiting before driving the pins", "delay", startupDelay.String())
+		time.Sleep(*startupDelay)
 	}
 
-	p23 := PinCycle{
-		Pin:     rpi.SO_77,
-		Running: false,
+	pins, failed, err := config.Build()
+	if err != nil {
+		fatal("Invalid config", "error", err)
 	}
 
-	p24 := PinCycle{
-		Pin:     rpi.SO_81,
-		Running: false,
+	for _, f := range failed {
+		logger.Error("Pin unavailable, continuing without it", "event", "error", "pin", pinLabel(f.Board, f.GPIO), "error", f.Err)
 	}
 
-	p25 := PinCycle{
-		Pin:     rpi.SO_83,
-		Running: false,
+	manager := NewManager(pins, failed)
+	manager.Stagger = *stagger
+	manager.RampLimit = *rampLimit
+	manager.RampWindow = *rampWindow
+	manager.CoalesceWindow = *coalesceWindow
+	manager.Audit = NewAuditLog(*auditFile)
+
+	inputs, err := config.BuildInputs(manager)
+	if err != nil {
+		fatal("Invalid config", "error", err)
 	}
 
-	http.HandleFunc("/", func(rw http.ResponseWriter, r *http.Request) {
-		if r.URL.Query().Get("mode") == "on" {
-			logger.Println("On")
+	groups, err := config.BuildGroups(manager)
+	if err != nil {
+		fatal("Invalid config", "error", err)
+	}
+
+	scheduler, err := config.BuildSchedules(manager, groups)
+	if err != nil {
+		fatal("Invalid config", "error", err)
+	}
+
+	status, err := config.BuildStatus()
+	if err != nil {
+		fatal("Invalid config", "error", err)
+	}
+
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	logger.Info("Using random seed", "seed", *seed)
+
+	events := NewBus(*maxSubscribers, *eventBuffer, backpressure)
+
+	// setupPin applies the flags to a pin, here and for the pins a reload adds
+	// or changes
+	setupPin := func(n int, p *PinCycle) {
+		p.MaxFailures = *maxFailures
+		p.Events = events
+		// offset the seed by pin number so each pin has its own reproducible
+		// sequence regardless of map ordering
+		if p.Rand == nil {
+			p.Rand = rand.New(rand.NewSource(*seed + int64(n)))
+		}
+
+		if p.PWMFrequency == 0 {
+			p.PWMFrequency = *pwmFrequency
+		}
 
-			p14.Cycle()
-			p15.Cycle()
-			p18.Cycle()
-			p23.Cycle()
-			p24.Cycle()
-			p25.Cycle()
+		if p.PWMSteps == 0 {
+			p.PWMSteps = *pwmSteps
+		}
+
+		if status != nil {
+			name := p.Pin.Name()
+			p.OnFailed = func() { status.Fault("pin " + name + " stopped after repeated write failures") }
+		}
+	}
+
+	for n, p := range pins {
+		setupPin(n, p)
+	}
+
+	checkPWM(pins)
+
+	if status != nil {
+		logger.Info("Using status pin", "pin", status.Pin.Pin.Name())
+
+		if len(failed) > 0 {
+			status.Fault(fmt.Sprintf("%d configured pins are unavailable", len(failed)))
 		} else {
-			logger.Println("Off")
+			status.Healthy()
+		}
+	}
 
-			p14.Stop()
-			p15.Stop()
-			p18.Stop()
-			p23.Stop()
-			p24.Stop()
-			p25.Stop()
+	if *selfTest {
+		if err := SelfTest(context.Background(), enabledPins(manager.Ordered()), DefaultSelfTestHold); err != nil {
+			fatal("Self-test failed", "error", err)
 		}
-	})
+	}
 
-	http.ListenAndServe(":9000", nil)
+	stateCtx, stopState := context.WithCancel(context.Background())
+	defer stopState()
+
+	var stateSaved <-chan struct{}
+	if *stateFile != "" {
+		if !*noRestore {
+			restoreState(*stateFile, pins)
+		}
 
-	for {
+		stateSaved = persistState(stateCtx, *stateFile, manager, events)
 	}
-}
 
-type PinCycle struct {
-	Pin     gpio.PinIO
-	Running bool
-}
+	mqttCtx, stopMQTT := context.WithCancel(context.Background())
+	defer stopMQTT()
+
+	var mqttDone <-chan struct{}
+	if *mqttBroker != "" {
+		m := NewMQTT(*mqttBroker, *mqttPrefix, *mqttUsername, *mqttPassword, manager, events)
+		mqttDone = m.Start(mqttCtx)
+
+		logger.Info("Using MQTT broker", "broker", *mqttBroker, "prefix", *mqttPrefix)
+	}
+
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
+	go manager.WatchGoroutines(watchCtx, goroutineCheckInterval)
+	if *watchdogTimeout > 0 {
+		go manager.Watchdog(watchCtx, *watchdogTimeout)
+		logger.Info("Watchdog enabled", "timeout", watchdogTimeout.String())
+	}
+
+	inputCtx, stopInputs := context.WithCancel(context.Background())
+	defer stopInputs()
+
+	for _, i := range inputs {
+		i.Events = events
+		if err := i.Watch(inputCtx); err != nil {
+			fatal("Unable to watch input pin", "pin", i.Pin.Name(), "error", err)
+		}
+
+		logger.Info("Watching input pin", "pin", i.Pin.Name())
+	}
+
+	scheduler.Start()
+
+	api := NewAPI(manager, groups, scheduler, events)
+	api.AllowGETMode = *legacyGETMode
+	api.CoalesceWindow = *coalesceWindow
+	api.AuthToken = *authToken
+	api.RecordingsDir = *recordingsDir
+	api.Drivers = drivers
+	api.Build = buildInfo(board)
+	api.EnableReload(*configFile, config, setupPin)
+	if timeline != nil {
+		api.EnableSimulator(timeline)
+	}
+	if *authToken == "" {
+		logger.Warn("Authentication is disabled, anyone who can reach the server can control the pins, set -auth-token to enable it")
+	}
+
+	var handler http.Handler = api
+	if *basePath != "" {
+		if handler, err = withBasePath(*basePath, handler); err != nil {
+			fatal("Invalid flag", "error", err)
+		}
+	}
+
+	if handler, err = withCORS(strings.Split(*corsOrigins, ","), handler); err != nil {
+		fatal("Invalid flag", "error", err)
+	}
+
+	handler = recoverPanics(handler)
+	if !*noAccessLog {
+		handler = accessLog(handler)
+	}
+	handler = withRequestID(handler)
+
+	server := &http.Server{
+		Addr:         *addr,
+		Handler:      handler,
+		TLSConfig:    tlsConfig,
+		ReadTimeout:  *readTimeout,
+		WriteTimeout: *writeTimeout,
+		IdleTimeout:  *idleTimeout,
+	}
+	server.RegisterOnShutdown(api.CloseStreams)
+
+	ln, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		fatal("Unable to start HTTP server", "error", err)
+	}
 
-func (f *PinCycle) Cycle() {
 	go func() {
-		f.Running = true
-		state := gpio.High
+		var err error
+		if server.TLSConfig != nil {
+			logger.Info("Listening", "addr", ln.Addr().String(), "tls", true)
+			err = server.ServeTLS(ln, "", "")
+		} else {
+			logger.Info("Listening", "addr", ln.Addr().String())
+			err = server.Serve(ln)
+		}
+
+		if err != nil && err != http.ErrServerClosed {
+			fatal("Unable to start HTTP server", "error", err)
+		}
+	}()
 
-		for f.Running {
-			f.Pin.Out(state)
+	var grpcServer *grpc.Server
+	var grpcService *GRPC
+	if *grpcAddr != "" {
+		var opts []grpc.ServerOption
+		if tlsConfig != nil {
+			opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+		}
+
+		grpcServer, grpcService = NewGRPC(api, opts...)
 
-			sleepDuration := rand.Intn(1000-300) + 300
-			time.Sleep(time.Duration(sleepDuration) * time.Millisecond)
+		gln, err := net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			fatal("Unable to start gRPC server", "error", err)
+		}
 
-			// flip the state
-			if state == gpio.High {
-				state = gpio.Low
-			} else {
-				state = gpio.High
+		go func() {
+			logger.Info("Listening for gRPC", "addr", gln.Addr().String(), "tls", tlsConfig != nil)
+			if err := grpcServer.Serve(gln); err != nil {
+				fatal("Unable to start gRPC server", "error", err)
+			}
+		}()
+	}
+
+	// connections are accepted as soon as the listener is open
+	api.SetReady(true)
+
+	go func() {
+		for range hup {
+			if reopenLog != nil {
+				if err := reopenLog(); err != nil {
+					logger.Error("Unable to reopen log file", "event", "error", "output", *logOutput, "error", err)
+				} else {
+					logger.Info("Reopened log file", "output", *logOutput)
+				}
+			}
+
+			if err := api.Reload(); err != nil {
+				logger.Error("Unable to reload config, keeping the current one", "event", "error", "error", err)
 			}
 		}
 	}()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	logger.Info("Received signal, shutting down", "signal", (<-sig).String())
+	signal.Stop(hup)
+	api.SetReady(false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+
+	stopInputs()
+
+	// stop taking requests before the pins are turned off so a request
+	// still in flight can not turn them back on, Shutdown waits for those
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Error("Error shutting down HTTP server", "error", err)
+	}
+
+	if grpcServer != nil {
+		grpcService.Close()
+
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			logger.Warn("Timeout stopping gRPC server")
+			grpcServer.Stop()
+		}
+	}
+
+	if err := api.recorder.Stop(); err != nil && !errors.Is(err, ErrNotRecording) {
+		logger.Error("Unable to save recording", "event", "error", "error", err)
+	}
+
+	// stop saving before the pins are turned off so the state file keeps the
+	// state from before the shutdown
+	stopState()
+	if stateSaved != nil {
+		<-stateSaved
+	}
+
+	// stop the scheduler before the pins so a schedule can not turn them back
+	// on during shutdown
+	if err := api.StopSchedules(ctx); err != nil {
+		logger.Warn("Timeout waiting for schedules to complete")
+	}
+
+	// queued commands are dropped rather than applied after the pins are
+	// turned off
+	if err := manager.CloseQueues(ctx); err != nil {
+		logger.Warn("Timeout waiting for queued commands to complete")
+	}
+
+	// no reload can change the pins once the schedules are stopped, the
+	// pins a reload added are stopped and waited for along with the rest
+	running := manager.Ordered()
+
+	for _, p := range running {
+		if err := p.Stop(context.Background()); err != nil {
+			logger.Error("Unable to drive pin low", "event", "error", "pin", p.Pin.Name(), "error", err)
+			continue
+		}
+
+		logger.Info("Pin off", "event", "off", "pin", p.Pin.Name())
+	}
+
+	for _, p := range running {
+		if err := p.Wait(ctx); err != nil {
+			logger.Warn("Timeout waiting for pin to stop", "pin", p.Pin.Name())
+		}
+	}
+
+	if status != nil {
+		if err := status.Stop(); err != nil {
+			logger.Error("Unable to drive pin low", "event", "error", "pin", status.Pin.Pin.Name(), "error", err)
+		}
+	}
+
+	// after the pins so their final off state reaches the broker
+	stopMQTT()
+	if mqttDone != nil {
+		select {
+		case <-mqttDone:
+		case <-ctx.Done():
+			logger.Warn("Timeout disconnecting from MQTT broker")
+		}
+	}
+
+	manager.Audit.Close()
 }
 
-func (f *PinCycle) Stop() {
-	f.Running = false
-	f.Pin.Out(gpio.Low)
+// envOrDefault returns the value of the environment variable key or def when
+// it is not set
+func envOrDefault(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+
+	return def
 }
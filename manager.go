@@ -0,0 +1,465 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnknownPin is returned by Manager for an id which is not a configured
+// pin
+var ErrUnknownPin = errors.New("unknown pin")
+
+// Manager owns the configured pins and is the single entry point the HTTP,
+// gRPC and MQTT servers, the scheduler and the input pins use to drive them.
+// Pins are identified by id, either the GPIO number or the alias of a pin,
+// or board/pin for a pin of another board, see BoardConfig.
+// The values of the context passed to the methods, such as the request ID,
+// are carried into the pin for logging.
+// For pins which were configured but could not be initialised the methods
+// return their *PinError. Manual commands hold a pin against the schedules
+// until it is released, see Priority.
+type Manager struct {
+	// Stagger is the delay between starting each pin when OnAll turns every
+	// pin on, zero starts them together
+	Stagger time.Duration
+
+	// RampLimit, when not zero, is the most pins OnAll and OnPins start
+	// within any RampWindow, limiting the current drawn by pins turning on
+	// together. Further pins wait for a slot in the order they were asked
+	// for.
+	RampLimit  int
+	RampWindow time.Duration
+
+	// Audit, when set, records every operation made through the Manager
+	Audit *AuditLog
+
+	// Clock is the source of time for Stagger, the ramp limit, timed
+	// manual commands and the watchdogs, nil uses SystemClock
+	Clock Clock
+
+	// CoalesceWindow is how long a queued on, off or solid command waits
+	// for a later one to replace it, see CommandQueue
+	CoalesceWindow time.Duration
+
+	// mu guards the registry of pins, lookups hold it for reading and a
+	// reload replacing the pins holds it for writing. Each PinCycle guards
+	// its own state.
+	mu     sync.RWMutex
+	pins   map[int]*PinCycle
+	failed []*PinError
+
+	// startMu guards starting and cancelStart which cancels a staggered or
+	// ramp limited OnAll or OnPins still starting pins
+	startMu     sync.Mutex
+	starting    context.Context
+	cancelStart context.CancelFunc
+
+	// rampMu guards ramped, when each of the most recent RampLimit pins
+	// started, and is held while a pin waits for a slot so pins are started
+	// in order
+	rampMu sync.Mutex
+	ramped []time.Time
+
+	// intentMu guards held, the pins held by a manual command, and
+	// scheduled, what the schedules last asked of each pin. Pins follow
+	// held over scheduled, see Priority.
+	intentMu  sync.Mutex
+	held      map[int]*manualHold
+	scheduled map[int]string
+
+	// queueMu guards queues, the command queue of each pin keyed by GPIO
+	// number, and queuesClosed which is set on shutdown
+	queueMu      sync.Mutex
+	queues       map[int]*CommandQueue
+	queuesClosed bool
+}
+
+// NewManager creates a Manager for the pins keyed by their BCM GPIO number,
+// or as described by boardStride for the pins of other boards, failed are
+// the configured pins which could not be used
+func NewManager(pins map[int]*PinCycle, failed []*PinError) *Manager {
+	return &Manager{pins: pins, failed: failed}
+}
+
+// Lookup finds a pin by its GPIO number or alias, optionally prefixed by its
+// board and /
+func (m *Manager) Lookup(id string) (int, *PinCycle, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.lookup(id)
+}
+
+// lookup implements Lookup, m.mu must be held
+func (m *Manager) lookup(id string) (int, *PinCycle, error) {
+	if board, pin, ok := strings.Cut(id, "/"); ok {
+		return m.lookupBoard(board, pin)
+	}
+
+	if n, err := strconv.Atoi(id); err == nil {
+		if p, ok := m.pins[n]; ok {
+			return n, p, nil
+		}
+	} else {
+		for n, p := range m.pins {
+			if p.Alias != "" && p.Alias == id {
+				return n, p, nil
+			}
+		}
+	}
+
+	for _, e := range m.failed {
+		if strconv.Itoa(e.n) == id || (e.Alias != "" && e.Alias == id) {
+			return 0, nil, e
+		}
+	}
+
+	return 0, nil, ErrUnknownPin
+}
+
+// Pin returns the pin with GPIO number n
+func (m *Manager) Pin(n int) (*PinCycle, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	p, ok := m.pins[n]
+	return p, ok
+}
+
+// ByName finds the GPIO number of the pin whose Pin has the given name, as
+// found in events
+func (m *Manager) ByName(name string) (int, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for n, p := range m.pins {
+		if p.Pin.Name() == name {
+			return n, true
+		}
+	}
+
+	return 0, false
+}
+
+// Pins returns a copy of the pins keyed by GPIO number
+func (m *Manager) Pins() map[int]*PinCycle {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	pins := make(map[int]*PinCycle, len(m.pins))
+	for n, p := range m.pins {
+		pins[n] = p
+	}
+
+	return pins
+}
+
+// Ordered returns the pins in ascending GPIO order
+func (m *Manager) Ordered() []*PinCycle {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return sortedPins(m.pins)
+}
+
+// On starts the pin cycling, stopping it after d when d is not zero
+func (m *Manager) On(ctx context.Context, id string, d time.Duration) error {
+	n, p, err := m.Lookup(id)
+	if err != nil {
+		return err
+	}
+
+	if !m.intend(ctx, n, ScheduleOn, d) {
+		return nil
+	}
+
+	cycle(ctx, p, d)
+	m.audit(ctx, p.Pin.Name(), "on", nil)
+
+	return nil
+}
+
+// Solid turns the pin on without blinking
+func (m *Manager) Solid(ctx context.Context, id string) error {
+	n, p, err := m.Lookup(id)
+	if err != nil {
+		return err
+	}
+
+	if !m.intend(ctx, n, ScheduleOn, 0) {
+		return nil
+	}
+
+	err = p.On(ctx)
+	m.audit(ctx, p.Pin.Name(), "solid", err)
+
+	return err
+}
+
+// Off stops the pin and drives it low
+func (m *Manager) Off(ctx context.Context, id string) error {
+	n, p, err := m.Lookup(id)
+	if err != nil {
+		return err
+	}
+
+	if !m.intend(ctx, n, ScheduleOff, 0) {
+		return nil
+	}
+
+	err = p.Stop(ctx)
+	m.audit(ctx, p.Pin.Name(), "off", err)
+
+	return err
+}
+
+// Toggle stops the pin if it is on and starts it cycling otherwise
+func (m *Manager) Toggle(ctx context.Context, id string) error {
+	n, p, err := m.Lookup(id)
+	if err != nil {
+		return err
+	}
+
+	if !m.intend(ctx, n, "toggle", 0) {
+		return nil
+	}
+
+	err = p.Toggle(ctx)
+	m.audit(ctx, p.Pin.Name(), "toggle", err)
+
+	return err
+}
+
+// Reset clears the error state of the pin and checks it can be driven low
+func (m *Manager) Reset(ctx context.Context, id string) error {
+	_, p, err := m.Lookup(id)
+	if err != nil {
+		return err
+	}
+
+	err = p.Reset(ctx)
+	m.audit(ctx, p.Pin.Name(), "reset", err)
+
+	return err
+}
+
+// OnAll starts every pin cycling in GPIO order, stopping them after d when d
+// is not zero. With Stagger set it waits Stagger between pins, returning once
+// the last has started or OffAll or another OnAll cancels the rest.
+func (m *Manager) OnAll(ctx context.Context, d time.Duration) {
+	starting := m.restartStagger()
+	m.audit(ctx, "all", "on", nil)
+
+	pins := m.Pins()
+	started := 0
+	for _, n := range pinNumbers(pins) {
+		if !m.intend(ctx, n, ScheduleOn, d) {
+			continue
+		}
+
+		if started > 0 && m.Stagger > 0 && !sleepClock(starting, m.clock(), m.Stagger) {
+			return
+		}
+
+		if !m.ramp(starting) {
+			return
+		}
+
+		cycle(ctx, pins[n], d)
+		started++
+	}
+}
+
+// OnPins starts the pins with the GPIO numbers ns cycling in order, as for a
+// group, stopping them after d when d is not zero. Pins which are not
+// available are skipped. With RampLimit set it returns once the last has
+// started or OffAll or OnAll cancels the rest.
+func (m *Manager) OnPins(ctx context.Context, ns []int, d time.Duration) {
+	starting := m.startContext()
+
+	for _, n := range ns {
+		p, ok := m.Pin(n)
+		if !ok || !m.intend(ctx, n, ScheduleOn, d) {
+			continue
+		}
+
+		if !m.ramp(starting) {
+			return
+		}
+
+		cycle(ctx, p, d)
+		m.audit(ctx, p.Pin.Name(), "on", nil)
+	}
+}
+
+// ramp waits until another pin may start within RampLimit, returning false
+// if ctx is cancelled first
+func (m *Manager) ramp(ctx context.Context) bool {
+	if m.RampLimit <= 0 {
+		return true
+	}
+
+	m.rampMu.Lock()
+	defer m.rampMu.Unlock()
+
+	if len(m.ramped) == m.RampLimit {
+		if wait := m.ramped[0].Add(m.RampWindow).Sub(m.clock().Now()); wait > 0 && !sleepClock(ctx, m.clock(), wait) {
+			return false
+		}
+
+		m.ramped = m.ramped[1:]
+	}
+
+	m.ramped = append(m.ramped, m.clock().Now())
+
+	return true
+}
+
+// clock returns Clock or SystemClock when it is not set
+func (m *Manager) clock() Clock {
+	return clockOr(m.Clock)
+}
+
+// restartStagger cancels any staggered OnAll or OnPins still starting pins
+// and returns the context for a new one
+func (m *Manager) restartStagger() context.Context {
+	m.startMu.Lock()
+	defer m.startMu.Unlock()
+
+	if m.cancelStart != nil {
+		m.cancelStart()
+	}
+
+	m.starting, m.cancelStart = context.WithCancel(context.Background())
+
+	return m.starting
+}
+
+// startContext returns the context cancelled by the next OnAll or OffAll,
+// unlike restartStagger it leaves pins already being started alone
+func (m *Manager) startContext() context.Context {
+	m.startMu.Lock()
+	defer m.startMu.Unlock()
+
+	if m.starting == nil {
+		m.starting, m.cancelStart = context.WithCancel(context.Background())
+	}
+
+	return m.starting
+}
+
+// OffAll stops every pin, a pin which can not be driven low is logged and
+// does not prevent the rest being stopped
+func (m *Manager) OffAll(ctx context.Context) error {
+	m.restartStagger()
+
+	var errs []error
+
+	pins := m.Pins()
+	for _, n := range pinNumbers(pins) {
+		if !m.intend(ctx, n, ScheduleOff, 0) {
+			continue
+		}
+
+		p := pins[n]
+		if err := p.Stop(ctx); err != nil {
+			logger.ErrorContext(ctx, "Unable to drive pin low", "event", "error", "pin", p.Pin.Name(), "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", p.Pin.Name(), err))
+		}
+	}
+
+	err := errors.Join(errs...)
+	m.audit(ctx, "all", "off", err)
+
+	return err
+}
+
+// Goroutines returns the number of pin goroutines running across every pin
+func (m *Manager) Goroutines() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	n := 0
+	for _, p := range m.pins {
+		n += p.Goroutines()
+	}
+
+	return n
+}
+
+// goroutineCheckInterval is how often main checks for leaked pin goroutines
+const goroutineCheckInterval = 30 * time.Second
+
+// WatchGoroutines checks the number of pin goroutines every interval until
+// ctx is cancelled, warning if there are more than there are pins at two
+// checks in a row. Each pin runs at most one goroutine once the one it
+// replaced has exited, so more indicates a leak.
+func (m *Manager) WatchGoroutines(ctx context.Context, every time.Duration) {
+	t := m.clock().NewTicker(every)
+	defer t.Stop()
+
+	over := 0
+	for {
+		select {
+		case <-t.C():
+		case <-ctx.Done():
+			return
+		}
+
+		n, pins := m.Goroutines(), len(m.Pins())
+		if n <= pins {
+			over = 0
+			continue
+		}
+
+		over++
+		if over == 2 {
+			logger.Warn("More pin goroutines are running than there are pins, they may be leaking", "event", "leak", "goroutines", n, "pins", pins)
+		}
+	}
+}
+
+// Get returns the state of a single pin, including pins which could not be
+// initialised
+func (m *Manager) Get(id string) (PinStatus, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	n, p, err := m.lookup(id)
+
+	var pe *PinError
+	if errors.As(err, &pe) {
+		return failedStatus(pe), nil
+	}
+
+	if err != nil {
+		return PinStatus{}, err
+	}
+
+	return m.status(n, p), nil
+}
+
+// Status returns the state of every pin ordered by GPIO number
+func (m *Manager) Status() []PinStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	status := []PinStatus{}
+	for _, n := range pinNumbers(m.pins) {
+		status = append(status, m.status(n, m.pins[n]))
+	}
+
+	for _, e := range m.failed {
+		status = append(status, failedStatus(e))
+	}
+
+	sort.Slice(status, func(i, j int) bool { return status[i].n < status[j].n })
+
+	return status
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"periph.io/x/periph/conn/gpio"
+)
+
+func TestGoroutinesReturnToZero(t *testing.T) {
+	ctx := context.Background()
+	pins := map[int]*PinCycle{}
+	registered := map[int]*recordingPin{}
+	for _, n := range []int{50, 51, 52} {
+		p, io := registerTestPin(t, "TEST_GPIO"+strconv.Itoa(n), strconv.Itoa(n))
+		registered[n] = p
+		pins[n] = &PinCycle{Pin: io, MinInterval: time.Millisecond, MaxInterval: 2 * time.Millisecond}
+	}
+
+	m := NewManager(pins, nil)
+
+	var wg sync.WaitGroup
+	for n := range pins {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			id := strconv.Itoa(n)
+			for i := 0; i < 50; i++ {
+				m.On(ctx, id, 0)
+				m.Off(ctx, id)
+				m.Toggle(ctx, id)
+				m.On(ctx, id, time.Millisecond)
+				pins[n].SetBrightness(ctx, 0.5)
+				m.Toggle(ctx, id)
+			}
+		}()
+	}
+
+	for i := 0; i < 50; i++ {
+		m.OnAll(ctx, 0)
+		m.OffAll(ctx)
+	}
+	wg.Wait()
+
+	if err := m.OffAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "the pin goroutines to exit", func() bool { return m.Goroutines() == 0 })
+
+	for n, p := range registered {
+		if l := p.Read(); l != gpio.Low {
+			t.Fatalf("expected GPIO%d to be left Low, got %s", n, l)
+		}
+	}
+}
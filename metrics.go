@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	modeRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pigpio_mode_requests_total",
+		Help: "Number of requests to turn pins on or off, by mode.",
+	}, []string{"mode"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pigpio_http_request_duration_seconds",
+		Help:    "Latency of HTTP requests.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"code", "method"})
+
+	pinFlipsDesc = prometheus.NewDesc(
+		"pigpio_pin_flips_total",
+		"Number of times a cycling pin has changed level.",
+		[]string{"pin"}, nil,
+	)
+
+	pinsCyclingDesc = prometheus.NewDesc(
+		"pigpio_pins_cycling",
+		"Number of pins currently cycling.",
+		nil, nil,
+	)
+
+	pinGoroutinesDesc = prometheus.NewDesc(
+		"pigpio_pin_goroutines",
+		"Number of goroutines running for the pins.",
+		nil, nil,
+	)
+)
+
+// pinCollector reads the per pin metrics from the pins at scrape time
+type pinCollector struct {
+	api *API
+}
+
+func (c *pinCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- pinFlipsDesc
+	ch <- pinsCyclingDesc
+	ch <- pinGoroutinesDesc
+}
+
+func (c *pinCollector) Collect(ch chan<- prometheus.Metric) {
+	cycling := 0
+	for _, p := range c.api.manager.Ordered() {
+		ch <- prometheus.MustNewConstMetric(pinFlipsDesc, prometheus.CounterValue, float64(p.Flips()), p.Pin.Name())
+
+		if mode, _ := p.State(); mode == ModeCycling {
+			cycling++
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(pinsCyclingDesc, prometheus.GaugeValue, float64(cycling))
+	ch <- prometheus.MustNewConstMetric(pinGoroutinesDesc, prometheus.GaugeValue, float64(c.api.manager.Goroutines()))
+}
+
+// newMetricsHandler returns the handler for /metrics
+func newMetricsHandler(a *API) http.Handler {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		modeRequests,
+		httpDuration,
+		watchdogTrips,
+		&pinCollector{api: a},
+	)
+
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Hijack allows /ws to take over the connection through the recorder
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking is not supported")
+	}
+
+	s.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// accessLog logs the method, path, remote address, status and duration of
+// every request handled by next
+func accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: rw}
+
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		logger.InfoContext(r.Context(), "Request",
+			"event", "http",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"remote", r.RemoteAddr,
+			"status", rec.status,
+			"duration", time.Since(start).String(),
+		)
+	})
+}
+
+// recoverPanics replies 500 to a request whose handler panics, logging the
+// stack, rather than net/http dropping the connection.
+// http.ErrAbortHandler is passed on as it aborts a response deliberately.
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+
+			panicked(r.Context(), v, "method", r.Method, "path", r.URL.Path)
+			http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// maxRequestIDLength is the longest X-Request-ID accepted from a client
+const maxRequestIDLength = 64
+
+// withRequestID gives each request an ID, carried by its context for
+// logging and returned in the X-Request-ID header. An X-Request-ID sent by
+// the client, such as one set by a proxy, is used instead if it is valid.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		rw.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(rw, r.WithContext(contextWithRequestID(r.Context(), id)))
+	})
+}
+
+// newRequestID returns a short random ID
+func newRequestID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// validRequestID returns true if id is short and only contains characters
+// which are safe to log and echo back
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_.:", c)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// corsKey is the context key marking a request from an allowed CORS origin
+type corsKey struct{}
+
+// corsAllowed returns true if ctx is of a request from an allowed CORS
+// origin
+func corsAllowed(ctx context.Context) bool {
+	ok, _ := ctx.Value(corsKey{}).(bool)
+	return ok
+}
+
+// corsMaxAge is how long in seconds a browser may cache a preflight response
+const corsMaxAge = "600"
+
+// withCORS allows browsers on the given origins, such as
+// http://localhost:5173, to call next. Requests from other origins get no
+// CORS headers so the browser keeps them same-origin, an origin of * allows
+// any. Preflight OPTIONS requests are answered here without reaching next,
+// as browsers do not send the auth token with them.
+func withCORS(origins []string, next http.Handler) (http.Handler, error) {
+	allowed := map[string]bool{}
+	for _, o := range origins {
+		o = strings.TrimRight(strings.TrimSpace(o), "/")
+		if o == "" {
+			continue
+		}
+
+		if o != "*" && !strings.Contains(o, "://") {
+			return nil, fmt.Errorf("CORS origin %q must be * or include the scheme such as http://localhost:5173", o)
+		}
+
+		allowed[o] = true
+	}
+
+	if len(allowed) == 0 {
+		return next, nil
+	}
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || !(allowed["*"] || allowed[origin]) {
+			next.ServeHTTP(rw, r)
+			return
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), corsKey{}, true))
+
+		h := rw.Header()
+		h.Add("Vary", "Origin")
+		h.Set("Access-Control-Allow-Origin", origin)
+		h.Set("Access-Control-Expose-Headers", "X-Request-ID")
+
+		if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+			next.ServeHTTP(rw, r)
+			return
+		}
+
+		h.Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		h.Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-Request-ID")
+		h.Set("Access-Control-Max-Age", corsMaxAge)
+		rw.WriteHeader(http.StatusNoContent)
+	}), nil
+}
+
+// withBasePath serves next under base, such as /pigpio, with the prefix
+// stripped so the routes of the API are unchanged. The dashboard uses
+// relative links so base itself and the bare root redirect to base/.
+func withBasePath(base string, next http.Handler) (http.Handler, error) {
+	base = "/" + strings.Trim(base, "/")
+	if base == "/" {
+		return next, nil
+	}
+
+	if strings.ContainsAny(base, "?#") {
+		return nil, fmt.Errorf("base path %q must not contain ? or #", base)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(base+"/", http.StripPrefix(base, next))
+	mux.HandleFunc("/", func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" && r.URL.Path != base {
+			http.NotFound(rw, r)
+			return
+		}
+
+		http.Redirect(rw, r, base+"/", http.StatusFound)
+	})
+
+	return mux, nil
+}
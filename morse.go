@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"periph.io/x/periph/conn/gpio"
+)
+
+// DefaultMorseUnit is the length of a dot when sending Morse code
+const DefaultMorseUnit = 150 * time.Millisecond
+
+var morseCodes = map[rune]string{
+	'A': ".-", 'B': "-...", 'C': "-.-.", 'D': "-..", 'E': ".", 'F': "..-.",
+	'G': "--.", 'H': "....", 'I': "..", 'J': ".---", 'K': "-.-", 'L': ".-..",
+	'M': "--", 'N': "-.", 'O': "---", 'P': ".--.", 'Q': "--.-", 'R': ".-.",
+	'S': "...", 'T': "-", 'U': "..-", 'V': "...-", 'W': ".--", 'X': "-..-",
+	'Y': "-.--", 'Z': "--..",
+	'0': "-----", '1': ".----", '2': "..---", '3': "...--", '4': "....-",
+	'5': ".....", '6': "-....", '7': "--...", '8': "---..", '9': "----.",
+}
+
+// Step holds the pin at Level for Duration
+type Step struct {
+	Level    gpio.Level
+	Duration time.Duration
+}
+
+// Morse flashes text on the pin in Morse code using the standard timing, a
+// dot is one unit, a dash three, with one unit between symbols, three between
+// letters and seven between words. Characters without a Morse code are
+// skipped with a warning. Morse blocks until the message has been sent and
+// the pin turned off, or returns an error if the pin is stopped or restarted
+// before then.
+func (f *PinCycle) Morse(ctx context.Context, text string, unit time.Duration) error {
+	done, err := f.startMorse(ctx, text, unit)
+	if err != nil {
+		return err
+	}
+
+	return <-done
+}
+
+// startMorse starts sending text in the background, the returned channel
+// receives the result once the message has finished
+func (f *PinCycle) startMorse(ctx context.Context, text string, unit time.Duration) (<-chan error, error) {
+	steps := morseSteps(f.Pin.Name(), text, unit)
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("no characters in %q can be sent in Morse code", text)
+	}
+
+	done := make(chan error, 1)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.start(ctx, ModeMorse, func(ctx context.Context) {
+		err := f.play(ctx, steps)
+		if err == nil {
+			f.finish(ctx)
+		}
+
+		done <- err
+	})
+
+	return done, nil
+}
+
+// play drives the pin through steps, finishing with the pin low
+func (f *PinCycle) play(ctx context.Context, steps []Step) error {
+	for _, s := range steps {
+		if err := f.write(ctx, s.Level); err != nil {
+			return err
+		}
+
+		if !f.sleep(ctx, s.Duration) {
+			return ctx.Err()
+		}
+	}
+
+	return f.write(ctx, gpio.Low)
+}
+
+// morseSteps encodes text as a sequence of on and off steps
+func morseSteps(pin, text string, unit time.Duration) []Step {
+	steps := []Step{}
+
+	// gap appends an off step, extending the previous one so that the longer
+	// letter and word gaps replace the gap between symbols
+	gap := func(units int) {
+		if len(steps) == 0 {
+			return
+		}
+
+		last := &steps[len(steps)-1]
+		if last.Level == gpio.Low {
+			if d := time.Duration(units) * unit; d > last.Duration {
+				last.Duration = d
+			}
+			return
+		}
+
+		steps = append(steps, Step{gpio.Low, time.Duration(units) * unit})
+	}
+
+	for _, word := range strings.Fields(text) {
+		gap(7)
+
+		for _, c := range word {
+			code, ok := morseCodes[unicode.ToUpper(c)]
+			if !ok {
+				logger.Warn("Skipping character with no Morse code", "pin", pin, "character", string(c))
+				continue
+			}
+
+			gap(3)
+
+			for _, symbol := range code {
+				gap(1)
+
+				if symbol == '-' {
+					steps = append(steps, Step{gpio.High, 3 * unit})
+				} else {
+					steps = append(steps, Step{gpio.High, unit})
+				}
+			}
+		}
+	}
+
+	return steps
+}
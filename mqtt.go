@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Payloads used on the MQTT command and state topics
+const (
+	mqttOn  = "ON"
+	mqttOff = "OFF"
+)
+
+// mqttDiscoveryPrefix is the topic prefix Home Assistant watches for MQTT
+// discovery messages
+const mqttDiscoveryPrefix = "homeassistant"
+
+// MQTT connects the pins to an MQTT broker. Each pin accepts ON and OFF on
+// {prefix}/pins/{gpio}/set, reports its state on {prefix}/pins/{gpio}/state
+// and is announced to Home Assistant as a light. The pins of other boards
+// use the number they are keyed by in place of {gpio}, see boardStride. The
+// client reconnects on its own if the broker goes away.
+type MQTT struct {
+	client  mqtt.Client
+	prefix  string
+	manager *Manager
+	events  *Bus
+
+	// mu guards last, the state most recently published for each pin, so
+	// level changes while cycling are not republished
+	mu   sync.Mutex
+	last map[int]string
+}
+
+// NewMQTT creates a client for the broker, such as tcp://localhost:1883,
+// driving the pins of manager. username and password may be empty.
+func NewMQTT(broker, prefix, username, password string, manager *Manager, events *Bus) *MQTT {
+	m := &MQTT{prefix: prefix, manager: manager, events: events, last: map[int]string{}}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(broker).
+		SetClientID(prefix).
+		SetUsername(username).
+		SetPassword(password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetMaxReconnectInterval(time.Minute).
+		SetWill(m.availabilityTopic(), "offline", 1, true).
+		SetOnConnectHandler(m.onConnect).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			logger.Warn("Lost connection to MQTT broker, reconnecting", "event", "mqtt", "error", err)
+		})
+
+	m.client = mqtt.NewClient(opts)
+
+	return m
+}
+
+// Start connects to the broker in the background and publishes pin state
+// changes until ctx is cancelled, when it marks the pins offline and
+// disconnects. The returned channel is closed once disconnected.
+func (m *MQTT) Start(ctx context.Context) <-chan struct{} {
+	ch, unsubscribe := m.events.SubscribeInternal("mqtt")
+
+	// with ConnectRetry set the token only completes once connected, the
+	// client keeps retrying in the background if the broker is down
+	m.client.Connect()
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		defer unsubscribe()
+
+		for {
+			select {
+			case e := <-ch:
+				if n, ok := m.manager.ByName(e.Pin); ok {
+					m.publishState(n, e.Mode, false)
+				}
+			case <-ctx.Done():
+				// report any state changes already queued, such as the pins
+				// being turned off on shutdown
+				for len(ch) > 0 {
+					if n, ok := m.manager.ByName((<-ch).Pin); ok {
+						s, _ := m.manager.Get(strconv.Itoa(n))
+						m.publishState(n, s.Mode, false)
+					}
+				}
+
+				m.client.Publish(m.availabilityTopic(), 1, true, "offline").WaitTimeout(time.Second)
+				m.client.Disconnect(250)
+				return
+			}
+		}
+	}()
+
+	return done
+}
+
+// onConnect subscribes to the command topics and announces every pin, it
+// runs again after each reconnect
+func (m *MQTT) onConnect(c mqtt.Client) {
+	logger.Info("Connected to MQTT broker", "event", "mqtt")
+
+	if t := c.Subscribe(m.prefix+"/pins/+/set", 1, m.handleSet); t.Wait() && t.Error() != nil {
+		logger.Error("Unable to subscribe to MQTT command topics", "event", "error", "error", t.Error())
+	}
+
+	c.Publish(m.availabilityTopic(), 1, true, "online")
+
+	for _, s := range m.manager.Status() {
+		if !s.Available {
+			continue
+		}
+
+		// the keyed number, as the events and command topics use, so pins
+		// of different boards sharing a GPIO number stay apart
+		n := s.n
+
+		name := s.Alias
+		if name == "" {
+			name = pinLabel(s.Board, s.GPIO)
+		}
+
+		config, _ := json.Marshal(map[string]string{
+			"name":               name,
+			"unique_id":          fmt.Sprintf("%s_%d", m.prefix, n),
+			"command_topic":      m.pinTopic(n, "set"),
+			"state_topic":        m.pinTopic(n, "state"),
+			"availability_topic": m.availabilityTopic(),
+			"payload_on":         mqttOn,
+			"payload_off":        mqttOff,
+		})
+		c.Publish(fmt.Sprintf("%s/light/%s_%d/config", mqttDiscoveryPrefix, m.prefix, n), 1, true, config)
+
+		m.publishState(n, s.Mode, true)
+	}
+}
+
+// handleSet turns a pin on or off for a message on its command topic through
+// the Manager, as the HTTP API does
+func (m *MQTT) handleSet(_ mqtt.Client, msg mqtt.Message) {
+	id := strings.TrimSuffix(strings.TrimPrefix(msg.Topic(), m.prefix+"/pins/"), "/set")
+
+	_, p, err := m.manager.Lookup(id)
+	if err != nil {
+		logger.Warn("MQTT command for unknown pin", "event", "mqtt", "topic", msg.Topic())
+		return
+	}
+
+	ctx := contextWithSource(context.Background(), SourceMQTT, "", "")
+
+	switch strings.ToUpper(strings.TrimSpace(string(msg.Payload()))) {
+	case mqttOn:
+		logger.Info("On", "event", "on", "pin", p.Pin.Name(), "source", "mqtt")
+		m.manager.On(ctx, id, 0)
+	case mqttOff:
+		logger.Info("Off", "event", "off", "pin", p.Pin.Name(), "source", "mqtt")
+		if err := m.manager.Off(ctx, id); err != nil {
+			logger.Error("Unable to turn off pin", "event", "error", "pin", p.Pin.Name(), "error", err)
+		}
+	default:
+		logger.Warn("MQTT command must be ON or OFF", "event", "mqtt", "topic", msg.Topic(), "payload", string(msg.Payload()))
+	}
+}
+
+// publishState reports whether pin n is on, any mode other than off counts
+// as on. Unless force is set nothing is sent if the state has not changed.
+func (m *MQTT) publishState(n int, mode Mode, force bool) {
+	state := mqttOn
+	if mode == ModeOff {
+		state = mqttOff
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !force && m.last[n] == state {
+		return
+	}
+
+	m.last[n] = state
+	m.client.Publish(m.pinTopic(n, "state"), 1, true, state)
+}
+
+func (m *MQTT) pinTopic(n int, suffix string) string {
+	return fmt.Sprintf("%s/pins/%d/%s", m.prefix, n, suffix)
+}
+
+func (m *MQTT) availabilityTopic() string {
+	return m.prefix + "/status"
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// fakeMQTTClient records what is published, the other methods of the client
+// are not used by the tests
+type fakeMQTTClient struct {
+	mqtt.Client
+
+	mu        sync.Mutex
+	published map[string][]byte
+}
+
+func (c *fakeMQTTClient) Publish(topic string, _ byte, _ bool, payload any) mqtt.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch p := payload.(type) {
+	case string:
+		c.published[topic] = []byte(p)
+	case []byte:
+		c.published[topic] = p
+	}
+
+	return doneToken{}
+}
+
+func (c *fakeMQTTClient) Subscribe(string, byte, mqtt.MessageHandler) mqtt.Token {
+	return doneToken{}
+}
+
+// Published returns the payload last published to topic
+func (c *fakeMQTTClient) Published(topic string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, ok := c.published[topic]
+	return string(p), ok
+}
+
+type doneToken struct{}
+
+func (doneToken) Wait() bool                     { return true }
+func (doneToken) WaitTimeout(time.Duration) bool { return true }
+func (doneToken) Error() error                   { return nil }
+
+func (doneToken) Done() <-chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+
+type fakeMQTTMessage struct {
+	mqtt.Message
+
+	topic   string
+	payload string
+}
+
+func (m fakeMQTTMessage) Topic() string   { return m.topic }
+func (m fakeMQTTMessage) Payload() []byte { return []byte(m.payload) }
+
+func TestMQTTBoardsSharingAGPIONumber(t *testing.T) {
+	native := &PinCycle{Pin: newTestPin("GPIO5")}
+	expander := &PinCycle{Pin: newTestPin("EXP_GPIO5"), Board: "expander"}
+	m := NewManager(map[int]*PinCycle{5: native, boardStride + 5: expander}, nil)
+
+	client := &fakeMQTTClient{published: map[string][]byte{}}
+	q := NewMQTT("tcp://localhost:1883", "pi", "", "", m, NewBus(0, eventBufferSize, DropNewest))
+	q.client = client
+	q.onConnect(client)
+
+	ids := map[string]bool{}
+	for _, tt := range []struct {
+		key   string
+		name  string
+		topic string
+	}{
+		{"pi_5", "rpi/5", "pi/pins/5"},
+		{"pi_1005", "expander/5", "pi/pins/1005"},
+	} {
+		payload, ok := client.Published("homeassistant/light/" + tt.key + "/config")
+		if !ok {
+			t.Fatalf("expected %s to be announced as %s", tt.name, tt.key)
+		}
+
+		config := map[string]string{}
+		if err := json.Unmarshal([]byte(payload), &config); err != nil {
+			t.Fatal(err)
+		}
+
+		if config["unique_id"] != tt.key || config["command_topic"] != tt.topic+"/set" || config["state_topic"] != tt.topic+"/state" {
+			t.Fatalf("expected %s to use %s and the %s topics, got %v", tt.name, tt.key, tt.topic, config)
+		}
+		ids[config["unique_id"]] = true
+
+		if state, _ := client.Published(tt.topic + "/state"); state != mqttOff {
+			t.Fatalf("expected %s to report %s on %s/state, got %q", tt.name, mqttOff, tt.topic, state)
+		}
+	}
+
+	if len(ids) != 2 {
+		t.Fatalf("expected a unique id for each pin, got %v", ids)
+	}
+
+	// the command topic announced for the expander pin drives it alone
+	q.handleSet(client, fakeMQTTMessage{topic: "pi/pins/1005/set", payload: mqttOn})
+
+	waitFor(t, "the expander pin to turn on", func() bool {
+		mode, _ := expander.State()
+		return mode != ModeOff
+	})
+
+	if mode, _ := native.State(); mode != ModeOff {
+		t.Fatalf("expected the native pin to stay off, got %s", mode)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// writeResponse replies with v as JSON, or as a concise line of text per pin
+// when the Accept header of r prefers text/plain or is only */*. Values
+// with no text form are always JSON.
+func writeResponse(rw http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	text, ok := responseText(v)
+	if !ok || !wantsText(r.Header.Get("Accept")) {
+		writeJSON(rw, status, v)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	rw.WriteHeader(status)
+
+	if _, err := io.WriteString(rw, text); err != nil {
+		logger.Error("Unable to write response", "error", err)
+	}
+}
+
+// wantsText reports whether accept ranks plain text above JSON. JSON is
+// chosen when accept is empty, names neither or ranks them equally.
+func wantsText(accept string) bool {
+	var jsonQ, textQ float64
+
+	for _, r := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(r))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+
+		switch mediaType {
+		case "application/json", "application/*":
+			jsonQ = max(jsonQ, q)
+		case "text/plain", "text/*", "*/*":
+			textQ = max(textQ, q)
+		}
+	}
+
+	return textQ > jsonQ
+}
+
+// responseText returns the text form of v, false if it has none
+func responseText(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case PinStatus:
+		return v.Text() + "\n", true
+	case []PinStatus:
+		var b strings.Builder
+		for _, s := range v {
+			b.WriteString(s.Text() + "\n")
+		}
+
+		return b.String(), true
+	case Stats:
+		return v.Text() + "\n", true
+	case QueuedCommand:
+		return v.Text() + "\n", true
+	}
+
+	return "", false
+}
+
+// Text returns the state of the pin on one line, such as
+// "GPIO23 porch cycling High manual"
+func (s PinStatus) Text() string {
+	name := pinLabel(s.Board, s.GPIO)
+	if s.Alias != "" {
+		name += " " + s.Alias
+	}
+
+	if !s.Available {
+		return name + " unavailable: " + s.Error
+	}
+
+	text := fmt.Sprintf("%s %s %s %s", name, s.Mode, s.Level, s.Source)
+	if s.Disabled {
+		text += " disabled"
+	}
+	if s.Failures > 0 {
+		text += fmt.Sprintf(", %d failures: %s", s.Failures, s.LastError)
+	}
+
+	return text
+}
+
+// Text returns the counters on one line, the pins are left out
+func (s Stats) Text() string {
+	queued := 0
+	for _, n := range s.Queued {
+		queued += n
+	}
+
+	return fmt.Sprintf("up %s, %d requests, %d pins, %d cycling, %d goroutines, %d queued", s.Uptime, s.Requests, len(s.Pins), s.Cycling, s.Goroutines, queued)
+}
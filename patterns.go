@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"periph.io/x/periph/conn/gpio"
+)
+
+// Default step intervals for the multi-pin patterns
+const (
+	DefaultChaseInterval = 120 * time.Millisecond
+	DefaultSyncInterval  = 500 * time.Millisecond
+)
+
+// Chase lights one pin at a time, sweeping left to right along pins and back
+// again, until ctx is cancelled or every pin has been taken over by another
+// command. The pins are stopped before the chase begins and turned off when
+// it ends.
+func Chase(ctx context.Context, pins []*PinCycle, interval time.Duration) {
+	claims := claimAll(ctx, pins)
+	defer releaseAll(pins, claims)
+
+	if len(pins) == 0 {
+		return
+	}
+
+	// sweep 0, 1, ... n-1, n-2, ... 1 and repeat
+	order := []int{}
+	for i := range pins {
+		order = append(order, i)
+	}
+	for i := len(pins) - 2; i > 0; i-- {
+		order = append(order, i)
+	}
+
+	lit := -1
+	for {
+		for _, i := range order {
+			if lit >= 0 {
+				pins[lit].write(claims[lit], gpio.Low)
+			}
+
+			pins[i].write(claims[i], gpio.High)
+			lit = i
+
+			if !sleepClock(ctx, clockOf(pins), interval) || allDone(claims) {
+				return
+			}
+		}
+	}
+}
+
+// SyncCycle blinks every pin in lock-step from a single shared ticker, so all
+// pins write the same level at the same instant, until ctx is cancelled or
+// every pin has been taken over by another command. The pins are turned off
+// together when it ends.
+func SyncCycle(ctx context.Context, pins []*PinCycle, interval time.Duration) {
+	claims := claimAll(ctx, pins)
+	defer releaseAll(pins, claims)
+
+	t := clockOf(pins).NewTicker(interval)
+	defer t.Stop()
+
+	state := gpio.High
+	for {
+		for i, p := range pins {
+			p.write(claims[i], state)
+		}
+
+		select {
+		case <-t.C():
+		case <-ctx.Done():
+			return
+		}
+
+		if allDone(claims) {
+			return
+		}
+
+		// flip the state
+		if state == gpio.High {
+			state = gpio.Low
+		} else {
+			state = gpio.High
+		}
+	}
+}
+
+// claimAll claims every pin for a multi-pin pattern run with ctx
+func claimAll(ctx context.Context, pins []*PinCycle) []context.Context {
+	claims := make([]context.Context, len(pins))
+	for i, p := range pins {
+		claims[i] = p.Claim(ctx)
+	}
+
+	return claims
+}
+
+// releaseAll turns off and releases the pins which are still claimed
+func releaseAll(pins []*PinCycle, claims []context.Context) {
+	for i, p := range pins {
+		if p.write(claims[i], gpio.Low) == nil {
+			p.finish(claims[i])
+		}
+	}
+}
+
+// clockOf returns the clock a multi-pin pattern driving pins is timed by,
+// that of the first pin
+func clockOf(pins []*PinCycle) Clock {
+	if len(pins) == 0 {
+		return SystemClock
+	}
+
+	return pins[0].clock()
+}
+
+// allDone returns true once every claim has been cancelled
+func allDone(claims []context.Context) bool {
+	for _, c := range claims {
+		if c.Err() == nil {
+			return false
+		}
+	}
+
+	return true
+}
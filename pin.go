@@ -0,0 +1,746 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"periph.io/x/periph/conn/gpio"
+)
+
+// Default bounds for the time between flips of a cycling pin
+const (
+	DefaultMinInterval = 300 * time.Millisecond
+	DefaultMaxInterval = 1000 * time.Millisecond
+)
+
+// Pin is the subset of gpio.PinIO used by PinCycle, any gpio.PinIO such as
+// the rpi header pins satisfies it
+type Pin interface {
+	Out(l gpio.Level) error
+	Name() string
+}
+
+// Mode describes what a PinCycle is currently doing
+type Mode string
+
+// Modes reported by PinCycle.Mode
+const (
+	ModeOff      Mode = "off"
+	ModeCycling  Mode = "cycling"
+	ModeSolid    Mode = "solid"
+	ModeDimmed   Mode = "dimmed"
+	ModeFading   Mode = "fading"
+	ModeMorse    Mode = "morse"
+	ModePattern  Mode = "pattern"
+	ModeSequence Mode = "sequence"
+	ModeTwinkle  Mode = "twinkle"
+	ModeBlink    Mode = "blink"
+)
+
+// OffMode is what Stop leaves a pin as
+type OffMode string
+
+// OffModes, low and high are logical levels so are inverted along with every
+// other write to an Inverted pin
+const (
+	OffLow   OffMode = "low"
+	OffHigh  OffMode = "high"
+	OffInput OffMode = "input"
+)
+
+// ParseOffMode returns the OffMode named s, an empty name is OffLow
+func ParseOffMode(s string) (OffMode, error) {
+	switch m := OffMode(s); m {
+	case "":
+		return OffLow, nil
+	case OffLow, OffHigh, OffInput:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown off mode %q, expected low, high or input", s)
+	}
+}
+
+// PinCycle flashes an LED connected to Pin on and off, at random intervals
+// unless another Pattern is set
+type PinCycle struct {
+	Pin Pin
+
+	// Alias is an optional friendly name used to address the pin in the API
+	Alias string
+
+	// Board is the name of the GPIO expander the pin is on, empty for the
+	// native header
+	Board string
+
+	// MaxFailures is the number of consecutive failed writes after which the
+	// pin is stopped, zero means it never gives up
+	MaxFailures int
+
+	// MinInterval and MaxInterval bound the random time between flips, when
+	// they are equal the pin blinks steadily. Zero values use
+	// DefaultMinInterval and DefaultMaxInterval.
+	MinInterval time.Duration
+	MaxInterval time.Duration
+
+	// Rand is the source of the random intervals, when nil the global
+	// math/rand source is used
+	Rand *rand.Rand
+
+	// Inverted is set for active-low wiring where driving the pin low turns
+	// the LED on, levels reported by State are always logical
+	Inverted bool
+
+	// MinWriteInterval is the shortest time allowed between changes of level,
+	// protecting relays from patterns which switch faster. Writes from
+	// patterns inside the interval are dropped while On and Stop wait for
+	// it to pass. Zero disables the limit.
+	MinWriteInterval time.Duration
+
+	// MinOnTime is the shortest time the pin stays on once turned on, and
+	// MaxOnTime the longest it may stay on continuously before it is
+	// stopped, protecting relays which chatter if switched too briefly or
+	// must not be left energised. A change to off inside MinOnTime is
+	// handled as for MinWriteInterval. Zero disables either limit.
+	MinOnTime time.Duration
+	MaxOnTime time.Duration
+
+	// OffMode is what Stop leaves the pin as, OffInput switches it to a high
+	// impedance input for a pin shared with another controller and is
+	// reported as Low. The zero value is OffLow.
+	OffMode OffMode
+
+	// PWMFrequency is the software PWM carrier frequency in Hz and PWMSteps
+	// the number of distinct duty cycles, zero values use
+	// DefaultPWMFrequency and DefaultPWMSteps
+	PWMFrequency int
+	PWMSteps     int
+
+	// Clock is the source of time for the intervals, limits and timers of
+	// the pin, nil uses SystemClock
+	Clock Clock
+
+	// Events receives a notification whenever the mode or level of the pin
+	// changes, it may be nil
+	Events *Bus
+
+	// OnFailed, when set, is called in a new goroutine each time the pin is
+	// stopped after MaxFailures consecutive failures
+	OnFailed func()
+
+	// mu guards the fields below and is held while writing to Pin so that
+	// Stop can guarantee no further writes happen once it returns
+	mu       sync.Mutex
+	cancel   context.CancelFunc
+	mode     Mode
+	level    gpio.Level
+	duty     float64
+	failures int
+	until    time.Time
+	flips    uint64
+	pattern  Pattern
+
+	// fadeTo is the brightness the running fade ends at, see settledMode
+	fadeTo float64
+
+	// lastErr is the most recent error writing to Pin, kept until Reset
+	lastErr error
+
+	// changed is when the level last changed, for MinWriteInterval and
+	// MinOnTime, closing onStop cancels stopping the pin once it has been
+	// on for MaxOnTime
+	changed time.Time
+	onStop  chan struct{}
+
+	// done is closed once the goroutine most recently started by start has
+	// exited, wg tracks every goroutine and goroutines counts those which
+	// have not yet exited
+	done       chan struct{}
+	wg         sync.WaitGroup
+	goroutines atomic.Int64
+
+	// petted is when, in Unix nanoseconds, a goroutine last started, wrote
+	// to the pin or finished resting, and resting counts the goroutines
+	// waiting for their next step, see Manager.Watchdog
+	petted  atomic.Int64
+	resting atomic.Int64
+
+	// disabled is set while commands for the pin are ignored, see
+	// Manager.Disable
+	disabled atomic.Bool
+}
+
+// contextOut is implemented by pins which log their writes, such as the
+// simulator, so the lines carry the request ID of the write
+type contextOut interface {
+	OutContext(ctx context.Context, l gpio.Level) error
+}
+
+// Cycle starts flashing the pin in a background goroutine, replacing
+// anything else the pin was doing. Calling Cycle on a pin which is already
+// cycling indefinitely has no effect. Values of ctx, such as the request ID,
+// are carried into the goroutine for logging but it is not cancelled with
+// ctx, the same applies to the other methods which start the pin.
+func (f *PinCycle) Cycle(ctx context.Context) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.cancel != nil && f.mode == ModeCycling && f.until.IsZero() {
+		return
+	}
+
+	f.start(ctx, ModeCycling, f.cycle)
+}
+
+// CycleFor starts flashing the pin and turns it off again once d has
+// elapsed. Stopping the pin beforehand cancels the timer and calling CycleFor
+// again restarts it.
+func (f *PinCycle) CycleFor(ctx context.Context, d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.start(ctx, ModeCycling, func(ctx context.Context) {
+		timeout, cancel := withClockTimeout(ctx, f.clock(), d)
+		defer cancel()
+
+		f.cycle(timeout)
+
+		// the timer expired rather than the pin being stopped or restarted
+		if ctx.Err() == nil && f.write(ctx, gpio.Low) == nil {
+			f.finish(ctx)
+		}
+	})
+	f.until = f.clock().Now().Add(d)
+}
+
+// On turns the pin on and leaves it on without blinking, replacing anything
+// else the pin was doing until it is stopped or restarted
+func (f *PinCycle) On(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.cancel != nil && f.mode == ModeSolid {
+		return nil
+	}
+
+	// nothing runs in the background, the claim only marks the pin as in use
+	f.claim(ctx, ModeSolid)
+
+	if err := f.out(ctx, gpio.High); err != nil {
+		f.halt()
+		f.notify()
+		return err
+	}
+
+	f.level = gpio.High
+	f.notify()
+	return nil
+}
+
+// Stop halts whatever the pin is doing and turns it off, leaving it as
+// OffMode. It blocks briefly until the background goroutine has exited, so
+// once Stop returns the pin is off and nothing else writes to it. An error is
+// returned if the pin could not be set to OffMode. Stop must not be called
+// from the goroutine itself.
+func (f *PinCycle) Stop(ctx context.Context) error {
+	return f.halted(func() (chan struct{}, error) { return f.stop(ctx) })
+}
+
+// Toggle turns the pin off if it is doing anything and starts it cycling
+// otherwise, in a single step so two toggles can not both see it off. When
+// turning the pin off it blocks like Stop.
+func (f *PinCycle) Toggle(ctx context.Context) error {
+	return f.halted(func() (chan struct{}, error) {
+		if f.cancel == nil {
+			f.start(ctx, ModeCycling, f.cycle)
+			return nil, nil
+		}
+
+		return f.stop(ctx)
+	})
+}
+
+// halted runs fn with f.mu held, releasing it even if writing to the pin
+// panics, then waits for the goroutine fn halted. The goroutine can not write
+// once halted, but may still be running, waiting outside the lock lets it
+// finish.
+func (f *PinCycle) halted(fn func() (chan struct{}, error)) error {
+	done, err := func() (chan struct{}, error) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		return fn()
+	}()
+
+	if done != nil {
+		<-done
+	}
+
+	return err
+}
+
+// stop halts the pin and sets it to OffMode, returning the channel closed
+// once the goroutine has exited. f.mu must be held.
+func (f *PinCycle) stop(ctx context.Context) (chan struct{}, error) {
+	f.halt()
+
+	err := f.off(ctx)
+	f.notify()
+
+	done := f.done
+	f.done = nil
+
+	return done, err
+}
+
+// Reset clears the failure count and last error and stops the pin, setting
+// it to OffMode to check it can be written to again. If that fails the error is
+// returned and recorded as the last error.
+func (f *PinCycle) Reset(ctx context.Context) error {
+	return f.halted(func() (chan struct{}, error) {
+		f.failures = 0
+		f.lastErr = nil
+		return f.stop(ctx)
+	})
+}
+
+// Errors returns the number of consecutive failed writes and the most recent
+// write error, nil if there has been none since the pin was last reset
+func (f *PinCycle) Errors() (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.failures, f.lastErr
+}
+
+// alias returns Alias, which Reload changes with the pin locked
+func (f *PinCycle) alias() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.Alias
+}
+
+// Running returns true if a background goroutine is driving the pin
+func (f *PinCycle) Running() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.cancel != nil
+}
+
+// State returns what the pin is doing and the last level successfully
+// written to it
+func (f *PinCycle) State() (Mode, gpio.Level) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.cancel == nil {
+		return ModeOff, f.level
+	}
+
+	return f.mode, f.level
+}
+
+// Flips returns the number of times Cycle has changed the level of the pin
+func (f *PinCycle) Flips() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.flips
+}
+
+// start cancels any running goroutine and runs fn in a new one, the context
+// passed to fn carries the values of ctx and is cancelled when the pin is
+// stopped or restarted. f.mu must be held.
+func (f *PinCycle) start(ctx context.Context, mode Mode, fn func(ctx context.Context)) {
+	f.startAt(ctx, mode, 0, fn)
+}
+
+// startAt is start for a pin fn drives by PWM at duty, so the state published
+// as the pin starts has its brightness. f.mu must be held.
+func (f *PinCycle) startAt(ctx context.Context, mode Mode, duty float64, fn func(ctx context.Context)) {
+	ctx = f.claimAt(ctx, mode, duty)
+
+	done := make(chan struct{})
+	f.done = done
+	f.wg.Add(1)
+	f.goroutines.Add(1)
+	f.pet()
+
+	go func() {
+		defer f.wg.Done()
+		defer f.goroutines.Add(-1)
+		defer close(done)
+		defer f.recoverPin(ctx)
+		fn(ctx)
+	}()
+}
+
+// Goroutines returns the number of goroutines started for the pin which have
+// not yet exited, the one driving the pin and any still exiting after being
+// replaced
+func (f *PinCycle) Goroutines() int {
+	return int(f.goroutines.Load())
+}
+
+// claim cancels any running goroutine and returns a context derived from
+// parent that owns the pin until it is stopped or restarted, writes made with
+// the context using write fail once it is cancelled. The context keeps the
+// values of parent, for logging, but not its cancellation. f.mu must be held.
+func (f *PinCycle) claim(parent context.Context, mode Mode) context.Context {
+	return f.claimAt(parent, mode, 0)
+}
+
+// claimAt is claim for a pin driven by PWM at duty, f.mu must be held
+func (f *PinCycle) claimAt(parent context.Context, mode Mode, duty float64) context.Context {
+	f.halt()
+	f.duty = duty
+
+	ctx, cancel := context.WithCancel(context.WithoutCancel(parent))
+	f.cancel = cancel
+	f.mode = mode
+	f.failures = 0
+	f.notify()
+
+	return ctx
+}
+
+// Claim hands control of the pin to a controller driving several pins at
+// once, such as Chase, until the pin is stopped or restarted
+func (f *PinCycle) Claim(ctx context.Context) context.Context {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.claim(ctx, ModePattern)
+}
+
+// halt cancels the running goroutine if there is one, f.mu must be held
+func (f *PinCycle) halt() {
+	if f.cancel != nil {
+		f.cancel()
+		f.cancel = nil
+	}
+
+	f.mode = ModeOff
+	f.duty = 0
+	f.until = time.Time{}
+}
+
+// finish marks the pin as off once the goroutine owning ctx has completed on
+// its own, it has no effect if the pin has since been stopped or restarted
+func (f *PinCycle) finish(ctx context.Context) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if ctx.Err() == nil {
+		f.halt()
+		f.notify()
+	}
+}
+
+// write sets the pin to l on behalf of the goroutine owning ctx. Failed
+// writes are logged, a non nil error is only returned when ctx has been
+// cancelled or the pin has been stopped after MaxFailures consecutive
+// failures, in which case the caller should return.
+func (f *PinCycle) write(ctx context.Context, l gpio.Level) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	f.pet()
+
+	// patterns carry on as though the write happened, the next one the
+	// limit allows catches the pin up
+	if wait := f.limited(l); wait > 0 {
+		logger.DebugContext(ctx, "Suppressed write", "event", "ratelimit", "pin", f.Pin.Name(), "level", l.String(), "wait", wait.String())
+		return nil
+	}
+
+	if err := f.out(ctx, l); err != nil {
+		f.failures++
+		logger.ErrorContext(ctx, "Unable to set pin", "event", "error", "pin", f.Pin.Name(), "level", l.String(), "error", err)
+
+		if f.MaxFailures > 0 && f.failures >= f.MaxFailures {
+			logger.WarnContext(ctx, "Stopping pin after consecutive failures", "event", "state", "pin", f.Pin.Name(), "failures", f.failures)
+			f.halt()
+			f.notify()
+
+			if f.OnFailed != nil {
+				go f.OnFailed()
+			}
+
+			return err
+		}
+
+		return nil
+	}
+
+	changed := f.level != l
+	f.failures = 0
+	f.level = l
+
+	// PWM toggles the level far too often to report each change
+	pwm := f.mode == ModeDimmed || f.mode == ModeFading || f.mode == ModeTwinkle || (f.mode == ModeCycling && f.pattern == PatternPulse)
+	if changed && !pwm {
+		f.notify()
+	}
+
+	return nil
+}
+
+// out drives Pin to the physical level for the logical level l. A change of
+// level within MinWriteInterval of the previous change is deferred until the
+// interval has passed. f.mu must be held.
+func (f *PinCycle) out(ctx context.Context, l gpio.Level) error {
+	if wait := f.limited(l); wait > 0 {
+		<-f.clock().After(wait)
+	}
+
+	physical := l
+	if f.Inverted {
+		physical = !l
+	}
+
+	// pins are usually looked up by an alias, such as "18" for GPIO18
+	var pin Pin = f.Pin
+	if r, ok := pin.(gpio.RealPin); ok {
+		pin = r.Real()
+	}
+
+	var err error
+	if c, ok := pin.(contextOut); ok {
+		err = c.OutContext(ctx, physical)
+	} else {
+		err = f.Pin.Out(physical)
+	}
+
+	if err != nil {
+		f.lastErr = err
+		return err
+	}
+
+	if l != f.level {
+		f.changed = f.clock().Now()
+		f.limitOn(l)
+	}
+
+	return nil
+}
+
+// off sets the pin to OffMode, f.mu must be held
+func (f *PinCycle) off(ctx context.Context) error {
+	switch f.OffMode {
+	case OffHigh:
+		if err := f.out(ctx, gpio.High); err != nil {
+			return err
+		}
+
+		f.level = gpio.High
+		return nil
+	case OffInput:
+		in, ok := f.Pin.(gpio.PinIn)
+		if !ok {
+			err := errors.New("pin can not be switched to input")
+			f.lastErr = err
+			return err
+		}
+
+		if err := in.In(gpio.Float, gpio.NoEdge); err != nil {
+			f.lastErr = err
+			return err
+		}
+
+		logger.DebugContext(ctx, "Switched pin to input", "event", "off", "pin", f.Pin.Name())
+
+		if f.level != gpio.Low {
+			f.changed = f.clock().Now()
+			f.limitOn(gpio.Low)
+		}
+
+		f.level = gpio.Low
+		return nil
+	default:
+		if err := f.out(ctx, gpio.Low); err != nil {
+			return err
+		}
+
+		f.level = gpio.Low
+		return nil
+	}
+}
+
+// limitOn starts the MaxOnTime timer when the pin changes to l of High and
+// cancels it when the pin turns off. f.mu must be held.
+func (f *PinCycle) limitOn(l gpio.Level) {
+	if f.onStop != nil {
+		close(f.onStop)
+		f.onStop = nil
+	}
+
+	if l != gpio.High || f.MaxOnTime <= 0 {
+		return
+	}
+
+	stop := make(chan struct{})
+	after := f.clock().After(f.MaxOnTime)
+	f.onStop = stop
+
+	go func() {
+		defer f.recoverPin(context.Background())
+
+		select {
+		case <-after:
+			f.expire()
+		case <-stop:
+		}
+	}()
+}
+
+// expire stops the pin once it has been on continuously for MaxOnTime
+func (f *PinCycle) expire() {
+	err := f.halted(func() (chan struct{}, error) {
+		// the timer fired as the pin changed level, it has been restarted
+		// or is no longer needed
+		if f.level != gpio.High || f.clock().Now().Sub(f.changed) < f.MaxOnTime {
+			return nil, nil
+		}
+
+		logger.Warn("Stopping pin after maximum on time", "event", "state", "pin", f.Pin.Name(), "max_on_time", f.MaxOnTime.String())
+		return f.stop(context.Background())
+	})
+
+	if err != nil {
+		logger.Error("Unable to drive pin low", "event", "error", "pin", f.Pin.Name(), "error", err)
+	}
+}
+
+// limited returns how long to wait before the pin may change to l without
+// breaking MinWriteInterval or MinOnTime, zero if it may change now. f.mu
+// must be held.
+func (f *PinCycle) limited(l gpio.Level) time.Duration {
+	if l == f.level || f.changed.IsZero() {
+		return 0
+	}
+
+	limit := f.MinWriteInterval
+	if l == gpio.Low {
+		limit = max(limit, f.MinOnTime)
+	}
+
+	return max(0, limit-f.clock().Now().Sub(f.changed))
+}
+
+// notify publishes the current state of the pin to Events, f.mu must be held
+func (f *PinCycle) notify() {
+	if f.Events == nil {
+		return
+	}
+
+	f.Events.Publish(f.event())
+}
+
+// Event returns the current state of the pin as an Event, as sent to new
+// subscribers before the changes published to Events
+func (f *PinCycle) Event() Event {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.event()
+}
+
+// event implements Event, f.mu must be held
+func (f *PinCycle) event() Event {
+	mode := f.mode
+	if f.cancel == nil {
+		mode = ModeOff
+	}
+
+	brightness := f.brightness()
+
+	return Event{
+		Time:       f.clock().Now(),
+		Pin:        f.Pin.Name(),
+		Mode:       mode,
+		Level:      f.level.String(),
+		Brightness: &brightness,
+	}
+}
+
+// bounds returns MinInterval and MaxInterval with the defaults applied
+func (f *PinCycle) bounds() (time.Duration, time.Duration) {
+	min, max := f.MinInterval, f.MaxInterval
+	if min == 0 {
+		min = DefaultMinInterval
+	}
+
+	if max == 0 {
+		max = DefaultMaxInterval
+	}
+
+	return min, max
+}
+
+// interval returns a random time to wait before the next flip, f.mu must be
+// held as rand.Rand is not safe for concurrent use
+func (f *PinCycle) interval() time.Duration {
+	min, max := f.bounds()
+	if max <= min {
+		return min
+	}
+
+	if f.Rand != nil {
+		return min + time.Duration(f.Rand.Int63n(int64(max-min)))
+	}
+
+	return min + time.Duration(rand.Int63n(int64(max-min)))
+}
+
+// Wait blocks until any goroutines started for the pin have exited or the
+// context is done
+func (f *PinCycle) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		f.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// clock returns Clock or SystemClock when it is not set
+func (f *PinCycle) clock() Clock {
+	return clockOr(f.Clock)
+}
+
+// sleep pauses for d as measured by the clock of the pin, returning false if
+// ctx is cancelled first
+func (f *PinCycle) sleep(ctx context.Context, d time.Duration) bool {
+	defer f.rest()()
+	return sleepClock(ctx, f.clock(), d)
+}
+
+// sleep pauses for d, returning false if ctx is cancelled first
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
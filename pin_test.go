@@ -0,0 +1,488 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"periph.io/x/periph/conn/gpio"
+	"periph.io/x/periph/conn/gpio/gpioreg"
+	"periph.io/x/periph/conn/gpio/gpiotest"
+)
+
+func TestMain(m *testing.M) {
+	logger = newLogger(LogFormatText, io.Discard)
+	os.Exit(m.Run())
+}
+
+// fakePin is a Pin which records every level written to it
+type fakePin struct {
+	mu     sync.Mutex
+	name   string
+	levels []gpio.Level
+	err    error
+}
+
+func (p *fakePin) Out(l gpio.Level) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		return p.err
+	}
+
+	p.levels = append(p.levels, l)
+	return nil
+}
+
+func (p *fakePin) Name() string { return p.name }
+
+// Levels returns a copy of the levels written so far
+func (p *fakePin) Levels() []gpio.Level {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]gpio.Level(nil), p.levels...)
+}
+
+// newTestPin returns an unregistered gpiotest pin called name
+func newTestPin(name string) *gpiotest.Pin {
+	return &gpiotest.Pin{N: name, EdgesChan: make(chan gpio.Level)}
+}
+
+// waitFor polls cond until it is true, failing the test after five seconds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	for end := time.Now().Add(5 * time.Second); !cond(); {
+		if time.Now().After(end) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestStopEndsLow(t *testing.T) {
+	tests := []struct {
+		name  string
+		start func(ctx context.Context, f *PinCycle)
+	}{
+		{"idle", func(ctx context.Context, f *PinCycle) {}},
+		{"cycling", func(ctx context.Context, f *PinCycle) { f.Cycle(ctx) }},
+		{"stopped twice", func(ctx context.Context, f *PinCycle) { f.Stop(ctx) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			p := &fakePin{name: "GPIO14"}
+			f := &PinCycle{Pin: p}
+
+			tt.start(ctx, f)
+			if err := f.Stop(ctx); err != nil {
+				t.Fatalf("Stop returned %s", err)
+			}
+
+			levels := p.Levels()
+			if len(levels) == 0 || levels[len(levels)-1] != gpio.Low {
+				t.Fatalf("expected the last write to be Low, got %v", levels)
+			}
+
+			if f.Running() {
+				t.Fatal("expected the pin not to be running after Stop")
+			}
+
+			wait, cancel := context.WithTimeout(ctx, 2*time.Second)
+			defer cancel()
+			if err := f.Wait(wait); err != nil {
+				t.Fatalf("the cycling goroutine did not exit: %s", err)
+			}
+
+			if n := len(p.Levels()); n != len(levels) {
+				t.Fatalf("expected no writes after Stop, got %d more", n-len(levels))
+			}
+		})
+	}
+}
+
+func TestStopReturnsWriteError(t *testing.T) {
+	ctx := context.Background()
+	p := &fakePin{name: "GPIO14", err: errors.New("broken")}
+	f := &PinCycle{Pin: p}
+
+	if err := f.Stop(ctx); err == nil {
+		t.Fatal("expected Stop to return the error writing to the pin")
+	}
+}
+
+func TestCycleAlternates(t *testing.T) {
+	ctx := context.Background()
+	p := &fakePin{name: "GPIO14"}
+	f := &PinCycle{Pin: p}
+
+	f.Cycle(ctx)
+	waitFor(t, "the pin to flip", func() bool { return len(p.Levels()) >= 3 })
+	f.Stop(ctx)
+
+	levels := p.Levels()
+	want := gpio.High
+	// the final write is Stop, which may repeat the last level
+	for i, l := range levels[:len(levels)-1] {
+		if l != want {
+			t.Fatalf("write %d was %s, expected %s in %v", i, l, want, levels)
+		}
+
+		want = !want
+	}
+
+	if levels[len(levels)-1] != gpio.Low {
+		t.Fatalf("expected Stop to write Low, got %v", levels)
+	}
+}
+
+func TestCycleStopsAfterMaxFailures(t *testing.T) {
+	ctx := context.Background()
+	p := &fakePin{name: "GPIO14", err: errors.New("broken")}
+	f := &PinCycle{Pin: p, MaxFailures: 1}
+
+	f.Cycle(ctx)
+
+	wait, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	if err := f.Wait(wait); err != nil {
+		t.Fatalf("expected the cycle to give up after a failed write: %s", err)
+	}
+
+	if f.Running() {
+		t.Fatal("expected the pin not to be running after giving up")
+	}
+}
+
+func TestCycleIsIdempotent(t *testing.T) {
+	ctx := context.Background()
+	p := &fakePin{name: "GPIO14"}
+	f := &PinCycle{Pin: p, MinInterval: time.Millisecond, MaxInterval: time.Millisecond}
+	m := NewManager(map[int]*PinCycle{14: f}, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 20; j++ {
+				m.On(ctx, "14", 0)
+				m.On(ctx, "14", 0)
+				m.Off(ctx, "14")
+			}
+		}()
+	}
+	wg.Wait()
+
+	m.On(ctx, "14", 0)
+	m.On(ctx, "14", 0)
+	if n := f.Goroutines(); n != 1 {
+		t.Fatalf("expected one goroutine after cycling twice, got %d", n)
+	}
+
+	if err := m.Off(ctx, "14"); err != nil {
+		t.Fatalf("Off returned %s", err)
+	}
+
+	wait, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if err := f.Wait(wait); err != nil {
+		t.Fatalf("goroutines of the pin did not exit: %s", err)
+	}
+
+	if n := m.Goroutines(); n != 0 {
+		t.Fatalf("expected no goroutines once off, got %d", n)
+	}
+
+	if levels := p.Levels(); levels[len(levels)-1] != gpio.Low {
+		t.Fatalf("expected the pin to end Low, got %s", levels[len(levels)-1])
+	}
+}
+
+func TestInvertedLevels(t *testing.T) {
+	tests := []struct {
+		name     string
+		inverted bool
+		offMode  OffMode
+		on       bool
+		physical gpio.Level
+	}{
+		{"on", false, OffLow, true, gpio.High},
+		{"inverted on", true, OffLow, true, gpio.Low},
+		{"stop", false, OffLow, false, gpio.Low},
+		{"inverted stop", true, OffLow, false, gpio.High},
+		{"stop high", false, OffHigh, false, gpio.High},
+		{"inverted stop high", true, OffHigh, false, gpio.Low},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			p := newTestPin("GPIO14")
+			f := &PinCycle{Pin: p, Inverted: tt.inverted, OffMode: tt.offMode}
+
+			if err := f.On(ctx); err != nil {
+				t.Fatalf("On returned %s", err)
+			}
+
+			if !tt.on {
+				if err := f.Stop(ctx); err != nil {
+					t.Fatalf("Stop returned %s", err)
+				}
+			}
+
+			if l := p.Read(); l != tt.physical {
+				t.Fatalf("expected the pin to be driven %s, got %s", tt.physical, l)
+			}
+
+			// State reports the logical level whatever the wiring
+			want := gpio.Level(tt.on || tt.offMode == OffHigh)
+			if _, l := f.State(); l != want {
+				t.Fatalf("expected State to report %s, got %s", want, l)
+			}
+		})
+	}
+}
+
+func TestStopInput(t *testing.T) {
+	for _, inverted := range []bool{false, true} {
+		ctx := context.Background()
+		p := newTestPin("GPIO14")
+		f := &PinCycle{Pin: p, Inverted: inverted, OffMode: OffInput}
+
+		f.On(ctx)
+		if err := f.Stop(ctx); err != nil {
+			t.Fatalf("Stop returned %s", err)
+		}
+
+		if pull := p.Pull(); pull != gpio.Float {
+			t.Fatalf("expected the pin to be a floating input with inverted %t, got %s", inverted, pull)
+		}
+
+		if _, l := f.State(); l != gpio.Low {
+			t.Fatalf("expected an input to be reported Low, got %s", l)
+		}
+	}
+}
+
+// recordingPin is a gpiotest pin which keeps the history of levels written
+type recordingPin struct {
+	*gpiotest.Pin
+
+	mu      sync.Mutex
+	history []gpio.Level
+}
+
+func (p *recordingPin) Out(l gpio.Level) error {
+	p.mu.Lock()
+	p.history = append(p.history, l)
+	p.mu.Unlock()
+
+	return p.Pin.Out(l)
+}
+
+// History returns a copy of the levels written so far
+func (p *recordingPin) History() []gpio.Level {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]gpio.Level(nil), p.history...)
+}
+
+// registerTestPin registers a recording gpiotest pin called name with the
+// alias, and returns the pin and the PinIO found in the registry by the alias
+func registerTestPin(t *testing.T, name, alias string) (*recordingPin, gpio.PinIO) {
+	t.Helper()
+
+	p := &recordingPin{Pin: newTestPin(name)}
+	if err := gpioreg.Register(p); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := gpioreg.RegisterAlias(alias, name); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		gpioreg.Unregister(alias)
+		gpioreg.Unregister(name)
+	})
+
+	io := gpioreg.ByName(alias)
+	if io == nil {
+		t.Fatalf("%s is not registered", alias)
+	}
+
+	return p, io
+}
+
+func TestCycleRegisteredPins(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  Pattern
+		inverted bool
+	}{
+		{"random", PatternRandom, false},
+		{"steady", PatternSteady, false},
+		{"inverted", PatternRandom, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			p, io := registerTestPin(t, "TEST_GPIO14", "TEST_14")
+
+			f := &PinCycle{
+				Pin:         io,
+				MinInterval: time.Millisecond,
+				MaxInterval: 3 * time.Millisecond,
+				Rand:        rand.New(rand.NewSource(62)),
+				Inverted:    tt.inverted,
+			}
+			f.SetPattern(ctx, tt.pattern)
+
+			f.Cycle(ctx)
+			waitFor(t, "the pin to flip", func() bool { return len(p.History()) >= 8 })
+			if err := f.Stop(ctx); err != nil {
+				t.Fatalf("Stop returned %s", err)
+			}
+
+			on, off := gpio.High, gpio.Low
+			if tt.inverted {
+				on, off = off, on
+			}
+
+			history := p.History()
+			// the final write is Stop
+			writes := history[:len(history)-1]
+			want := on
+			for i, l := range writes {
+				if l != want {
+					t.Fatalf("write %d was %s, expected %s in %v", i, l, want, writes)
+				}
+
+				want = !want
+			}
+
+			if l := p.Read(); l != off {
+				t.Fatalf("expected Stop to leave the pin %s, got %s", off, l)
+			}
+
+			// a flip is counted just after the write, unless Stop came between
+			if flips := f.Flips(); flips != uint64(len(writes)) && flips != uint64(len(writes)-1) {
+				t.Fatalf("expected %d flips, got %d", len(writes), flips)
+			}
+		})
+	}
+}
+
+func TestStopLeavesRegisteredPinLow(t *testing.T) {
+	tests := []struct {
+		name  string
+		start func(ctx context.Context, f *PinCycle)
+	}{
+		{"idle", func(ctx context.Context, f *PinCycle) {}},
+		{"cycling", func(ctx context.Context, f *PinCycle) { f.Cycle(ctx) }},
+		{"solid", func(ctx context.Context, f *PinCycle) { f.On(ctx) }},
+		{"dimmed", func(ctx context.Context, f *PinCycle) { f.SetBrightness(ctx, 0.5) }},
+		{"cycling for", func(ctx context.Context, f *PinCycle) { f.CycleFor(ctx, time.Hour) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			p, io := registerTestPin(t, "TEST_GPIO15", "TEST_15")
+			p.Out(gpio.High)
+
+			f := &PinCycle{Pin: io, MinInterval: time.Millisecond, MaxInterval: time.Millisecond, Rand: rand.New(rand.NewSource(62))}
+			tt.start(ctx, f)
+			time.Sleep(5 * time.Millisecond)
+
+			if err := f.Stop(ctx); err != nil {
+				t.Fatalf("Stop returned %s", err)
+			}
+
+			if l := p.Read(); l != gpio.Low {
+				t.Fatalf("expected Stop to leave the pin Low, got %s", l)
+			}
+
+			if n := f.Goroutines(); n != 0 {
+				t.Fatalf("expected no goroutines after Stop, got %d", n)
+			}
+		})
+	}
+}
+
+func TestMinOnTimeDefersOff(t *testing.T) {
+	ctx := context.Background()
+	clock := NewFakeClock(time.Now())
+	p := &fakePin{name: "GPIO14"}
+	f := &PinCycle{Pin: p, Clock: clock, MinOnTime: time.Second}
+
+	f.On(ctx)
+	on := clock.Now()
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		f.Stop(ctx)
+	}()
+
+	// Stop waits on the clock for the rest of MinOnTime
+	waitForWaiters(t, clock, 1)
+	clock.Advance(999 * time.Millisecond)
+
+	select {
+	case <-stopped:
+		t.Fatal("expected Stop to wait for MinOnTime")
+	default:
+	}
+
+	if levels := p.Levels(); levels[len(levels)-1] != gpio.High {
+		t.Fatalf("expected the pin to still be High, got %v", levels)
+	}
+
+	clock.Advance(time.Millisecond)
+	<-stopped
+
+	if levels := p.Levels(); levels[len(levels)-1] != gpio.Low {
+		t.Fatalf("expected the pin to be Low once MinOnTime has passed, got %v", levels)
+	}
+
+	if d := f.changed.Sub(on); d != time.Second {
+		t.Fatalf("expected the pin to turn off after exactly 1s, got %s", d)
+	}
+}
+
+func TestMaxOnTimeForcesOff(t *testing.T) {
+	ctx := context.Background()
+	clock := NewFakeClock(time.Now())
+	p := &fakePin{name: "GPIO14"}
+	f := &PinCycle{Pin: p, Clock: clock, MaxOnTime: time.Minute}
+
+	f.On(ctx)
+	waitForWaiters(t, clock, 1)
+
+	clock.Advance(time.Minute - time.Second)
+	if mode, _ := f.State(); mode != ModeSolid {
+		t.Fatalf("expected the pin to stay on until MaxOnTime, got %s", mode)
+	}
+
+	clock.Advance(time.Second)
+	waitFor(t, "the pin to be stopped", func() bool { mode, _ := f.State(); return mode == ModeOff })
+
+	if levels := p.Levels(); levels[len(levels)-1] != gpio.Low {
+		t.Fatalf("expected the pin to be Low after MaxOnTime, got %v", levels)
+	}
+}
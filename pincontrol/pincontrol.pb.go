@@ -0,0 +1,769 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        (unknown)
+// source: pincontrol/pincontrol.proto
+
+// Package pincontrol is the gRPC interface to the pins, it shares its state
+// with the HTTP API.
+
+package pincontrol
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Action is a command accepted by SetPin
+type Action int32
+
+const (
+	Action_ACTION_UNSPECIFIED Action = 0
+	// ACTION_ON starts cycling the pin
+	Action_ACTION_ON Action = 1
+	// ACTION_OFF stops the pin
+	Action_ACTION_OFF Action = 2
+	// ACTION_SOLID turns the pin on without blinking
+	Action_ACTION_SOLID Action = 3
+)
+
+// Enum value maps for Action.
+var (
+	Action_name = map[int32]string{
+		0: "ACTION_UNSPECIFIED",
+		1: "ACTION_ON",
+		2: "ACTION_OFF",
+		3: "ACTION_SOLID",
+	}
+	Action_value = map[string]int32{
+		"ACTION_UNSPECIFIED": 0,
+		"ACTION_ON":          1,
+		"ACTION_OFF":         2,
+		"ACTION_SOLID":       3,
+	}
+)
+
+func (x Action) Enum() *Action {
+	p := new(Action)
+	*p = x
+	return p
+}
+
+func (x Action) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Action) Descriptor() protoreflect.EnumDescriptor {
+	return file_pincontrol_pincontrol_proto_enumTypes[0].Descriptor()
+}
+
+func (Action) Type() protoreflect.EnumType {
+	return &file_pincontrol_pincontrol_proto_enumTypes[0]
+}
+
+func (x Action) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Action.Descriptor instead.
+func (Action) EnumDescriptor() ([]byte, []int) {
+	return file_pincontrol_pincontrol_proto_rawDescGZIP(), []int{0}
+}
+
+type SetPinRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// pin is the GPIO number or alias of the pin
+	Pin    string `protobuf:"bytes,1,opt,name=pin,proto3" json:"pin,omitempty"`
+	Action Action `protobuf:"varint,2,opt,name=action,proto3,enum=pincontrol.Action" json:"action,omitempty"`
+	// duration_ms, for ACTION_ON, turns the pin off again after this many
+	// milliseconds, zero cycles until stopped
+	DurationMs    int64 `protobuf:"varint,3,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetPinRequest) Reset() {
+	*x = SetPinRequest{}
+	mi := &file_pincontrol_pincontrol_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetPinRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetPinRequest) ProtoMessage() {}
+
+func (x *SetPinRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pincontrol_pincontrol_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetPinRequest.ProtoReflect.Descriptor instead.
+func (*SetPinRequest) Descriptor() ([]byte, []int) {
+	return file_pincontrol_pincontrol_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *SetPinRequest) GetPin() string {
+	if x != nil {
+		return x.Pin
+	}
+	return ""
+}
+
+func (x *SetPinRequest) GetAction() Action {
+	if x != nil {
+		return x.Action
+	}
+	return Action_ACTION_UNSPECIFIED
+}
+
+func (x *SetPinRequest) GetDurationMs() int64 {
+	if x != nil {
+		return x.DurationMs
+	}
+	return 0
+}
+
+type GetStatusRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// pin is the GPIO number or alias of the pin, empty for every pin
+	Pin           string `protobuf:"bytes,1,opt,name=pin,proto3" json:"pin,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStatusRequest) Reset() {
+	*x = GetStatusRequest{}
+	mi := &file_pincontrol_pincontrol_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStatusRequest) ProtoMessage() {}
+
+func (x *GetStatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pincontrol_pincontrol_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStatusRequest.ProtoReflect.Descriptor instead.
+func (*GetStatusRequest) Descriptor() ([]byte, []int) {
+	return file_pincontrol_pincontrol_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *GetStatusRequest) GetPin() string {
+	if x != nil {
+		return x.Pin
+	}
+	return ""
+}
+
+type GetStatusResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Pins          []*PinStatus           `protobuf:"bytes,1,rep,name=pins,proto3" json:"pins,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStatusResponse) Reset() {
+	*x = GetStatusResponse{}
+	mi := &file_pincontrol_pincontrol_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStatusResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStatusResponse) ProtoMessage() {}
+
+func (x *GetStatusResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pincontrol_pincontrol_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStatusResponse.ProtoReflect.Descriptor instead.
+func (*GetStatusResponse) Descriptor() ([]byte, []int) {
+	return file_pincontrol_pincontrol_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *GetStatusResponse) GetPins() []*PinStatus {
+	if x != nil {
+		return x.Pins
+	}
+	return nil
+}
+
+type StreamEventsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamEventsRequest) Reset() {
+	*x = StreamEventsRequest{}
+	mi := &file_pincontrol_pincontrol_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamEventsRequest) ProtoMessage() {}
+
+func (x *StreamEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pincontrol_pincontrol_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamEventsRequest.ProtoReflect.Descriptor instead.
+func (*StreamEventsRequest) Descriptor() ([]byte, []int) {
+	return file_pincontrol_pincontrol_proto_rawDescGZIP(), []int{3}
+}
+
+// PinStatus mirrors the JSON returned by /status
+type PinStatus struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Gpio    int32                  `protobuf:"varint,1,opt,name=gpio,proto3" json:"gpio,omitempty"`
+	Alias   string                 `protobuf:"bytes,2,opt,name=alias,proto3" json:"alias,omitempty"`
+	Name    string                 `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"`
+	Running bool                   `protobuf:"varint,4,opt,name=running,proto3" json:"running,omitempty"`
+	Mode    string                 `protobuf:"bytes,5,opt,name=mode,proto3" json:"mode,omitempty"`
+	Pattern string                 `protobuf:"bytes,6,opt,name=pattern,proto3" json:"pattern,omitempty"`
+	Level   string                 `protobuf:"bytes,7,opt,name=level,proto3" json:"level,omitempty"`
+	// available is false for a pin which could not be initialised, error
+	// gives the reason
+	Available bool   `protobuf:"varint,8,opt,name=available,proto3" json:"available,omitempty"`
+	Error     string `protobuf:"bytes,9,opt,name=error,proto3" json:"error,omitempty"`
+	// failures is the number of consecutive failed writes and last_error the
+	// most recent write error
+	Failures  int32  `protobuf:"varint,10,opt,name=failures,proto3" json:"failures,omitempty"`
+	LastError string `protobuf:"bytes,11,opt,name=last_error,json=lastError,proto3" json:"last_error,omitempty"`
+	// brightness is the duty cycle the pin is driven at, 1 or 0 when it is
+	// simply on or off
+	Brightness float64 `protobuf:"fixed64,12,opt,name=brightness,proto3" json:"brightness,omitempty"`
+	// info is what the GPIO driver reports about an available pin
+	Info *PinInfo `protobuf:"bytes,13,opt,name=info,proto3" json:"info,omitempty"`
+	// source is the priority of the commands the pin follows, manual,
+	// schedule or default
+	Source string `protobuf:"bytes,14,opt,name=source,proto3" json:"source,omitempty"`
+	// disabled is set while every command for the pin is ignored
+	Disabled bool `protobuf:"varint,15,opt,name=disabled,proto3" json:"disabled,omitempty"`
+	// id addresses the pin, its GPIO number or board/pin for a pin of a GPIO
+	// expander, board is rpi for the native header
+	Id            string `protobuf:"bytes,16,opt,name=id,proto3" json:"id,omitempty"`
+	Board         string `protobuf:"bytes,17,opt,name=board,proto3" json:"board,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PinStatus) Reset() {
+	*x = PinStatus{}
+	mi := &file_pincontrol_pincontrol_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PinStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PinStatus) ProtoMessage() {}
+
+func (x *PinStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_pincontrol_pincontrol_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PinStatus.ProtoReflect.Descriptor instead.
+func (*PinStatus) Descriptor() ([]byte, []int) {
+	return file_pincontrol_pincontrol_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *PinStatus) GetGpio() int32 {
+	if x != nil {
+		return x.Gpio
+	}
+	return 0
+}
+
+func (x *PinStatus) GetAlias() string {
+	if x != nil {
+		return x.Alias
+	}
+	return ""
+}
+
+func (x *PinStatus) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *PinStatus) GetRunning() bool {
+	if x != nil {
+		return x.Running
+	}
+	return false
+}
+
+func (x *PinStatus) GetMode() string {
+	if x != nil {
+		return x.Mode
+	}
+	return ""
+}
+
+func (x *PinStatus) GetPattern() string {
+	if x != nil {
+		return x.Pattern
+	}
+	return ""
+}
+
+func (x *PinStatus) GetLevel() string {
+	if x != nil {
+		return x.Level
+	}
+	return ""
+}
+
+func (x *PinStatus) GetAvailable() bool {
+	if x != nil {
+		return x.Available
+	}
+	return false
+}
+
+func (x *PinStatus) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *PinStatus) GetFailures() int32 {
+	if x != nil {
+		return x.Failures
+	}
+	return 0
+}
+
+func (x *PinStatus) GetLastError() string {
+	if x != nil {
+		return x.LastError
+	}
+	return ""
+}
+
+func (x *PinStatus) GetBrightness() float64 {
+	if x != nil {
+		return x.Brightness
+	}
+	return 0
+}
+
+func (x *PinStatus) GetInfo() *PinInfo {
+	if x != nil {
+		return x.Info
+	}
+	return nil
+}
+
+func (x *PinStatus) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *PinStatus) GetDisabled() bool {
+	if x != nil {
+		return x.Disabled
+	}
+	return false
+}
+
+func (x *PinStatus) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *PinStatus) GetBoard() string {
+	if x != nil {
+		return x.Board
+	}
+	return ""
+}
+
+// PinInfo is what the GPIO driver knows about a pin, fields it does not
+// report are left empty
+type PinInfo struct {
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	Number             int32                  `protobuf:"varint,1,opt,name=number,proto3" json:"number,omitempty"`
+	Function           string                 `protobuf:"bytes,2,opt,name=function,proto3" json:"function,omitempty"`
+	SupportedFunctions []string               `protobuf:"bytes,3,rep,name=supported_functions,json=supportedFunctions,proto3" json:"supported_functions,omitempty"`
+	// header and header_pin are the physical header and 1 based pin the GPIO
+	// is wired to
+	Header        string `protobuf:"bytes,4,opt,name=header,proto3" json:"header,omitempty"`
+	HeaderPin     int32  `protobuf:"varint,5,opt,name=header_pin,json=headerPin,proto3" json:"header_pin,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PinInfo) Reset() {
+	*x = PinInfo{}
+	mi := &file_pincontrol_pincontrol_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PinInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PinInfo) ProtoMessage() {}
+
+func (x *PinInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_pincontrol_pincontrol_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PinInfo.ProtoReflect.Descriptor instead.
+func (*PinInfo) Descriptor() ([]byte, []int) {
+	return file_pincontrol_pincontrol_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *PinInfo) GetNumber() int32 {
+	if x != nil {
+		return x.Number
+	}
+	return 0
+}
+
+func (x *PinInfo) GetFunction() string {
+	if x != nil {
+		return x.Function
+	}
+	return ""
+}
+
+func (x *PinInfo) GetSupportedFunctions() []string {
+	if x != nil {
+		return x.SupportedFunctions
+	}
+	return nil
+}
+
+func (x *PinInfo) GetHeader() string {
+	if x != nil {
+		return x.Header
+	}
+	return ""
+}
+
+func (x *PinInfo) GetHeaderPin() int32 {
+	if x != nil {
+		return x.HeaderPin
+	}
+	return 0
+}
+
+// Event describes a change to the mode or level of a pin, or an edge seen on
+// an input pin
+type Event struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// time_unix_nano is when the change happened in nanoseconds since the
+	// Unix epoch
+	TimeUnixNano int64  `protobuf:"varint,1,opt,name=time_unix_nano,json=timeUnixNano,proto3" json:"time_unix_nano,omitempty"`
+	Pin          string `protobuf:"bytes,2,opt,name=pin,proto3" json:"pin,omitempty"`
+	// mode is empty for input pins
+	Mode  string `protobuf:"bytes,3,opt,name=mode,proto3" json:"mode,omitempty"`
+	Level string `protobuf:"bytes,4,opt,name=level,proto3" json:"level,omitempty"`
+	// edge is rising or falling for input pins, raw is set for edges reported
+	// before debouncing
+	Edge string `protobuf:"bytes,5,opt,name=edge,proto3" json:"edge,omitempty"`
+	Raw  bool   `protobuf:"varint,6,opt,name=raw,proto3" json:"raw,omitempty"`
+	// brightness is the duty cycle of an output pin, unset for input pins
+	Brightness    *float64 `protobuf:"fixed64,7,opt,name=brightness,proto3,oneof" json:"brightness,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_pincontrol_pincontrol_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_pincontrol_pincontrol_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_pincontrol_pincontrol_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Event) GetTimeUnixNano() int64 {
+	if x != nil {
+		return x.TimeUnixNano
+	}
+	return 0
+}
+
+func (x *Event) GetPin() string {
+	if x != nil {
+		return x.Pin
+	}
+	return ""
+}
+
+func (x *Event) GetMode() string {
+	if x != nil {
+		return x.Mode
+	}
+	return ""
+}
+
+func (x *Event) GetLevel() string {
+	if x != nil {
+		return x.Level
+	}
+	return ""
+}
+
+func (x *Event) GetEdge() string {
+	if x != nil {
+		return x.Edge
+	}
+	return ""
+}
+
+func (x *Event) GetRaw() bool {
+	if x != nil {
+		return x.Raw
+	}
+	return false
+}
+
+func (x *Event) GetBrightness() float64 {
+	if x != nil && x.Brightness != nil {
+		return *x.Brightness
+	}
+	return 0
+}
+
+var File_pincontrol_pincontrol_proto protoreflect.FileDescriptor
+
+const file_pincontrol_pincontrol_proto_rawDesc = "" +
+	"\n" +
+	"\x1bpincontrol/pincontrol.proto\x12\n" +
+	"pincontrol\"n\n" +
+	"\rSetPinRequest\x12\x10\n" +
+	"\x03pin\x18\x01 \x01(\tR\x03pin\x12*\n" +
+	"\x06action\x18\x02 \x01(\x0e2\x12.pincontrol.ActionR\x06action\x12\x1f\n" +
+	"\vduration_ms\x18\x03 \x01(\x03R\n" +
+	"durationMs\"$\n" +
+	"\x10GetStatusRequest\x12\x10\n" +
+	"\x03pin\x18\x01 \x01(\tR\x03pin\">\n" +
+	"\x11GetStatusResponse\x12)\n" +
+	"\x04pins\x18\x01 \x03(\v2\x15.pincontrol.PinStatusR\x04pins\"\x15\n" +
+	"\x13StreamEventsRequest\"\xb9\x03\n" +
+	"\tPinStatus\x12\x12\n" +
+	"\x04gpio\x18\x01 \x01(\x05R\x04gpio\x12\x14\n" +
+	"\x05alias\x18\x02 \x01(\tR\x05alias\x12\x12\n" +
+	"\x04name\x18\x03 \x01(\tR\x04name\x12\x18\n" +
+	"\arunning\x18\x04 \x01(\bR\arunning\x12\x12\n" +
+	"\x04mode\x18\x05 \x01(\tR\x04mode\x12\x18\n" +
+	"\apattern\x18\x06 \x01(\tR\apattern\x12\x14\n" +
+	"\x05level\x18\a \x01(\tR\x05level\x12\x1c\n" +
+	"\tavailable\x18\b \x01(\bR\tavailable\x12\x14\n" +
+	"\x05error\x18\t \x01(\tR\x05error\x12\x1a\n" +
+	"\bfailures\x18\n" +
+	" \x01(\x05R\bfailures\x12\x1d\n" +
+	"\n" +
+	"last_error\x18\v \x01(\tR\tlastError\x12\x1e\n" +
+	"\n" +
+	"brightness\x18\f \x01(\x01R\n" +
+	"brightness\x12'\n" +
+	"\x04info\x18\r \x01(\v2\x13.pincontrol.PinInfoR\x04info\x12\x16\n" +
+	"\x06source\x18\x0e \x01(\tR\x06source\x12\x1a\n" +
+	"\bdisabled\x18\x0f \x01(\bR\bdisabled\x12\x0e\n" +
+	"\x02id\x18\x10 \x01(\tR\x02id\x12\x14\n" +
+	"\x05board\x18\x11 \x01(\tR\x05board\"\xa5\x01\n" +
+	"\aPinInfo\x12\x16\n" +
+	"\x06number\x18\x01 \x01(\x05R\x06number\x12\x1a\n" +
+	"\bfunction\x18\x02 \x01(\tR\bfunction\x12/\n" +
+	"\x13supported_functions\x18\x03 \x03(\tR\x12supportedFunctions\x12\x16\n" +
+	"\x06header\x18\x04 \x01(\tR\x06header\x12\x1d\n" +
+	"\n" +
+	"header_pin\x18\x05 \x01(\x05R\theaderPin\"\xc3\x01\n" +
+	"\x05Event\x12$\n" +
+	"\x0etime_unix_nano\x18\x01 \x01(\x03R\ftimeUnixNano\x12\x10\n" +
+	"\x03pin\x18\x02 \x01(\tR\x03pin\x12\x12\n" +
+	"\x04mode\x18\x03 \x01(\tR\x04mode\x12\x14\n" +
+	"\x05level\x18\x04 \x01(\tR\x05level\x12\x12\n" +
+	"\x04edge\x18\x05 \x01(\tR\x04edge\x12\x10\n" +
+	"\x03raw\x18\x06 \x01(\bR\x03raw\x12#\n" +
+	"\n" +
+	"brightness\x18\a \x01(\x01H\x00R\n" +
+	"brightness\x88\x01\x01B\r\n" +
+	"\v_brightness*Q\n" +
+	"\x06Action\x12\x16\n" +
+	"\x12ACTION_UNSPECIFIED\x10\x00\x12\r\n" +
+	"\tACTION_ON\x10\x01\x12\x0e\n" +
+	"\n" +
+	"ACTION_OFF\x10\x02\x12\x10\n" +
+	"\fACTION_SOLID\x10\x032\xd8\x01\n" +
+	"\n" +
+	"PinControl\x12:\n" +
+	"\x06SetPin\x12\x19.pincontrol.SetPinRequest\x1a\x15.pincontrol.PinStatus\x12H\n" +
+	"\tGetStatus\x12\x1c.pincontrol.GetStatusRequest\x1a\x1d.pincontrol.GetStatusResponse\x12D\n" +
+	"\fStreamEvents\x12\x1f.pincontrol.StreamEventsRequest\x1a\x11.pincontrol.Event0\x01B7Z5github.com/nicholasjackson/pi-gpio-project/pincontrolb\x06proto3"
+
+var (
+	file_pincontrol_pincontrol_proto_rawDescOnce sync.Once
+	file_pincontrol_pincontrol_proto_rawDescData []byte
+)
+
+func file_pincontrol_pincontrol_proto_rawDescGZIP() []byte {
+	file_pincontrol_pincontrol_proto_rawDescOnce.Do(func() {
+		file_pincontrol_pincontrol_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_pincontrol_pincontrol_proto_rawDesc), len(file_pincontrol_pincontrol_proto_rawDesc)))
+	})
+	return file_pincontrol_pincontrol_proto_rawDescData
+}
+
+var file_pincontrol_pincontrol_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_pincontrol_pincontrol_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_pincontrol_pincontrol_proto_goTypes = []any{
+	(Action)(0),                 // 0: pincontrol.Action
+	(*SetPinRequest)(nil),       // 1: pincontrol.SetPinRequest
+	(*GetStatusRequest)(nil),    // 2: pincontrol.GetStatusRequest
+	(*GetStatusResponse)(nil),   // 3: pincontrol.GetStatusResponse
+	(*StreamEventsRequest)(nil), // 4: pincontrol.StreamEventsRequest
+	(*PinStatus)(nil),           // 5: pincontrol.PinStatus
+	(*PinInfo)(nil),             // 6: pincontrol.PinInfo
+	(*Event)(nil),               // 7: pincontrol.Event
+}
+var file_pincontrol_pincontrol_proto_depIdxs = []int32{
+	0, // 0: pincontrol.SetPinRequest.action:type_name -> pincontrol.Action
+	5, // 1: pincontrol.GetStatusResponse.pins:type_name -> pincontrol.PinStatus
+	6, // 2: pincontrol.PinStatus.info:type_name -> pincontrol.PinInfo
+	1, // 3: pincontrol.PinControl.SetPin:input_type -> pincontrol.SetPinRequest
+	2, // 4: pincontrol.PinControl.GetStatus:input_type -> pincontrol.GetStatusRequest
+	4, // 5: pincontrol.PinControl.StreamEvents:input_type -> pincontrol.StreamEventsRequest
+	5, // 6: pincontrol.PinControl.SetPin:output_type -> pincontrol.PinStatus
+	3, // 7: pincontrol.PinControl.GetStatus:output_type -> pincontrol.GetStatusResponse
+	7, // 8: pincontrol.PinControl.StreamEvents:output_type -> pincontrol.Event
+	6, // [6:9] is the sub-list for method output_type
+	3, // [3:6] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_pincontrol_pincontrol_proto_init() }
+func file_pincontrol_pincontrol_proto_init() {
+	if File_pincontrol_pincontrol_proto != nil {
+		return
+	}
+	file_pincontrol_pincontrol_proto_msgTypes[6].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_pincontrol_pincontrol_proto_rawDesc), len(file_pincontrol_pincontrol_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   7,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_pincontrol_pincontrol_proto_goTypes,
+		DependencyIndexes: file_pincontrol_pincontrol_proto_depIdxs,
+		EnumInfos:         file_pincontrol_pincontrol_proto_enumTypes,
+		MessageInfos:      file_pincontrol_pincontrol_proto_msgTypes,
+	}.Build()
+	File_pincontrol_pincontrol_proto = out.File
+	file_pincontrol_pincontrol_proto_goTypes = nil
+	file_pincontrol_pincontrol_proto_depIdxs = nil
+}
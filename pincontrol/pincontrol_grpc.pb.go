@@ -0,0 +1,216 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: pincontrol/pincontrol.proto
+
+// Package pincontrol is the gRPC interface to the pins, it shares its state
+// with the HTTP API.
+
+package pincontrol
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	PinControl_SetPin_FullMethodName       = "/pincontrol.PinControl/SetPin"
+	PinControl_GetStatus_FullMethodName    = "/pincontrol.PinControl/GetStatus"
+	PinControl_StreamEvents_FullMethodName = "/pincontrol.PinControl/StreamEvents"
+)
+
+// PinControlClient is the client API for PinControl service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// PinControl turns pins on and off and reports their state
+type PinControlClient interface {
+	// SetPin applies an action to a single pin and returns its new state
+	SetPin(ctx context.Context, in *SetPinRequest, opts ...grpc.CallOption) (*PinStatus, error)
+	// GetStatus returns the state of one pin, or of every pin when pin is empty
+	GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (*GetStatusResponse, error)
+	// StreamEvents sends the state of every pin followed by each change, the
+	// same events as the WebSocket feed
+	StreamEvents(ctx context.Context, in *StreamEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error)
+}
+
+type pinControlClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPinControlClient(cc grpc.ClientConnInterface) PinControlClient {
+	return &pinControlClient{cc}
+}
+
+func (c *pinControlClient) SetPin(ctx context.Context, in *SetPinRequest, opts ...grpc.CallOption) (*PinStatus, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PinStatus)
+	err := c.cc.Invoke(ctx, PinControl_SetPin_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pinControlClient) GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (*GetStatusResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetStatusResponse)
+	err := c.cc.Invoke(ctx, PinControl_GetStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pinControlClient) StreamEvents(ctx context.Context, in *StreamEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &PinControl_ServiceDesc.Streams[0], PinControl_StreamEvents_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamEventsRequest, Event]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PinControl_StreamEventsClient = grpc.ServerStreamingClient[Event]
+
+// PinControlServer is the server API for PinControl service.
+// All implementations must embed UnimplementedPinControlServer
+// for forward compatibility.
+//
+// PinControl turns pins on and off and reports their state
+type PinControlServer interface {
+	// SetPin applies an action to a single pin and returns its new state
+	SetPin(context.Context, *SetPinRequest) (*PinStatus, error)
+	// GetStatus returns the state of one pin, or of every pin when pin is empty
+	GetStatus(context.Context, *GetStatusRequest) (*GetStatusResponse, error)
+	// StreamEvents sends the state of every pin followed by each change, the
+	// same events as the WebSocket feed
+	StreamEvents(*StreamEventsRequest, grpc.ServerStreamingServer[Event]) error
+	mustEmbedUnimplementedPinControlServer()
+}
+
+// UnimplementedPinControlServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedPinControlServer struct{}
+
+func (UnimplementedPinControlServer) SetPin(context.Context, *SetPinRequest) (*PinStatus, error) {
+	return nil, status.Error(codes.Unimplemented, "method SetPin not implemented")
+}
+func (UnimplementedPinControlServer) GetStatus(context.Context, *GetStatusRequest) (*GetStatusResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetStatus not implemented")
+}
+func (UnimplementedPinControlServer) StreamEvents(*StreamEventsRequest, grpc.ServerStreamingServer[Event]) error {
+	return status.Error(codes.Unimplemented, "method StreamEvents not implemented")
+}
+func (UnimplementedPinControlServer) mustEmbedUnimplementedPinControlServer() {}
+func (UnimplementedPinControlServer) testEmbeddedByValue()                    {}
+
+// UnsafePinControlServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PinControlServer will
+// result in compilation errors.
+type UnsafePinControlServer interface {
+	mustEmbedUnimplementedPinControlServer()
+}
+
+func RegisterPinControlServer(s grpc.ServiceRegistrar, srv PinControlServer) {
+	// If the following call panics, it indicates UnimplementedPinControlServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&PinControl_ServiceDesc, srv)
+}
+
+func _PinControl_SetPin_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetPinRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PinControlServer).SetPin(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PinControl_SetPin_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PinControlServer).SetPin(ctx, req.(*SetPinRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PinControl_GetStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PinControlServer).GetStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PinControl_GetStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PinControlServer).GetStatus(ctx, req.(*GetStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PinControl_StreamEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PinControlServer).StreamEvents(m, &grpc.GenericServerStream[StreamEventsRequest, Event]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PinControl_StreamEventsServer = grpc.ServerStreamingServer[Event]
+
+// PinControl_ServiceDesc is the grpc.ServiceDesc for PinControl service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var PinControl_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pincontrol.PinControl",
+	HandlerType: (*PinControlServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SetPin",
+			Handler:    _PinControl_SetPin_Handler,
+		},
+		{
+			MethodName: "GetStatus",
+			Handler:    _PinControl_GetStatus_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamEvents",
+			Handler:       _PinControl_StreamEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "pincontrol/pincontrol.proto",
+}
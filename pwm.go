@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"periph.io/x/periph/conn/gpio"
+)
+
+// Software PWM defaults and limits. Each period of the carrier costs two
+// writes and two timer wakeups, so CPU use grows linearly with the
+// frequency. A higher frequency avoids visible flicker, particularly on
+// camera, while more steps give smoother fades, but the shortest pulse is
+// one step of one period and the timer can not reliably sleep for less than
+// its granularity, typically 50-100us on a Pi. Around 1kHz with 100 steps
+// is a reasonable balance.
+const (
+	DefaultPWMFrequency = 1000
+	DefaultPWMSteps     = 100
+
+	MaxPWMFrequency = 10000
+	MaxPWMSteps     = 1000
+)
+
+// maxPWMJitter is the fraction by which the measured carrier period may
+// exceed the requested period before a warning is logged
+const maxPWMJitter = 0.2
+
+// pwmJitterWindow is how often the carrier period is measured
+const pwmJitterWindow = time.Second
+
+// fadeEventInterval is how often a fading pin publishes its brightness
+const fadeEventInterval = 100 * time.Millisecond
+
+// Curve controls how the duty cycle changes over the course of a fade
+type Curve int
+
+const (
+	// CurveLinear changes the duty cycle at a constant rate
+	CurveLinear Curve = iota
+	// CurvePerceptual compensates for the eye's roughly logarithmic response
+	// to brightness by interpolating through a gamma curve, which makes the
+	// fade look even rather than racing through the bright end
+	CurvePerceptual
+)
+
+const gamma = 2.2
+
+// at returns the duty cycle at progress p, between 0 and 1, of a fade
+func (c Curve) at(from, to, p float64) float64 {
+	if c == CurvePerceptual {
+		a, b := math.Pow(from, 1/gamma), math.Pow(to, 1/gamma)
+		return math.Pow(a+(b-a)*p, gamma)
+	}
+
+	return from + (to-from)*p
+}
+
+// SetBrightness dims the pin by toggling it in a background goroutine at
+// PWMFrequency with the given duty cycle, which is clamped to [0,1] and
+// rounded to PWMSteps. A duty of 0 is equivalent to calling Stop.
+func (f *PinCycle) SetBrightness(ctx context.Context, duty float64) error {
+	if duty <= 0 {
+		return f.Stop(ctx)
+	}
+
+	duty = clampDuty(duty)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.startAt(ctx, ModeDimmed, duty, func(ctx context.Context) {
+		f.pwm(ctx, duty)
+	})
+
+	return nil
+}
+
+// Brightness returns the duty cycle the pin is being driven at, 1 or 0 when
+// it is simply on or off
+func (f *PinCycle) Brightness() float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.brightness()
+}
+
+// Fade linearly ramps the brightness of the pin from its current value to
+// target over the given duration, the pin is then held at target or turned
+// off when target is 0
+func (f *PinCycle) Fade(ctx context.Context, target float64, over time.Duration) error {
+	return f.FadeCurve(ctx, target, over, CurveLinear)
+}
+
+// FadeCurve is Fade with the given Curve
+func (f *PinCycle) FadeCurve(ctx context.Context, target float64, over time.Duration, curve Curve) error {
+	if over <= 0 {
+		return f.SetBrightness(ctx, target)
+	}
+
+	target = clampDuty(target)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	from := f.brightness()
+	f.fadeTo = target
+	f.startAt(ctx, ModeFading, from, func(ctx context.Context) {
+		f.fade(ctx, from, target, over, curve)
+	})
+
+	return nil
+}
+
+// brightness returns the current duty cycle of the pin, which the goroutine
+// driving it updates as it changes, f.mu must be held
+func (f *PinCycle) brightness() float64 {
+	if f.duty > 0 {
+		return f.duty
+	}
+
+	if f.level == gpio.High {
+		return 1
+	}
+
+	return 0
+}
+
+func (f *PinCycle) fade(ctx context.Context, from, to float64, over time.Duration, curve Curve) {
+	c := f.carrier()
+	start := f.clock().Now()
+	published := start
+
+	for {
+		now := f.clock().Now()
+		p := float64(now.Sub(start)) / float64(over)
+		if p >= 1 {
+			break
+		}
+
+		duty := curve.at(from, to, p)
+
+		f.mu.Lock()
+		if ctx.Err() == nil {
+			f.duty = duty
+
+			if now.Sub(published) >= fadeEventInterval {
+				published = now
+				f.notify()
+			}
+		}
+		f.mu.Unlock()
+
+		if !c.pulse(ctx, duty) {
+			return
+		}
+	}
+
+	if to == 0 {
+		if f.write(ctx, gpio.Low) == nil {
+			f.finish(ctx)
+		}
+		return
+	}
+
+	f.mu.Lock()
+	if ctx.Err() == nil {
+		f.mode = ModeDimmed
+		f.duty = to
+		f.notify()
+	}
+	f.mu.Unlock()
+
+	f.pwm(ctx, to)
+}
+
+func (f *PinCycle) pwm(ctx context.Context, duty float64) {
+	// fully on, there is nothing to toggle
+	if duty >= 1 {
+		if f.write(ctx, gpio.High) == nil {
+			defer f.rest()()
+			<-ctx.Done()
+		}
+		return
+	}
+
+	c := f.carrier()
+	for c.pulse(ctx, duty) {
+	}
+}
+
+func clampDuty(duty float64) float64 {
+	return math.Max(0, math.Min(1, duty))
+}
+
+// carrier drives the PWM periods for a single goroutine and measures how
+// closely they keep to the requested frequency
+type carrier struct {
+	f      *PinCycle
+	period time.Duration
+	steps  int
+
+	window time.Time
+	pulses int
+	warned bool
+}
+
+// carrier returns a carrier for the PWM settings of the pin
+func (f *PinCycle) carrier() *carrier {
+	f.mu.Lock()
+	freq, steps := f.pwmSettings()
+	f.mu.Unlock()
+
+	return &carrier{f: f, period: time.Second / time.Duration(freq), steps: steps, window: f.clock().Now()}
+}
+
+// pwmSettings returns PWMFrequency and PWMSteps with the defaults applied
+func (f *PinCycle) pwmSettings() (int, int) {
+	freq, steps := f.PWMFrequency, f.PWMSteps
+	if freq <= 0 {
+		freq = DefaultPWMFrequency
+	}
+
+	if steps <= 0 {
+		steps = DefaultPWMSteps
+	}
+
+	return freq, steps
+}
+
+// pulse drives the pin for a single PWM period at the given duty cycle, it
+// returns false once ctx is cancelled or the pin has been stopped
+func (c *carrier) pulse(ctx context.Context, duty float64) bool {
+	duty = math.Round(duty*float64(c.steps)) / float64(c.steps)
+	on := time.Duration(float64(c.period) * duty)
+
+	if on > 0 {
+		if c.f.write(ctx, gpio.High) != nil || !c.f.sleep(ctx, on) {
+			return false
+		}
+	}
+
+	if on < c.period {
+		if c.f.write(ctx, gpio.Low) != nil || !c.f.sleep(ctx, c.period-on) {
+			return false
+		}
+	}
+
+	c.measure()
+	return true
+}
+
+// measure compares the time taken by the periods in the current window with
+// the requested period, warning once if the host can not keep up
+func (c *carrier) measure() {
+	c.pulses++
+
+	elapsed := c.f.clock().Now().Sub(c.window)
+	if elapsed < pwmJitterWindow {
+		return
+	}
+
+	expected := c.period * time.Duration(c.pulses)
+	if jitter := float64(elapsed-expected) / float64(expected); jitter > maxPWMJitter && !c.warned {
+		c.warned = true
+		logger.Warn("PWM can not keep up with the requested frequency, lower pwm_frequency_hz or pwm_steps",
+			"event", "pwm", "pin", c.f.Pin.Name(),
+			"frequency", int(time.Second/c.period),
+			"measured", int(float64(c.pulses)/elapsed.Seconds()))
+	}
+
+	c.window = c.f.clock().Now()
+	c.pulses = 0
+}
+
+// validPWM checks a PWM frequency in Hz and number of steps, zero selects the
+// default
+func validPWM(freq, steps int) error {
+	if freq < 0 || freq > MaxPWMFrequency {
+		return fmt.Errorf("PWM frequency must be between 1 and %dHz", MaxPWMFrequency)
+	}
+
+	if steps < 0 || steps > MaxPWMSteps {
+		return fmt.Errorf("PWM steps must be between 1 and %d", MaxPWMSteps)
+	}
+
+	return nil
+}
+
+// timerGranularity measures the shortest time the host reliably sleeps for,
+// the median of a few short sleeps
+func timerGranularity() time.Duration {
+	samples := make([]time.Duration, 21)
+	for i := range samples {
+		start := time.Now()
+		time.Sleep(time.Microsecond)
+		samples[i] = time.Since(start)
+	}
+
+	slices.Sort(samples)
+	return samples[len(samples)/2]
+}
+
+// checkPWM warns about pins whose PWM period is below the timer granularity,
+// as the carrier can not run at the requested frequency. Steps shorter than
+// the granularity are rounded by the timer rather than reported.
+func checkPWM(pins map[int]*PinCycle) {
+	granularity := timerGranularity()
+
+	for _, n := range pinNumbers(pins) {
+		p := pins[n]
+
+		freq, _ := p.pwmSettings()
+		if period := time.Second / time.Duration(freq); period < granularity {
+			logger.Warn("PWM period is shorter than the timer granularity, the frequency can not be reached",
+				"event", "pwm", "pin", p.Pin.Name(), "frequency", freq, "granularity", granularity.String())
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrQueueFull is returned by Enqueue when a pin already has pinQueueSize
+// commands waiting
+var ErrQueueFull = errors.New("too many commands waiting for the pin")
+
+// pinQueueSize is the number of commands which may wait for each pin
+const pinQueueSize = 32
+
+// command is a command waiting in a CommandQueue, coalesce marks on, off and
+// solid commands which a later one may replace
+type command struct {
+	ctx      context.Context
+	action   string
+	coalesce bool
+	fn       func(ctx context.Context) error
+}
+
+// CommandQueue applies the commands for a single pin in the order they were
+// enqueued on its own goroutine, so callers do not wait for MinOnTime, the
+// write rate limit or a ramp limit. A command marked to coalesce waits
+// Window for a later one to replace it, as Coalescer does.
+type CommandQueue struct {
+	Window time.Duration
+
+	commands chan command
+	depth    atomic.Int64
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// NewCommandQueue starts the goroutine applying the commands for pin, which is
+// only used for logging
+func NewCommandQueue(pin string, window time.Duration) *CommandQueue {
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &CommandQueue{
+		Window:   window,
+		commands: make(chan command, pinQueueSize),
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+
+	go q.run(pin)
+
+	return q
+}
+
+// Enqueue adds fn to the end of the queue, it is run with the values of ctx
+// but not its cancellation, so it still applies once the request has ended.
+// The position of fn in the queue is returned, 1 when nothing is ahead of
+// it.
+func (q *CommandQueue) Enqueue(ctx context.Context, action string, coalesce bool, fn func(ctx context.Context) error) (int, error) {
+	if q.ctx.Err() != nil {
+		return 0, ErrShuttingDown
+	}
+
+	select {
+	case q.commands <- command{context.WithoutCancel(ctx), action, coalesce, fn}:
+		return int(q.depth.Add(1)), nil
+	default:
+		return 0, ErrQueueFull
+	}
+}
+
+// Depth returns the number of commands waiting to be applied, including one
+// waiting to be coalesced
+func (q *CommandQueue) Depth() int {
+	return int(q.depth.Load())
+}
+
+// Discard drops every waiting command without running it
+func (q *CommandQueue) Discard() {
+	for {
+		select {
+		case <-q.commands:
+			q.depth.Add(-1)
+		default:
+			return
+		}
+	}
+}
+
+// Close drops the waiting commands and stops the queue, returning once any
+// command being applied has finished or ctx is done
+func (q *CommandQueue) Close(ctx context.Context) error {
+	q.cancel()
+	q.Discard()
+
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run applies the commands until the queue is closed
+func (q *CommandQueue) run(pin string) {
+	defer close(q.done)
+
+	for {
+		var c command
+		select {
+		case c = <-q.commands:
+		case <-q.ctx.Done():
+			return
+		}
+
+		for {
+			next, ok := q.coalesce(&c)
+			if q.ctx.Err() != nil {
+				return
+			}
+
+			if err := c.apply(); err != nil {
+				logger.ErrorContext(c.ctx, "Queued command failed", "event", "error", "pin", pin, "action", c.action, "error", err)
+			}
+			q.depth.Add(-1)
+
+			if !ok {
+				break
+			}
+			c = next
+		}
+	}
+}
+
+// coalesce waits Window when c may be coalesced and replaces it with the
+// latest of the commands which may also be coalesced that arrived meanwhile.
+// A following command which may not be coalesced is returned to be applied
+// next.
+func (q *CommandQueue) coalesce(c *command) (command, bool) {
+	if !c.coalesce || q.Window <= 0 || !sleep(q.ctx, q.Window) {
+		return command{}, false
+	}
+
+	for {
+		select {
+		case next := <-q.commands:
+			if !next.coalesce {
+				return next, true
+			}
+
+			*c = next
+			q.depth.Add(-1)
+		default:
+			return command{}, false
+		}
+	}
+}
+
+// Enqueue adds a command for the pin with GPIO number n to its queue and
+// returns its position, see CommandQueue. A queue is started for each pin the
+// first time it is used.
+func (m *Manager) Enqueue(ctx context.Context, n int, action string, coalesce bool, fn func(ctx context.Context) error) (int, error) {
+	m.queueMu.Lock()
+	if m.queuesClosed {
+		m.queueMu.Unlock()
+		return 0, ErrShuttingDown
+	}
+
+	if m.queues == nil {
+		m.queues = map[int]*CommandQueue{}
+	}
+
+	q, ok := m.queues[n]
+	if !ok {
+		p, ok := m.Pin(n)
+		if !ok {
+			m.queueMu.Unlock()
+			return 0, ErrUnknownPin
+		}
+
+		q = NewCommandQueue(p.Pin.Name(), m.CoalesceWindow)
+		m.queues[n] = q
+	}
+	m.queueMu.Unlock()
+
+	return q.Enqueue(ctx, action, coalesce, fn)
+}
+
+// QueueDepths returns the number of commands waiting for each pin with a
+// queue, keyed by GPIO number
+func (m *Manager) QueueDepths() map[int]int {
+	m.queueMu.Lock()
+	defer m.queueMu.Unlock()
+
+	depths := map[int]int{}
+	for n, q := range m.queues {
+		depths[n] = q.Depth()
+	}
+
+	return depths
+}
+
+// DiscardQueued drops every command waiting for any pin
+func (m *Manager) DiscardQueued() {
+	m.queueMu.Lock()
+	defer m.queueMu.Unlock()
+
+	for _, q := range m.queues {
+		q.Discard()
+	}
+}
+
+// dropQueue stops the queue of the pin with GPIO number n, once the pin has
+// been removed
+func (m *Manager) dropQueue(n int) {
+	m.queueMu.Lock()
+	q, ok := m.queues[n]
+	delete(m.queues, n)
+	m.queueMu.Unlock()
+
+	if ok {
+		q.Close(context.Background())
+	}
+}
+
+// CloseQueues drops the commands waiting for every pin and stops the queues,
+// returning once the commands being applied have finished or ctx is done.
+// Enqueue fails from then on.
+func (m *Manager) CloseQueues(ctx context.Context) error {
+	m.queueMu.Lock()
+	m.queuesClosed = true
+	queues := m.queues
+	m.queueMu.Unlock()
+
+	for _, q := range queues {
+		q.cancel()
+		q.Discard()
+	}
+
+	for _, q := range queues {
+		select {
+		case <-q.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestQueuedActionReply(t *testing.T) {
+	f := &PinCycle{Pin: &fakePin{name: "GPIO21"}}
+	m := NewManager(map[int]*PinCycle{21: f}, nil)
+	a := NewAPI(m, nil, nil, nil)
+	defer m.CloseQueues(context.Background())
+
+	// the first command waits for one to coalesce with, so neither applies
+	m.CoalesceWindow = time.Hour
+
+	post := func(action, accept string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/pins/21/"+action, nil)
+		r.Header.Set("Accept", accept)
+
+		rw := httptest.NewRecorder()
+		a.ServeHTTP(rw, r)
+		if rw.Code != http.StatusAccepted {
+			t.Fatalf("expected %s to be queued, got %d: %s", action, rw.Code, rw.Body)
+		}
+
+		return rw
+	}
+
+	var c QueuedCommand
+	if err := json.Unmarshal(post("on", "application/json").Body.Bytes(), &c); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (QueuedCommand{ID: "21", Action: "on", Position: 1}); c != want {
+		t.Fatalf("expected %+v, got %+v", want, c)
+	}
+
+	if text := post("toggle", "text/plain").Body.String(); text != "21 toggle queued at 2\n" {
+		t.Fatalf("expected the toggle queued behind on, got %q", text)
+	}
+
+	if mode, _ := f.State(); mode != ModeOff {
+		t.Fatalf("expected the pin not to be driven while queued, got %s", mode)
+	}
+}
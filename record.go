@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"periph.io/x/periph/conn/gpio"
+)
+
+// Errors returned by Recorder
+var (
+	ErrRecording    = errors.New("already recording")
+	ErrNotRecording = errors.New("not recording")
+)
+
+// errRecordingBehind ends a recording disconnected from the events for
+// falling behind
+var errRecordingBehind = errors.New("recording fell behind the events")
+
+// RecordedEvent is a single line of a recording, the level pin was set to
+// ms milliseconds after the recording started
+type RecordedEvent struct {
+	Pin   int    `json:"pin"`
+	Level string `json:"level"`
+	MS    int64  `json:"ms"`
+}
+
+// Recording is a sequence of level changes in the order they happened
+type Recording []RecordedEvent
+
+// Recorder writes every level change published to a Bus to a file as JSON
+// lines. Changes made by PWM, such as dimming or the pulse pattern, are not
+// published and so are not recorded.
+type Recorder struct {
+	events  *Bus
+	manager *Manager
+
+	// mu guards stop and done which are set while recording
+	mu   sync.Mutex
+	stop context.CancelFunc
+	done chan error
+}
+
+// NewRecorder creates a Recorder for the pins of manager publishing to
+// events
+func NewRecorder(events *Bus, manager *Manager) *Recorder {
+	return &Recorder{events: events, manager: manager}
+}
+
+// Start begins recording to path, replacing any existing file
+func (r *Recorder) Start(path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stop != nil {
+		return ErrRecording
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	ch, unsubscribe, err := r.events.Subscribe("recording " + path)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	// only changes of level are recorded, starting from the current levels
+	last := map[int]string{}
+	for n, p := range r.manager.Pins() {
+		_, l := p.State()
+		last[n] = l.String()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.stop = cancel
+	r.done = make(chan error, 1)
+
+	go func(done chan<- error) {
+		defer unsubscribe()
+
+		w := bufio.NewWriter(f)
+		enc := json.NewEncoder(w)
+		start := time.Now()
+
+		var err error
+		for err == nil {
+			select {
+			case e, ok := <-ch:
+				if !ok {
+					err = errRecordingBehind
+					continue
+				}
+
+				n, ok := r.manager.ByName(e.Pin)
+				if !ok || last[n] == e.Level {
+					continue
+				}
+
+				last[n] = e.Level
+				err = enc.Encode(RecordedEvent{Pin: n, Level: e.Level, MS: e.Time.Sub(start).Milliseconds()})
+			case <-ctx.Done():
+				done <- errors.Join(err, w.Flush(), f.Close())
+				return
+			}
+		}
+
+		// keep the events encoded before the error, a failed write to the
+		// file is returned again by the flush
+		logger.Error("Unable to write recording, stopping", "event", "error", "path", f.Name(), "error", err)
+		flushed := w.Flush()
+		if flushed == err {
+			flushed = nil
+		}
+
+		<-ctx.Done()
+		done <- errors.Join(err, flushed, f.Close())
+	}(r.done)
+
+	return nil
+}
+
+// Stop ends the recording and closes the file, returning any error writing
+// it
+func (r *Recorder) Stop() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stop == nil {
+		return ErrNotRecording
+	}
+
+	r.stop()
+	r.stop = nil
+
+	return <-r.done
+}
+
+// LoadRecording reads a recording written by Recorder from path
+func LoadRecording(path string) (Recording, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rec := Recording{}
+
+	s := bufio.NewScanner(f)
+	for line := 1; s.Scan(); line++ {
+		if strings.TrimSpace(s.Text()) == "" {
+			continue
+		}
+
+		e := RecordedEvent{}
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+
+		if e.Level != gpio.High.String() && e.Level != gpio.Low.String() {
+			return nil, fmt.Errorf("line %d: level must be High or Low", line)
+		}
+
+		rec = append(rec, e)
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(rec, func(i, j int) bool { return rec[i].MS < rec[j].MS })
+
+	return rec, nil
+}
+
+// Replay drives the pins through the recording with its original timing
+// divided by speed, so a speed of 2 plays twice as fast. It returns when the
+// recording ends, ctx is cancelled or every pin has been taken over by
+// another command, such as all the pins being turned off. Pins in the
+// recording which are not configured are skipped, the rest are turned off
+// when the replay ends.
+func (rec Recording) Replay(ctx context.Context, pins map[int]*PinCycle, speed float64) {
+	used := []*PinCycle{}
+	index := map[int]int{}
+	for _, e := range rec {
+		if _, seen := index[e.Pin]; seen {
+			continue
+		}
+
+		if p, ok := pins[e.Pin]; ok {
+			index[e.Pin] = len(used)
+			used = append(used, p)
+		}
+	}
+
+	claims := claimAll(ctx, used)
+	defer releaseAll(used, claims)
+
+	clock := clockOf(used)
+	start := clock.Now()
+	for _, e := range rec {
+		i, ok := index[e.Pin]
+		if !ok {
+			continue
+		}
+
+		at := time.Duration(float64(e.MS) * float64(time.Millisecond) / speed)
+		if !sleepClock(ctx, clock, start.Add(at).Sub(clock.Now())) || allDone(claims) {
+			return
+		}
+
+		l := gpio.Low
+		if e.Level == gpio.High.String() {
+			l = gpio.High
+		}
+
+		used[i].write(claims[i], l)
+	}
+}
+
+// recordingPath returns the path of the recording named by the file query
+// parameter, it must be a plain file name inside RecordingsDir
+func (a *API) recordingPath(r *http.Request) (string, error) {
+	name := r.URL.Query().Get("file")
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", errors.New("file must be a file name such as show.jsonl")
+	}
+
+	return filepath.Join(a.RecordingsDir, name), nil
+}
+
+// handleRecord handles /record/start and /record/stop
+func (a *API) handleRecord(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(rw, http.MethodPost)
+		return
+	}
+
+	switch strings.TrimPrefix(r.URL.Path, "/record/") {
+	case "start":
+		path, err := a.recordingPath(r)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := a.recorder.Start(path); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, ErrRecording) {
+				status = http.StatusConflict
+			}
+
+			http.Error(rw, err.Error(), status)
+			return
+		}
+
+		logger.InfoContext(r.Context(), "Recording", "event", "record", "path", path)
+	case "stop":
+		if err := a.recorder.Stop(); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, ErrNotRecording) {
+				status = http.StatusConflict
+			}
+
+			http.Error(rw, err.Error(), status)
+			return
+		}
+
+		logger.InfoContext(r.Context(), "Recording stopped", "event", "record")
+	default:
+		http.NotFound(rw, r)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// handleReplay plays a recording as a pattern, replacing any running one
+func (a *API) handleReplay(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(rw, http.MethodPost)
+		return
+	}
+
+	path, err := a.recordingPath(r)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	speed := 1.0
+	if v := r.URL.Query().Get("speed"); v != "" {
+		speed, err = strconv.ParseFloat(v, 64)
+		if err != nil || speed <= 0 {
+			http.Error(rw, "speed must be a number greater than 0", http.StatusBadRequest)
+			return
+		}
+	}
+
+	rec, err := LoadRecording(path)
+	if errors.Is(err, os.ErrNotExist) {
+		http.Error(rw, "recording not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(rw, fmt.Sprintf("invalid recording: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	logger.InfoContext(r.Context(), "Replay", "event", "replay", "path", path, "speed", speed, "events", len(rec))
+	a.startPattern(r.Context(), func(ctx context.Context) {
+		rec.Replay(ctx, a.manager.Pins(), speed)
+	})
+
+	writeJSON(rw, http.StatusOK, a.manager.Status())
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+)
+
+// panicked logs v, recovered from a panic, along with the stack of the
+// goroutine which panicked
+func panicked(ctx context.Context, v interface{}, args ...interface{}) {
+	args = append(args, "event", "panic", "error", fmt.Sprint(v), "stack", string(debug.Stack()))
+	logger.ErrorContext(ctx, "Recovered from panic", args...)
+}
+
+// recoverPin recovers a panic in the goroutine driving f, which owns ctx,
+// forcing the pin off unless another command has since taken it over so a
+// bug in a pattern leaves the pin off rather than crashing the server. The
+// panic is recorded as a failure of the pin, reported until it is reset. It
+// must be deferred.
+func (f *PinCycle) recoverPin(ctx context.Context) {
+	v := recover()
+	if v == nil {
+		return
+	}
+
+	panicked(ctx, v, "pin", f.Pin.Name())
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	// a pin which panics on every write panics forcing it off too
+	if err := safely(func() error { return f.force(ctx) }); err != nil {
+		logger.ErrorContext(ctx, "Unable to force pin off", "event", "error", "pin", f.Pin.Name(), "error", err)
+	}
+
+	// the goroutine may have panicked holding the lock, force then wrote
+	// to the hardware directly
+	if f.mu.TryLock() {
+		f.failures++
+		f.lastErr = fmt.Errorf("goroutine panicked: %v", v)
+		f.mu.Unlock()
+	}
+}
+
+// recoverPattern recovers a panic in a pattern driving several pins, the
+// pattern turns off the pins it still holds as it unwinds. It must be
+// deferred.
+func recoverPattern(ctx context.Context) {
+	if v := recover(); v != nil {
+		panicked(ctx, v)
+	}
+}
+
+// safely runs fn, returning a panic in it as an error
+func safely(fn func() error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("panicked: %v", v)
+		}
+	}()
+
+	return fn()
+}
+
+// apply runs c, a panic is recovered and returned as an error so the queue
+// carries on with the next command
+func (c command) apply() (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			panicked(c.ctx, v, "action", c.action)
+			err = fmt.Errorf("command panicked: %v", v)
+		}
+	}()
+
+	return c.fn(c.ctx)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"periph.io/x/periph/conn/gpio"
+)
+
+// panickingPin is a fakePin which panics whenever it is driven to level
+type panickingPin struct {
+	fakePin
+	level gpio.Level
+}
+
+func (p *panickingPin) Out(l gpio.Level) error {
+	if l == p.level {
+		panic("driving " + p.name + " " + l.String())
+	}
+
+	return p.fakePin.Out(l)
+}
+
+func TestPanickingPin(t *testing.T) {
+	p := &panickingPin{fakePin: fakePin{name: "GPIO14"}, level: gpio.High}
+	f := &PinCycle{Pin: p}
+	m := NewManager(map[int]*PinCycle{14: f}, nil)
+	h := recoverPanics(NewAPI(m, nil, nil, nil))
+	defer m.CloseQueues(context.Background())
+
+	serve := func(method, path, body string) int {
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rw.Code
+	}
+
+	t.Run("handler", func(t *testing.T) {
+		// PUT drives the pin in the handler itself
+		if code := serve(http.MethodPut, "/pins/14", `{"state":"solid"}`); code != http.StatusInternalServerError {
+			t.Fatalf("expected 500 from a handler which panicked, got %d", code)
+		}
+	})
+
+	t.Run("goroutine", func(t *testing.T) {
+		f.Reset(context.Background())
+
+		if code := serve(http.MethodPost, "/pins/14/on", ""); code != http.StatusAccepted {
+			t.Fatalf("expected on to be queued, got %d", code)
+		}
+
+		waitFor(t, "the pin to be marked failed", func() bool {
+			failures, _ := f.Errors()
+			return failures > 0
+		})
+
+		if _, err := f.Errors(); err == nil || !strings.Contains(err.Error(), "panicked") {
+			t.Fatalf("expected the panic to be the last error, got %v", err)
+		}
+
+		waitFor(t, "the goroutine to exit", func() bool { return f.Goroutines() == 0 })
+		if levels := p.Levels(); levels[len(levels)-1] != gpio.Low {
+			t.Fatalf("expected the pin to be forced Low, got %v", levels)
+		}
+	})
+
+	t.Run("queue", func(t *testing.T) {
+		f.Reset(context.Background())
+		before := len(p.Levels())
+
+		// solid panics in the queue, which carries on with off
+		for _, action := range []string{"solid", "off"} {
+			if code := serve(http.MethodPost, "/pins/14/"+action, ""); code != http.StatusAccepted {
+				t.Fatalf("expected %s to be queued, got %d", action, code)
+			}
+		}
+
+		waitFor(t, "the queue to be processed", func() bool {
+			return m.QueueDepths()[14] == 0 && len(p.Levels()) > before
+		})
+
+		if mode, l := f.State(); mode != ModeOff || l != gpio.Low {
+			t.Fatalf("expected off to be applied after the panic, got %s and %s", mode, l)
+		}
+	})
+}
+
+func TestPinPanickingOnLow(t *testing.T) {
+	p := &panickingPin{fakePin: fakePin{name: "GPIO14"}, level: gpio.Low}
+	f := &PinCycle{Pin: p, MinInterval: time.Millisecond, MaxInterval: time.Millisecond}
+	m := NewManager(map[int]*PinCycle{14: f}, nil)
+	h := recoverPanics(NewAPI(m, nil, nil, nil))
+	defer m.CloseQueues(context.Background())
+
+	serve := func(method, path, body string) int {
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rw.Code
+	}
+
+	if code := serve(http.MethodPut, "/pins/14", `{"state":"solid"}`); code != http.StatusOK {
+		t.Fatalf("expected the pin to turn on, got %d", code)
+	}
+
+	// Stop panics writing Low, which must not leave the pin locked
+	if code := serve(http.MethodPut, "/pins/14", `{"state":"off"}`); code != http.StatusInternalServerError {
+		t.Fatalf("expected 500 from turning the pin off, got %d", code)
+	}
+
+	if code := serve(http.MethodGet, "/status", ""); code != http.StatusOK {
+		t.Fatalf("expected /status to respond after the panic, got %d", code)
+	}
+
+	// cycling panics on its first Low, and again forcing the pin off
+	if code := serve(http.MethodPost, "/pins/14/on", ""); code != http.StatusAccepted {
+		t.Fatalf("expected on to be queued, got %d", code)
+	}
+
+	waitFor(t, "the pin to be marked failed", func() bool {
+		failures, _ := f.Errors()
+		return failures > 0
+	})
+	waitFor(t, "the goroutine to exit", func() bool { return f.Goroutines() == 0 })
+
+	if code := serve(http.MethodGet, "/status", ""); code != http.StatusOK {
+		t.Fatalf("expected /status to respond after the goroutine panicked, got %d", code)
+	}
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"slices"
+)
+
+// ErrShuttingDown is returned by Reload once the schedules have been stopped
+// for shutdown
+var ErrShuttingDown = errors.New("shutting down")
+
+// EnableReload sets the config file Reload reads and c, the config the pins
+// were built from. setup is applied to each pin a reload adds or changes, as
+// main does to the pins it starts with, and is called with the pin locked.
+func (a *API) EnableReload(path string, c *Config, setup func(n int, p *PinCycle)) {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	a.configMu.Lock()
+	defer a.configMu.Unlock()
+
+	a.configFile = path
+	a.config = c
+	a.setupPin = setup
+}
+
+// Reload re-reads the config file and applies the differences to the running
+// pins. New pins are added, pins no longer listed are stopped and removed,
+// and changed settings are applied to the other pins without interrupting
+// them unless their pattern changed. Groups and schedules are replaced.
+// Input pins and the status pin are only read at startup, boards may only be
+// added. A config which fails validation is rejected and the current one
+// kept.
+func (a *API) Reload() error {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	if a.closed {
+		return ErrShuttingDown
+	}
+
+	c, err := LoadConfig(a.configFile)
+	if err != nil {
+		return err
+	}
+
+	return a.applyConfig(c)
+}
+
+// applyConfig validates c and applies it as Reload does, a.reloadMu must be
+// held. Nothing is changed if c is invalid.
+func (a *API) applyConfig(c *Config) error {
+	if err := c.validatePins(); err != nil {
+		return err
+	}
+
+	// a bad group or schedule is found before any new pin is acquired
+	if err := c.validateTargets(); err != nil {
+		return err
+	}
+
+	a.configMu.RLock()
+	old := a.config
+	a.configMu.RUnlock()
+
+	previous := map[int]PinConfig{}
+	if old != nil {
+		// the pins of each board are keyed by its position, see boardStride
+		if len(c.Boards) < len(old.Boards) || !reflect.DeepEqual(old.Boards, c.Boards[:len(old.Boards)]) {
+			return fmt.Errorf("boards can only be added by a reload, restart to change or remove them")
+		}
+
+		for _, pc := range old.Pins {
+			n, _ := old.key(pc.Board, pc.GPIO)
+			previous[n] = pc
+		}
+	}
+
+	current := a.manager.Pins()
+	pins := map[int]*PinCycle{}
+	failed := []*PinError{}
+	added := map[int]*PinCycle{}
+	updated := map[int]PinConfig{}
+
+	for _, pc := range c.Pins {
+		n, _ := c.key(pc.Board, pc.GPIO)
+
+		if p, ok := current[n]; ok {
+			pins[n] = p
+			if !reflect.DeepEqual(pc, previous[n]) {
+				updated[n] = pc
+			}
+
+			continue
+		}
+
+		// pins which failed before are retried
+		p, err := c.build(pc)
+		if err != nil {
+			logger.Error("Pin unavailable, continuing without it", "event", "error", "pin", pc.label(), "error", err)
+			failed = append(failed, &PinError{GPIO: pc.GPIO, Board: pc.Board, Alias: pc.Alias, Err: err, n: n})
+			continue
+		}
+
+		if a.setupPin != nil {
+			p.mu.Lock()
+			a.setupPin(n, p)
+			p.mu.Unlock()
+		}
+
+		pins[n] = p
+		added[n] = p
+	}
+
+	if len(pins) == 0 {
+		return fmt.Errorf("no usable pins: %s", failed[0])
+	}
+
+	// groups and schedules are checked against the new pins before any are
+	// put in use
+	next := NewManager(pins, failed)
+
+	groups, err := c.BuildGroups(next)
+	if err != nil {
+		return err
+	}
+
+	schedules, err := c.BuildSchedules(next, groups)
+	if err != nil {
+		return err
+	}
+	schedules.drive(a.manager)
+
+	if old != nil && !reflect.DeepEqual(old.Inputs, c.Inputs) {
+		logger.Warn("Input pins have changed, the change takes effect after a restart", "event", "reload")
+	}
+
+	a.manager.replace(pins, failed, func() {
+		for n, pc := range updated {
+			p := pins[n]
+
+			p.mu.Lock()
+			pc.apply(p)
+			if a.setupPin != nil {
+				a.setupPin(n, p)
+			}
+			p.mu.Unlock()
+		}
+	})
+
+	for n, pc := range updated {
+		// a new pattern restarts a cycling pin, anything else is picked up
+		// the next time the pin uses the setting
+		pattern, _ := ParsePattern(pc.Pattern)
+		pins[n].SetPattern(context.Background(), pattern)
+
+		if !pins[n].Enabled() {
+			if err := pins[n].Stop(context.Background()); err != nil {
+				logger.Error("Unable to drive pin low", "event", "error", "pin", pins[n].Pin.Name(), "error", err)
+			}
+		}
+
+		logger.Info("Updated pin", "event", "reload", "pin", pins[n].Pin.Name())
+	}
+
+	for _, n := range pinNumbers(current) {
+		if _, ok := pins[n]; ok {
+			continue
+		}
+
+		a.manager.dropQueue(n)
+
+		p := current[n]
+		if err := p.Stop(context.Background()); err != nil {
+			logger.Error("Unable to drive pin low", "event", "error", "pin", p.Pin.Name(), "error", err)
+		}
+
+		logger.Info("Removed pin", "event", "reload", "pin", p.Pin.Name())
+	}
+
+	for _, n := range pinNumbers(added) {
+		logger.Info("Added pin", "event", "reload", "pin", added[n].Pin.Name())
+	}
+	checkPWM(added)
+
+	a.configMu.Lock()
+	stopped := a.schedules
+	a.config = c
+	a.groups = groups
+	a.schedules = schedules
+	a.configMu.Unlock()
+
+	if err := stopped.Stop(context.Background()); err != nil {
+		logger.Warn("Timeout waiting for schedules to complete")
+	}
+	schedules.Start()
+
+	logger.Info("Reloaded config", "event", "reload", "pins", len(pins), "unavailable", len(failed), "groups", len(groups), "schedules", len(c.Schedules))
+
+	return nil
+}
+
+// StopSchedules stops the running schedules and prevents any further reload
+// starting new ones, it returns once running schedules complete or ctx is
+// done
+func (a *API) StopSchedules(ctx context.Context) error {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	a.closed = true
+
+	a.configMu.RLock()
+	defer a.configMu.RUnlock()
+
+	return a.schedules.Stop(ctx)
+}
+
+// handleReload re-reads the config file, replying with the state of every
+// pin once it has been applied
+func (a *API) handleReload(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(rw, http.MethodPost)
+		return
+	}
+
+	if err := a.Reload(); err != nil {
+		logger.Error("Unable to reload config, keeping the current one", "event", "error", "error", err)
+
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrShuttingDown) {
+			status = http.StatusServiceUnavailable
+		}
+
+		http.Error(rw, err.Error(), status)
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, a.manager.Status())
+}
+
+// maxConfigSize bounds the size of a PUT /config request body
+const maxConfigSize = 1 << 20
+
+// ReplaceConfig validates c and applies it in place of the current config as
+// Reload does, then saves it to the config file if one is in use so a reload
+// or restart keeps it. The environment defaults are not written to the file.
+// An invalid config is rejected and nothing is changed.
+func (a *API) ReplaceConfig(c *Config) error {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	if a.closed {
+		return ErrShuttingDown
+	}
+
+	// the environment defaults are only applied to the running config, the
+	// saved one is kept as sent so a later change to the environment applies
+	// to it too
+	applied := *c
+	applied.Pins = slices.Clone(c.Pins)
+	if err := applied.envDefaults(); err != nil {
+		return err
+	}
+
+	if err := a.applyConfig(&applied); err != nil {
+		return err
+	}
+
+	if a.configFile == "" {
+		logger.Warn("Config replaced but not saved, no config file is in use so a restart loses it", "event", "reload")
+		return nil
+	}
+
+	if err := saveConfig(a.configFile, c); err != nil {
+		return fmt.Errorf("%w: %s", ErrNotSaved, err)
+	}
+
+	return nil
+}
+
+// ErrNotSaved is returned by ReplaceConfig when the config was applied but
+// could not be written to the config file
+var ErrNotSaved = errors.New("config applied but not saved")
+
+// saveConfig writes c to path, replacing the file in a single step so a
+// failure never leaves it part written
+func saveConfig(path string, c *Config) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// handleConfig replies with the current config for GET and replaces it with
+// the config in the request body for PUT, replying with the state of every
+// pin once it has been applied
+func (a *API) handleConfig(rw http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		a.configMu.RLock()
+		c := a.config
+		a.configMu.RUnlock()
+
+		writeJSON(rw, http.StatusOK, c)
+		return
+	case http.MethodPut:
+	default:
+		methodNotAllowed(rw, http.MethodGet+", "+http.MethodPut)
+		return
+	}
+
+	b, err := io.ReadAll(http.MaxBytesReader(rw, r.Body, maxConfigSize))
+	if err != nil {
+		http.Error(rw, fmt.Sprintf("unable to read body: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// the schema names the pin and field of a mistake such as a misspelt
+	// field, which would otherwise silently fall back to its default
+	if err := validateConfigSchema(b); err != nil {
+		http.Error(rw, fmt.Sprintf("invalid config: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	c := &Config{}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		http.Error(rw, fmt.Sprintf("body must be a JSON config: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if dec.More() {
+		http.Error(rw, "body must be a single JSON config", http.StatusBadRequest)
+		return
+	}
+
+	logger.InfoContext(r.Context(), "Replacing config", "event", "reload", "pins", len(c.Pins))
+
+	if err := a.ReplaceConfig(c); err != nil {
+		logger.ErrorContext(r.Context(), "Unable to replace config", "event", "error", "error", err)
+
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, ErrShuttingDown):
+			status = http.StatusServiceUnavailable
+		case errors.Is(err, ErrNotSaved):
+			status = http.StatusInternalServerError
+		}
+
+		http.Error(rw, err.Error(), status)
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, a.manager.Status())
+}
+
+// replace swaps in a new set of pins, update is called with the registry
+// locked so no lookup sees a pin part way through being changed
+func (m *Manager) replace(pins map[int]*PinCycle, failed []*PinError, update func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pins = pins
+	m.failed = failed
+	m.forget()
+	update()
+}
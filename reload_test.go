@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReloadDuringCommands(t *testing.T) {
+	for _, n := range []int{40, 41, 42} {
+		registerTestPin(t, "TEST_GPIO"+strconv.Itoa(n), strconv.Itoa(n))
+	}
+
+	// 41 is in every config so is never lost, 40 and 42 come and go
+	configs := []*Config{
+		{Pins: []PinConfig{{GPIO: 40}, {GPIO: 41, MinIntervalMS: 1, MaxIntervalMS: 1}}},
+		{Pins: []PinConfig{{GPIO: 40}, {GPIO: 41, MinIntervalMS: 2, MaxIntervalMS: 2}, {GPIO: 42}}},
+		{Pins: []PinConfig{{GPIO: 41, Pattern: "steady", MinIntervalMS: 1, MaxIntervalMS: 1}, {GPIO: 42, Alias: "porch"}}},
+	}
+
+	pins, _, err := configs[0].Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schedules, err := NewScheduler(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	m := NewManager(pins, nil)
+	a := NewAPI(m, nil, schedules, nil)
+	a.EnableReload(path, configs[0], nil)
+
+	load := func(c *Config) error {
+		b, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(path, b, 0o644); err != nil {
+			return err
+		}
+
+		return a.Reload()
+	}
+
+	ctx := context.Background()
+	stop := make(chan struct{})
+	var lost, reloads atomic.Int64
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for i := 1; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			if err := load(configs[i%len(configs)]); err != nil {
+				t.Errorf("reload %d failed: %s", i, err)
+				return
+			}
+			reloads.Add(1)
+		}
+	}()
+
+	for _, id := range []string{"40", "41", "42", "porch"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				m.On(ctx, id, 0)
+				m.Toggle(ctx, id)
+				m.Off(ctx, id)
+
+				if _, _, err := m.Lookup("41"); err != nil {
+					lost.Add(1)
+				}
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			rw := httptest.NewRecorder()
+			a.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/status", nil))
+			if rw.Code != http.StatusOK {
+				t.Errorf("status returned %d", rw.Code)
+				return
+			}
+		}
+	}()
+
+	time.Sleep(200 * time.Millisecond)
+	waitFor(t, "every config to be applied", func() bool { return reloads.Load() >= int64(len(configs)) })
+	close(stop)
+	wg.Wait()
+
+	if n := lost.Load(); n != 0 {
+		t.Fatalf("pin 41 could not be found %d times during reloads", n)
+	}
+
+	// the pins are those of the last config applied
+	if err := load(configs[2]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.OffAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := pinNumbers(m.Pins()); len(got) != 2 || got[0] != 41 || got[1] != 42 {
+		t.Fatalf("expected pins 41 and 42 after the last reload, got %v", got)
+	}
+
+	if _, _, err := m.Lookup("40"); err != ErrUnknownPin {
+		t.Fatalf("expected removed pin 40 to be unknown, got %v", err)
+	}
+
+	waitFor(t, "the pin goroutines to exit", func() bool { return m.Goroutines() == 0 })
+}
+
+func TestReloadInvalidTargetsDrivesNoPin(t *testing.T) {
+	kept, _ := registerTestPin(t, "TEST_GPIO43", "43")
+	added, _ := registerTestPin(t, "TEST_GPIO44", "44")
+
+	c := &Config{Pins: []PinConfig{{GPIO: 43}}}
+	pins, _, err := c.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schedules, err := NewScheduler(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	m := NewManager(pins, nil)
+	a := NewAPI(m, nil, schedules, nil)
+	a.EnableReload(path, c, nil)
+	before := len(kept.History())
+
+	invalid := map[string]*Config{
+		"unknown group member": {
+			Pins:   []PinConfig{{GPIO: 43}, {GPIO: 44, InitialLevel: "high"}},
+			Groups: map[string][]PinRef{"porch": {"44", "45"}},
+		},
+		"unknown schedule group": {
+			Pins:      []PinConfig{{GPIO: 43}, {GPIO: 44, InitialLevel: "high"}},
+			Schedules: []ScheduleConfig{{Spec: "0 7 * * *", Action: ScheduleOn, Group: "porch"}},
+		},
+		"invalid cron spec": {
+			Pins:      []PinConfig{{GPIO: 43}, {GPIO: 44, InitialLevel: "high"}},
+			Schedules: []ScheduleConfig{{Spec: "every morning", Action: ScheduleOn, Pin: "44"}},
+		},
+	}
+
+	for name, c := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if err := saveConfig(path, c); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := a.Reload(); err == nil {
+				t.Fatal("expected the config to be rejected")
+			}
+
+			if levels := added.History(); len(levels) != 0 {
+				t.Fatalf("expected the new pin not to be driven, got %v", levels)
+			}
+
+			if levels := kept.History(); len(levels) != before {
+				t.Fatalf("expected the running pin not to be driven, got %v", levels[before:])
+			}
+
+			if got := pinNumbers(m.Pins()); len(got) != 1 || got[0] != 43 {
+				t.Fatalf("expected only pin 43 after the rejected config, got %v", got)
+			}
+		})
+	}
+}
+
+func TestReplaceConfigSavesWithoutEnvDefaults(t *testing.T) {
+	registerTestPin(t, "TEST_GPIO46", "46")
+	t.Setenv("DEFAULT_PATTERN", "steady")
+
+	c := &Config{Pins: []PinConfig{{GPIO: 46, Pattern: "pulse"}}}
+	pins, _, err := c.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schedules, err := NewScheduler(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	m := NewManager(pins, nil)
+	a := NewAPI(m, nil, schedules, nil)
+	a.EnableReload(path, c, nil)
+
+	if err := a.ReplaceConfig(&Config{Pins: []PinConfig{{GPIO: 46}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved := &Config{}
+	if err := json.Unmarshal(b, saved); err != nil {
+		t.Fatal(err)
+	}
+
+	if p := saved.Pins[0].Pattern; p != "" {
+		t.Fatalf("expected the saved pin to leave its pattern unset, got %q", p)
+	}
+
+	rw := httptest.NewRecorder()
+	a.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/config", nil))
+
+	running := &Config{}
+	if err := json.Unmarshal(rw.Body.Bytes(), running); err != nil {
+		t.Fatal(err)
+	}
+
+	if p := running.Pins[0].Pattern; p != "steady" {
+		t.Fatalf("expected the running pin to take DEFAULT_PATTERN, got %q", p)
+	}
+}
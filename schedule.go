@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Schedule actions
+const (
+	ScheduleOn  = "on"
+	ScheduleOff = "off"
+)
+
+// Schedule turns a set of pins on or off whenever its cron spec fires
+type Schedule struct {
+	// Spec is a standard five field cron expression evaluated in local time
+	Spec string
+
+	// Action is ScheduleOn or ScheduleOff
+	Action string
+
+	// Target names the pin or group the schedule applies to for display
+	Target string
+
+	// pins are the GPIO numbers of the pins driven through manager
+	manager *Manager
+	pins    []int
+	spec    cron.Schedule
+}
+
+// run applies the schedule action to each of its pins
+func (s *Schedule) run() {
+	logger.Info("Running schedule", "event", s.Action, "spec", s.Spec, "target", s.Target)
+
+	ctx := contextWithSource(context.Background(), SourceSchedule, "", "")
+
+	if s.Action == ScheduleOn {
+		s.manager.OnPins(ctx, s.pins, 0)
+		return
+	}
+
+	for _, n := range s.pins {
+		if err := s.manager.Off(ctx, strconv.Itoa(n)); err != nil {
+			logger.Error("Unable to turn off pin", "event", "error", "pin", s.manager.Label(n), "error", err)
+		}
+	}
+}
+
+// Scheduler runs Schedules in a background goroutine
+type Scheduler struct {
+	// Clock is the source of time for the schedules, nil uses SystemClock.
+	// It must be set before Start.
+	Clock Clock
+
+	schedules []*Schedule
+
+	// mu guards next, the time each schedule next fires, and cancel and
+	// done which stop the goroutine run by Start
+	mu     sync.Mutex
+	next   []time.Time
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewScheduler parses the spec of each schedule, returning an error for the
+// first one which is invalid
+func NewScheduler(schedules []*Schedule) (*Scheduler, error) {
+	for _, sc := range schedules {
+		spec, err := cron.ParseStandard(sc.Spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron spec %q for %s: %s", sc.Spec, sc.Target, err)
+		}
+
+		sc.spec = spec
+	}
+
+	return &Scheduler{schedules: schedules}, nil
+}
+
+// Start runs the schedules until Stop is called
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel != nil {
+		return
+	}
+
+	clock := clockOr(s.Clock)
+	now := clock.Now()
+
+	s.next = make([]time.Time, len(s.schedules))
+	for i, sc := range s.schedules {
+		s.next[i] = sc.spec.Next(now)
+	}
+
+	var ctx context.Context
+	ctx, s.cancel = context.WithCancel(context.Background())
+	s.done = make(chan struct{})
+
+	go s.run(ctx, clock, s.done)
+}
+
+// run waits for the next schedule to fall due and runs every schedule which
+// is due, until ctx is cancelled
+func (s *Scheduler) run(ctx context.Context, clock Clock, done chan struct{}) {
+	defer close(done)
+
+	for {
+		s.mu.Lock()
+		due := time.Time{}
+		for _, t := range s.next {
+			if !t.IsZero() && (due.IsZero() || t.Before(due)) {
+				due = t
+			}
+		}
+		s.mu.Unlock()
+
+		// no schedule fires again
+		if due.IsZero() {
+			<-ctx.Done()
+			return
+		}
+
+		if !sleepClock(ctx, clock, due.Sub(clock.Now())) {
+			return
+		}
+
+		now := clock.Now()
+		for i, sc := range s.schedules {
+			s.mu.Lock()
+			fire := !s.next[i].IsZero() && !s.next[i].After(now)
+			if fire {
+				s.next[i] = sc.spec.Next(now)
+			}
+			s.mu.Unlock()
+
+			if fire && ctx.Err() == nil {
+				sc.run()
+			}
+		}
+	}
+}
+
+// drive sets the Manager the schedules drive their pins through
+func (s *Scheduler) drive(m *Manager) {
+	for _, sc := range s.schedules {
+		sc.manager = m
+	}
+}
+
+// Stop prevents any further schedules from firing and waits for running ones
+// to complete or ctx to be done
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	cancel, done := s.cancel, s.done
+	s.mu.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ScheduleStatus is the JSON representation of a Schedule
+type ScheduleStatus struct {
+	Spec   string    `json:"spec"`
+	Action string    `json:"action"`
+	Target string    `json:"target"`
+	Next   time.Time `json:"next"`
+}
+
+// Status returns each schedule in configuration order along with the next
+// time it fires, Next is zero until the scheduler has been started
+func (s *Scheduler) Status() []ScheduleStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := []ScheduleStatus{}
+
+	for i, sc := range s.schedules {
+		st := ScheduleStatus{Spec: sc.Spec, Action: sc.Action, Target: sc.Target}
+		if s.next != nil {
+			st.Next = s.next[i]
+		}
+
+		status = append(status, st)
+	}
+
+	return status
+}
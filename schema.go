@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// schema is the subset of JSON Schema used by the Config schema of openAPI,
+// keywords it does not know, such as description, are ignored
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Properties           map[string]*schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties"`
+	Items                *schema            `json:"items"`
+	Enum                 []any              `json:"enum"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	OneOf                []*schema          `json:"oneOf"`
+}
+
+// schemas are the component schemas of openAPI keyed by name, Config is the
+// schema of the config file
+var schemas = sync.OnceValues(func() (map[string]*schema, error) {
+	var doc struct {
+		Components struct {
+			Schemas map[string]*schema `json:"schemas"`
+		} `json:"components"`
+	}
+
+	if err := json.Unmarshal(openAPI, &doc); err != nil {
+		return nil, fmt.Errorf("unable to parse embedded schema: %s", err)
+	}
+
+	return doc.Components.Schemas, nil
+})
+
+// validateConfigSchema checks the config in data against the Config schema
+// embedded in openAPI, so a misspelt field, an unknown pattern or a negative
+// interval is rejected rather than falling back to a default. The error
+// names the field, and the GPIO number of the pin it belongs to.
+func validateConfigSchema(data []byte) error {
+	s, err := schemas()
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+
+	return s["Config"].validate(s, "", v)
+}
+
+// validate checks v against s, path locates v in the config for errors
+func (s *schema) validate(schemas map[string]*schema, path string, v any) error {
+	if s.Ref != "" {
+		ref, ok := schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+		if !ok {
+			return fmt.Errorf("unknown schema %s", s.Ref)
+		}
+
+		return ref.validate(schemas, path, v)
+	}
+
+	if len(s.OneOf) > 0 {
+		return s.validateOneOf(schemas, path, v)
+	}
+
+	if err := s.validateType(v); err != nil {
+		return fieldError(path, err)
+	}
+
+	if len(s.Enum) > 0 && !s.allowed(v) {
+		return fieldError(path, fmt.Errorf("%s is not one of %s", describe(v), s.enum()))
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		return s.validateObject(schemas, path, v)
+	case []any:
+		if s.Items == nil {
+			return nil
+		}
+
+		for i, item := range v {
+			if err := s.Items.validate(schemas, itemPath(path, i, item), item); err != nil {
+				return err
+			}
+		}
+	case json.Number:
+		f, _ := v.Float64()
+		if s.Minimum != nil && f < *s.Minimum {
+			return fieldError(path, fmt.Errorf("%s must be at least %v", v, *s.Minimum))
+		}
+
+		if s.Maximum != nil && f > *s.Maximum {
+			return fieldError(path, fmt.Errorf("%s must be at most %v", v, *s.Maximum))
+		}
+	}
+
+	return nil
+}
+
+// validateOneOf checks v matches one of the schemas of s
+func (s *schema) validateOneOf(schemas map[string]*schema, path string, v any) error {
+	types := []string{}
+	for _, o := range s.OneOf {
+		if o.validate(schemas, path, v) == nil {
+			return nil
+		}
+
+		types = append(types, article(o.Type)+" "+o.Type)
+	}
+
+	return fieldError(path, fmt.Errorf("%s must be %s", describe(v), strings.Join(types, " or ")))
+}
+
+// validateObject checks the required and known fields of v
+func (s *schema) validateObject(schemas map[string]*schema, path string, v map[string]any) error {
+	for _, name := range s.Required {
+		if _, ok := v[name]; !ok {
+			return fieldError(path, fmt.Errorf("%s is required", name))
+		}
+	}
+
+	names := make([]string, 0, len(v))
+	for name := range v {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		field := name
+		if path != "" {
+			field = path + "." + name
+		}
+
+		p, ok := s.Properties[name]
+		if !ok {
+			p, ok = s.additional()
+		}
+
+		if !ok {
+			return fieldError(path, fmt.Errorf("unknown field %q", name))
+		}
+
+		if err := p.validate(schemas, field, v[name]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// additional returns the schema of fields which are not properties of s,
+// false when they are not allowed
+func (s *schema) additional() (*schema, bool) {
+	if len(s.AdditionalProperties) == 0 || string(s.AdditionalProperties) == "true" {
+		return &schema{}, true
+	}
+
+	a := &schema{}
+	if err := json.Unmarshal(s.AdditionalProperties, a); err != nil {
+		return nil, false
+	}
+
+	return a, true
+}
+
+// validateType checks v is of the type of s, any value is accepted when s
+// has no type
+func (s *schema) validateType(v any) error {
+	ok := true
+
+	switch s.Type {
+	case "object":
+		_, ok = v.(map[string]any)
+	case "array":
+		_, ok = v.([]any)
+	case "string":
+		_, ok = v.(string)
+	case "boolean":
+		_, ok = v.(bool)
+	case "number":
+		_, ok = v.(json.Number)
+	case "integer":
+		var n json.Number
+		if n, ok = v.(json.Number); ok {
+			f, err := n.Float64()
+			ok = err == nil && f == math.Trunc(f)
+		}
+	}
+
+	if !ok {
+		return fmt.Errorf("%s must be %s %s", describe(v), article(s.Type), s.Type)
+	}
+
+	return nil
+}
+
+// allowed returns true if v is one of the values of s.Enum
+func (s *schema) allowed(v any) bool {
+	for _, e := range s.Enum {
+		if fmt.Sprint(e) == fmt.Sprint(v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// enum lists the values of s.Enum for errors
+func (s *schema) enum() string {
+	values := []string{}
+	for _, e := range s.Enum {
+		values = append(values, fmt.Sprint(e))
+	}
+
+	return strings.Join(values, ", ")
+}
+
+// itemPath returns the path of item i of the array at path, naming the pin
+// when the item has a GPIO number
+func itemPath(path string, i int, item any) string {
+	p := fmt.Sprintf("%s[%d]", path, i)
+
+	o, ok := item.(map[string]any)
+	if !ok {
+		return p
+	}
+
+	n, ok := o["gpio"].(json.Number)
+	if !ok {
+		return p
+	}
+
+	board, _ := o["board"].(string)
+	if n, err := n.Int64(); err == nil {
+		p += " (" + pinLabel(board, int(n)) + ")"
+	}
+
+	return p
+}
+
+// fieldError prefixes err with path, when it is not the top of the config
+func fieldError(path string, err error) error {
+	if path == "" {
+		return err
+	}
+
+	return fmt.Errorf("%s: %s", path, err)
+}
+
+// describe formats v for errors
+func describe(v any) string {
+	switch v := v.(type) {
+	case string:
+		return fmt.Sprintf("%q", v)
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case nil:
+		return "null"
+	}
+
+	return fmt.Sprint(v)
+}
+
+// article returns the indefinite article for typ
+func article(typ string) string {
+	if typ != "" && strings.ContainsAny(typ[:1], "aeiou") {
+		return "an"
+	}
+
+	return "a"
+}
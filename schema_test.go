@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+// testSchemas exercise each keyword of schema, Root is validated
+const testSchemas = `{
+	"Ref": {"oneOf": [{"type": "integer"}, {"type": "string"}]},
+	"Item": {
+		"type": "object",
+		"required": ["id"],
+		"properties": {
+			"id": {"$ref": "#/components/schemas/Ref"},
+			"n": {"type": "integer", "minimum": 0, "maximum": 10},
+			"kind": {"type": "string", "enum": ["a", "b"]}
+		},
+		"additionalProperties": false
+	},
+	"Root": {
+		"type": "object",
+		"properties": {
+			"items": {"type": "array", "items": {"$ref": "#/components/schemas/Item"}},
+			"tags": {"type": "object", "additionalProperties": {"type": "array", "items": {"$ref": "#/components/schemas/Ref"}}},
+			"extra": {"type": "object"},
+			"on": {"type": "boolean"},
+			"ratio": {"type": "number"}
+		},
+		"additionalProperties": false
+	}
+}`
+
+func TestSchemaKeywords(t *testing.T) {
+	schemas := map[string]*schema{}
+	if err := json.Unmarshal([]byte(testSchemas), &schemas); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		doc  string
+		err  string
+	}{
+		{"valid", `{"items": [{"id": 1, "n": 3, "kind": "a"}, {"id": "x/1"}], "tags": {"t": [1, "a/2"]}, "extra": {"any": null}, "on": true, "ratio": 0.5}`, ""},
+		{"type", `[]`, `array must be an object`},
+		{"boolean", `{"on": "yes"}`, `on: "yes" must be a boolean`},
+		{"number", `{"ratio": "1"}`, `ratio: "1" must be a number`},
+		{"integer", `{"items": [{"id": 1, "n": 1.5}]}`, `items[0].n: 1.5 must be an integer`},
+		{"required", `{"items": [{"n": 1}]}`, `items[0]: id is required`},
+		{"enum", `{"items": [{"id": 1, "kind": "c"}]}`, `items[0].kind: "c" is not one of a, b`},
+		{"minimum", `{"items": [{"id": 1}, {"id": 2, "n": -1}]}`, `items[1].n: -1 must be at least 0`},
+		{"maximum", `{"items": [{"id": 1, "n": 11}]}`, `items[0].n: 11 must be at most 10`},
+		{"unknown field", `{"colour": "red"}`, `unknown field "colour"`},
+		{"nested unknown field", `{"items": [{"id": 1, "size": 2}]}`, `items[0]: unknown field "size"`},
+		{"additional properties", `{"tags": {"t": "x"}}`, `tags.t: "x" must be an array`},
+		{"items", `{"items": {"id": 1}}`, `items: object must be an array`},
+		{"oneOf through a nested ref", `{"tags": {"t": [1, true]}}`, `tags.t[1]: true must be an integer or a string`},
+		{"oneOf null", `{"items": [{"id": null}]}`, `items[0].id: null must be an integer or a string`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec := json.NewDecoder(bytes.NewReader([]byte(tt.doc)))
+			dec.UseNumber()
+
+			var v any
+			if err := dec.Decode(&v); err != nil {
+				t.Fatal(err)
+			}
+
+			err := schemas["Root"].validate(schemas, "", v)
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("expected no error, got %s", err)
+			case tt.err != "" && (err == nil || err.Error() != tt.err):
+				t.Fatalf("expected %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestConfigSchema(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{"valid", `{"pins": [{"gpio": 14}, {"gpio": 15, "pattern": "pulse"}], "groups": {"all": [14, 15]}}`, ""},
+		{"pins required", `{"inputs": []}`, `pins is required`},
+		{"pin named by GPIO", `{"pins": [{"gpio": 14}, {"gpio": 15, "min_interval_ms": -5}]}`, `pins[1] (GPIO15).min_interval_ms: -5 must be at least 0`},
+		{"pin named by board", `{"boards": [{"name": "expander", "prefix": "X_"}], "pins": [{"gpio": 3, "board": "expander", "pattern": "zigzag"}]}`, `pins[0] (expander/GPIO3).pattern: "zigzag" is not one of random, steady, pulse, heartbeat`},
+		{"misspelt field", `{"pins": [{"gpio": 14, "patern": "pulse"}]}`, `pins[0] (GPIO14): unknown field "patern"`},
+		{"wrong type", `{"pins": [{"gpio": "14"}]}`, `pins[0].gpio: "14" must be an integer`},
+		{"group member", `{"pins": [{"gpio": 14}], "groups": {"all": [14, false]}}`, `groups.all[1]: false must be an integer or a string`},
+		{"schedule action", `{"pins": [{"gpio": 14}], "schedules": [{"spec": "0 7 * * *", "action": "dim", "pin": 14}]}`, `schedules[0].action: "dim" is not one of on, off`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateConfigSchema([]byte(tt.config))
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("expected no error, got %s", err)
+			case tt.err != "" && (err == nil || err.Error() != tt.err):
+				t.Fatalf("expected %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+// TestConfigSchemaExample checks the example config of the spec, shown in
+// /docs, is one the server accepts
+func TestConfigSchemaExample(t *testing.T) {
+	var doc struct {
+		Components struct {
+			Schemas map[string]struct {
+				Example json.RawMessage `json:"example"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+
+	if err := json.Unmarshal(openAPI, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	example := doc.Components.Schemas["Config"].Example
+	if len(example) == 0 {
+		t.Fatal("expected the Config schema to have an example")
+	}
+
+	if err := validateConfigSchema(example); err != nil {
+		t.Fatalf("expected the example to match the schema, got %s", err)
+	}
+
+	c := &Config{}
+	dec := json.NewDecoder(bytes.NewReader(example))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.validatePins(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.validateTargets(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"periph.io/x/periph/conn/gpio"
+)
+
+// DefaultSelfTestHold is how long each pin is held high during a self-test
+const DefaultSelfTestHold = 200 * time.Millisecond
+
+// SelfTest lights each pin for hold, one at a time in order, so the wiring
+// of every LED can be checked by eye. It stops at the first pin which can
+// not be driven, returning an error naming it. Once the test ends each pin
+// is returned to the steady mode it was in beforehand, or left off.
+func SelfTest(ctx context.Context, pins []*PinCycle, hold time.Duration) error {
+	modes := make([]Mode, len(pins))
+	for i, p := range pins {
+		modes[i] = p.desiredMode()
+	}
+
+	defer func() {
+		for i, p := range pins {
+			if err := p.resume(ctx, modes[i]); err != nil {
+				logger.ErrorContext(ctx, "Unable to restore pin after self-test", "event", "error", "pin", p.Pin.Name(), "error", err)
+			}
+		}
+	}()
+
+	for _, p := range pins {
+		logger.InfoContext(ctx, "Testing pin", "event", "selftest", "pin", p.Pin.Name())
+
+		if err := p.flash(ctx, hold); err != nil {
+			return fmt.Errorf("self-test of %s failed: %w", p.Pin.Name(), err)
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+
+	logger.InfoContext(ctx, "Self-test complete", "event", "selftest", "pins", len(pins))
+	return nil
+}
+
+// flash drives the pin high for d then low, replacing anything else it was
+// doing. Unlike write any failure to drive the pin is returned. If the pin
+// is taken over by another command before d has elapsed it is left alone.
+func (f *PinCycle) flash(ctx context.Context, d time.Duration) error {
+	f.mu.Lock()
+	claim := f.claim(ctx, ModePattern)
+	err := f.out(ctx, gpio.High)
+	if err == nil {
+		f.level = gpio.High
+		f.notify()
+	}
+	f.mu.Unlock()
+
+	if err == nil {
+		select {
+		case <-f.clock().After(d):
+		case <-ctx.Done():
+		case <-claim.Done():
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if claim.Err() != nil {
+		return err
+	}
+
+	f.halt()
+	defer f.notify()
+
+	if lerr := f.out(ctx, gpio.Low); lerr != nil {
+		if err == nil {
+			err = lerr
+		}
+
+		return err
+	}
+
+	f.level = gpio.Low
+	return err
+}
+
+// handleSelfTest runs SelfTest across every pin in GPIO order and replies
+// with the state of the pins once it has finished, only one self-test runs
+// at a time
+func (a *API) handleSelfTest(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(rw, http.MethodPost)
+		return
+	}
+
+	if !a.selfTestMu.TryLock() {
+		http.Error(rw, "a self-test is already running", http.StatusConflict)
+		return
+	}
+	defer a.selfTestMu.Unlock()
+
+	if err := SelfTest(r.Context(), enabledPins(a.manager.Ordered()), DefaultSelfTestHold); err != nil {
+		logger.ErrorContext(r.Context(), "Self-test failed", "event", "error", "error", err)
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, a.manager.Status())
+}
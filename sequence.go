@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"periph.io/x/periph/conn/gpio"
+)
+
+// maxSequenceLength is the longest sequence accepted by /pins/{id}/sequence
+const maxSequenceLength = 4096
+
+// ParseSequence parses a comma separated list of level:milliseconds steps,
+// such as on:200,off:200,on:500,off:1000, where the level is on or off. The
+// error for a malformed sequence names the offending step.
+func ParseSequence(s string) ([]Step, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, errors.New("sequence must not be empty")
+	}
+
+	steps := []Step{}
+	for i, token := range strings.Split(s, ",") {
+		token = strings.TrimSpace(token)
+
+		level, ms, ok := strings.Cut(token, ":")
+		if !ok {
+			return nil, fmt.Errorf("step %d %q: expected level:milliseconds such as on:200", i+1, token)
+		}
+
+		st := Step{}
+		switch strings.ToLower(strings.TrimSpace(level)) {
+		case "on":
+			st.Level = gpio.High
+		case "off":
+			st.Level = gpio.Low
+		default:
+			return nil, fmt.Errorf("step %d %q: level must be on or off", i+1, token)
+		}
+
+		n, err := strconv.Atoi(strings.TrimSpace(ms))
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("step %d %q: duration must be a positive number of milliseconds", i+1, token)
+		}
+
+		st.Duration = time.Duration(n) * time.Millisecond
+		steps = append(steps, st)
+	}
+
+	return steps, nil
+}
+
+// RunPattern loops the pin through steps in a background goroutine,
+// replacing anything else the pin was doing, until it is stopped or
+// restarted
+func (f *PinCycle) RunPattern(ctx context.Context, steps []Step) error {
+	if len(steps) == 0 {
+		return errors.New("sequence must not be empty")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.start(ctx, ModeSequence, func(ctx context.Context) {
+		for {
+			for _, s := range steps {
+				if f.write(ctx, s.Level) != nil || !f.sleep(ctx, s.Duration) {
+					return
+				}
+			}
+		}
+	})
+
+	return nil
+}
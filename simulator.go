@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"periph.io/x/periph/conn/gpio"
+	"periph.io/x/periph/conn/gpio/gpioreg"
+	"periph.io/x/periph/conn/gpio/gpiotest"
+)
+
+// simulatedPins is the number of BCM GPIOs on the Raspberry Pi header,
+// GPIO0 to GPIO27
+const simulatedPins = 28
+
+// maxTimelineEntries is the number of writes kept by a Timeline, the oldest
+// are dropped first
+const maxTimelineEntries = 10000
+
+// TimelineEntry is a single write to a simulated pin
+type TimelineEntry struct {
+	Time  time.Time `json:"time"`
+	Pin   string    `json:"pin"`
+	Level string    `json:"level"`
+}
+
+// Timeline records the level written to the simulated pins so what the pins
+// would have done can be inspected without the hardware
+type Timeline struct {
+	mu      sync.Mutex
+	entries []TimelineEntry
+}
+
+// add records l being written to pin
+func (t *Timeline) add(pin string, l gpio.Level) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.entries = append(t.entries, TimelineEntry{Time: time.Now(), Pin: pin, Level: l.String()})
+	if len(t.entries) > maxTimelineEntries {
+		t.entries = t.entries[len(t.entries)-maxTimelineEntries:]
+	}
+}
+
+// Entries returns a copy of the recorded writes, the oldest first
+func (t *Timeline) Entries() []TimelineEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]TimelineEntry{}, t.entries...)
+}
+
+// Clear drops every recorded write
+func (t *Timeline) Clear() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.entries = nil
+}
+
+// simPin is an in memory GPIO pin which logs writes instead of driving
+// hardware, recording them to timeline
+type simPin struct {
+	*gpiotest.Pin
+
+	timeline *Timeline
+}
+
+// Out implements gpio.PinOut
+func (p *simPin) Out(l gpio.Level) error {
+	return p.OutContext(context.Background(), l)
+}
+
+// OutContext is Out logging with ctx
+func (p *simPin) OutContext(ctx context.Context, l gpio.Level) error {
+	logger.InfoContext(ctx, "Simulated write", "event", "simulate", "pin", p.Name(), "level", l.String())
+	p.timeline.add(p.Name(), l)
+
+	return p.Pin.Out(l)
+}
+
+// In implements gpio.PinIn
+func (p *simPin) In(pull gpio.Pull, edge gpio.Edge) error {
+	logger.Info("Simulated input", "event", "simulate", "pin", p.Name(), "pull", pull.String())
+	return p.Pin.In(pull, edge)
+}
+
+// registerSimulator registers simulated pins in the gpio registry in place of
+// the host drivers so that Config.Build resolves them on any machine. Inputs
+// never see an edge so buttons can not be pressed. Every write is recorded
+// to the returned Timeline.
+func registerSimulator() (*Timeline, error) {
+	t := &Timeline{}
+	return t, registerPins(func(p *gpiotest.Pin) gpio.PinIO { return &simPin{p, t} })
+}
+
+// simulateBoards registers simulated pins for the boards of c, as
+// registerSimulator does for the header, writes are recorded to t
+func simulateBoards(c *Config, t *Timeline) error {
+	return c.registerBoards(func(p *gpiotest.Pin) gpio.PinIO { return &simPin{p, t} })
+}
+
+// registerPins registers an in memory pin for each GPIO of the header, wrap
+// returns the pin to register for each
+func registerPins(wrap func(p *gpiotest.Pin) gpio.PinIO) error {
+	for n := 0; n < simulatedPins; n++ {
+		name := fmt.Sprintf("GPIO%d", n)
+
+		p := wrap(&gpiotest.Pin{N: name, Num: n, EdgesChan: make(chan gpio.Level)})
+		if err := gpioreg.Register(p); err != nil {
+			return err
+		}
+
+		if err := gpioreg.RegisterAlias(strconv.Itoa(n), name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// EnableSimulator serves the writes recorded by the simulated pins on
+// /simulator/timeline, it must be called before the API serves requests
+func (a *API) EnableSimulator(t *Timeline) {
+	a.mux.HandleFunc("/simulator/timeline", func(rw http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(rw, http.StatusOK, t.Entries())
+		case http.MethodDelete:
+			t.Clear()
+			rw.WriteHeader(http.StatusNoContent)
+		default:
+			methodNotAllowed(rw, http.MethodGet+", "+http.MethodDelete)
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// sseKeepAlive is how often a comment is sent to an idle /events client so
+// proxies do not close the connection
+const sseKeepAlive = 15 * time.Second
+
+// handleEvents streams every pin event to the client as Server-Sent Events,
+// one JSON Event per data line, starting with the current state of each pin
+func (a *API) handleEvents(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(rw, http.MethodGet)
+		return
+	}
+
+	events, unsubscribe, err := a.events.Subscribe("sse " + r.RemoteAddr)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer unsubscribe()
+
+	rc := http.NewResponseController(rw)
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	// stop nginx buffering the stream
+	rw.Header().Set("X-Accel-Buffering", "no")
+	rw.WriteHeader(http.StatusOK)
+
+	for _, p := range a.manager.Ordered() {
+		if !sendSSE(rw, rc, p.Event()) {
+			return
+		}
+	}
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok || !sendSSE(rw, rc, e) {
+				return
+			}
+		case <-keepAlive.C:
+			if !writeSSE(rw, rc, ": keep-alive\n\n") {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-a.streams:
+			return
+		}
+	}
+}
+
+// CloseStreams ends the /events streams so the server can be shut down
+// gracefully, it is safe to call more than once
+func (a *API) CloseStreams() {
+	a.streamsOnce.Do(func() { close(a.streams) })
+}
+
+// sendSSE writes e to the client as a single event, returning false if the
+// client has gone away
+func sendSSE(rw http.ResponseWriter, rc *http.ResponseController, e Event) bool {
+	data, err := json.Marshal(e)
+	if err != nil {
+		logger.Error("Unable to encode event", "error", err)
+		return false
+	}
+
+	return writeSSE(rw, rc, fmt.Sprintf("data: %s\n\n", data))
+}
+
+// writeSSE writes and flushes s, returning false if the client has gone away
+func writeSSE(rw http.ResponseWriter, rc *http.ResponseController, s string) bool {
+	// the server WriteTimeout would otherwise end the stream, every write
+	// gets its own deadline instead
+	rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+
+	if _, err := rw.Write([]byte(s)); err != nil {
+		return false
+	}
+
+	return rc.Flush() == nil
+}
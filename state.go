@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// savedState is the JSON document written to the state file, pins maps the
+// GPIO number of each pin to the mode it should be restored to
+type savedState struct {
+	Pins map[string]Mode `json:"pins"`
+}
+
+// desiredMode returns the mode the pin should be restored to after a
+// restart. Only steady modes are kept, timed and temporary modes such as
+// CycleFor, fades and patterns are restored as off.
+func (f *PinCycle) desiredMode() Mode {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case f.cancel == nil:
+		return ModeOff
+	case f.mode == ModeCycling && f.until.IsZero():
+		return ModeCycling
+	case f.mode == ModeSolid:
+		return ModeSolid
+	default:
+		return ModeOff
+	}
+}
+
+// snapshot returns the desired mode of every pin
+func snapshot(pins map[int]*PinCycle) savedState {
+	s := savedState{Pins: map[string]Mode{}}
+	for n, p := range pins {
+		s.Pins[strconv.Itoa(n)] = p.desiredMode()
+	}
+
+	return s
+}
+
+// saveState writes s to path, replacing the file atomically so a crash part
+// way through never leaves it truncated
+func saveState(path string, s savedState) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// restoreState returns each pin in the state file at path to its saved mode,
+// a missing or unreadable file is logged and leaves the pins off
+func restoreState(path string, pins map[int]*PinCycle) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		logger.Warn("No state file, starting with every pin off", "path", path)
+		return
+	}
+
+	s := savedState{}
+	if err == nil {
+		err = json.Unmarshal(data, &s)
+	}
+
+	if err != nil {
+		logger.Warn("Unable to read state file, starting with every pin off", "path", path, "error", err)
+		return
+	}
+
+	for _, n := range pinNumbers(pins) {
+		p := pins[n]
+
+		mode := s.Pins[strconv.Itoa(n)]
+		if (mode != ModeCycling && mode != ModeSolid) || !p.Enabled() {
+			continue
+		}
+
+		if err := p.resume(context.Background(), mode); err != nil {
+			logger.Error("Unable to restore pin", "event", "error", "pin", p.Pin.Name(), "error", err)
+			continue
+		}
+
+		logger.Info("Restored pin", "event", "restore", "pin", p.Pin.Name(), "mode", mode)
+	}
+}
+
+// resume returns the pin to a mode reported by desiredMode, any mode other
+// than cycling or solid leaves the pin as it is
+func (f *PinCycle) resume(ctx context.Context, m Mode) error {
+	switch m {
+	case ModeCycling:
+		f.Cycle(ctx)
+	case ModeSolid:
+		return f.On(ctx)
+	}
+
+	return nil
+}
+
+// persistState saves the desired state of the pins of m to path at startup
+// and whenever events reports a change to it, until ctx is cancelled. Level
+// changes while cycling do not rewrite the file. The returned channel is
+// closed once the saving goroutine has exited.
+func persistState(ctx context.Context, path string, m *Manager, events *Bus) <-chan struct{} {
+	ch, unsubscribe := events.SubscribeInternal("state")
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		defer unsubscribe()
+
+		var last savedState
+		for {
+			if s := snapshot(m.Pins()); !maps.Equal(s.Pins, last.Pins) {
+				if err := saveState(path, s); err != nil {
+					logger.Error("Unable to save state file", "event", "error", "path", path, "error", err)
+				} else {
+					last = s
+				}
+			}
+
+			select {
+			case <-ch:
+				// drain any queued events so a burst results in one snapshot
+				for len(ch) > 0 {
+					<-ch
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return done
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// started is when the process started, reported as the uptime by /stats
+var started = time.Now()
+
+// Stats is the JSON returned by /stats
+type Stats struct {
+	Uptime        string `json:"uptime"`
+	UptimeSeconds int64  `json:"uptime_seconds"`
+
+	// Requests is the number of HTTP requests served since start, including
+	// the one for these stats
+	Requests uint64 `json:"requests"`
+
+	// Cycling is the number of pins with a cycling goroutine running
+	Cycling int `json:"cycling"`
+
+	// Goroutines is the number of pin goroutines running, more than the
+	// number of pins for long indicates a leak
+	Goroutines int `json:"goroutines"`
+
+	// Queued maps the GPIO number of each pin which has been sent a queued
+	// command to the number of commands waiting for it
+	Queued map[int]int `json:"queued"`
+
+	// Events is the backpressure policy and counters of the event bus
+	Events BusStats `json:"events"`
+
+	// Blinks maps the GPIO number of each pin to the number of times it has
+	// changed level while cycling since start
+	Blinks map[int]uint64 `json:"blinks"`
+
+	// Pins are the configured pins in GPIO order, including those which
+	// could not be initialised
+	Pins []PinStatus `json:"pins"`
+}
+
+// handleStats reports simple counters for debugging without a metrics stack
+func (a *API) handleStats(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(rw, http.MethodGet)
+		return
+	}
+
+	uptime := time.Since(started)
+	s := Stats{
+		Uptime:        uptime.Round(time.Second).String(),
+		UptimeSeconds: int64(uptime.Seconds()),
+		Requests:      a.requests.Load(),
+		Goroutines:    a.manager.Goroutines(),
+		Queued:        a.manager.QueueDepths(),
+		Events:        a.events.Stats(),
+		Blinks:        map[int]uint64{},
+		Pins:          a.manager.Status(),
+	}
+
+	for n, p := range a.manager.Pins() {
+		s.Blinks[n] = p.Flips()
+
+		if mode, _ := p.State(); mode == ModeCycling {
+			s.Cycling++
+		}
+	}
+
+	writeResponse(rw, r, http.StatusOK, s)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// StatusLED shows the health of the server on a pin kept out of the API, a
+// slow heartbeat while healthy and solid on once a fault has been reported.
+// A fault is held until the server restarts.
+type StatusLED struct {
+	Pin *PinCycle
+
+	// mu guards fault, the first fault reported
+	mu    sync.Mutex
+	fault string
+}
+
+// NewStatusLED creates a StatusLED driving p
+func NewStatusLED(p *PinCycle) *StatusLED {
+	p.SetPattern(context.Background(), PatternHeartbeat)
+
+	return &StatusLED{Pin: p}
+}
+
+// Healthy starts the heartbeat unless a fault has been reported
+func (s *StatusLED) Healthy() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.fault != "" {
+		return
+	}
+
+	s.Pin.Cycle(context.Background())
+}
+
+// Fault turns the LED on solid to show something is wrong
+func (s *StatusLED) Fault(reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	logger.Warn("Status LED showing fault", "event", "status", "pin", s.Pin.Pin.Name(), "reason", reason)
+
+	if s.fault != "" {
+		return
+	}
+	s.fault = reason
+
+	if err := s.Pin.On(context.Background()); err != nil {
+		logger.Error("Unable to set status pin", "event", "error", "pin", s.Pin.Pin.Name(), "error", err)
+	}
+}
+
+// Stop turns the LED off
+func (s *StatusLED) Stop() error {
+	return s.Pin.Stop(context.Background())
+}
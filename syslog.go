@@ -0,0 +1,77 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"log/syslog"
+	"strings"
+	"sync"
+)
+
+// syslogTag identifies the log messages sent to syslog
+const syslogTag = "pi-gpio"
+
+// syslogHandler formats records with another handler and sends each one to
+// syslog at the priority matching its level
+type syslogHandler struct {
+	inner slog.Handler
+	out   *syslogOutput
+}
+
+// syslogOutput is shared by a syslogHandler and those derived from it, buf
+// collects the output of the inner handler for a single record
+type syslogOutput struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+	w   *syslog.Writer
+}
+
+// newSyslogLogger returns a logger writing to the local syslog daemon
+func newSyslogLogger(format string) (*slog.Logger, error) {
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, syslogTag)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &syslogOutput{w: w}
+
+	return slog.New(&syslogHandler{inner: newHandler(format, &out.buf), out: out}), nil
+}
+
+func (h *syslogHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	return h.inner.Enabled(ctx, l)
+}
+
+func (h *syslogHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.out.mu.Lock()
+	defer h.out.mu.Unlock()
+
+	h.out.buf.Reset()
+	if err := h.inner.Handle(ctx, r); err != nil {
+		return err
+	}
+
+	msg := strings.TrimSuffix(h.out.buf.String(), "\n")
+
+	switch {
+	case r.Level >= slog.LevelError:
+		return h.out.w.Err(msg)
+	case r.Level >= slog.LevelWarn:
+		return h.out.w.Warning(msg)
+	case r.Level >= slog.LevelInfo:
+		return h.out.w.Info(msg)
+	default:
+		return h.out.w.Debug(msg)
+	}
+}
+
+func (h *syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &syslogHandler{inner: h.inner.WithAttrs(attrs), out: h.out}
+}
+
+func (h *syslogHandler) WithGroup(name string) slog.Handler {
+	return &syslogHandler{inner: h.inner.WithGroup(name), out: h.out}
+}
@@ -0,0 +1,13 @@
+//go:build windows || plan9
+
+package main
+
+import (
+	"errors"
+	"log/slog"
+)
+
+// newSyslogLogger is not supported as log/syslog is not available
+func newSyslogLogger(format string) (*slog.Logger, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"periph.io/x/periph/conn/gpio"
+)
+
+// Default dwell times for each phase of a TrafficLight
+const (
+	DefaultRedTime      = 5 * time.Second
+	DefaultRedAmberTime = 2 * time.Second
+	DefaultGreenTime    = 5 * time.Second
+	DefaultAmberTime    = 3 * time.Second
+)
+
+// TrafficLight sequences three pins through the UK traffic light phases,
+// red, red and amber, green, amber and back to red. Zero dwell times use the
+// defaults.
+type TrafficLight struct {
+	Red, Amber, Green *PinCycle
+
+	RedTime      time.Duration
+	RedAmberTime time.Duration
+	GreenTime    time.Duration
+	AmberTime    time.Duration
+}
+
+// phase is the level of each light and how long it is held
+type phase struct {
+	red, amber, green gpio.Level
+	dwell             time.Duration
+}
+
+// Run cycles through the phases until ctx is cancelled or every light has
+// been taken over by another command, all three lights are turned off when it
+// ends
+func (t *TrafficLight) Run(ctx context.Context) {
+	pins := []*PinCycle{t.Red, t.Amber, t.Green}
+	claims := claimAll(ctx, pins)
+	defer releaseAll(pins, claims)
+
+	phases := []phase{
+		{gpio.High, gpio.Low, gpio.Low, orDefault(t.RedTime, DefaultRedTime)},
+		{gpio.High, gpio.High, gpio.Low, orDefault(t.RedAmberTime, DefaultRedAmberTime)},
+		{gpio.Low, gpio.Low, gpio.High, orDefault(t.GreenTime, DefaultGreenTime)},
+		{gpio.Low, gpio.High, gpio.Low, orDefault(t.AmberTime, DefaultAmberTime)},
+	}
+
+	for {
+		for _, ph := range phases {
+			for i, l := range []gpio.Level{ph.red, ph.amber, ph.green} {
+				pins[i].write(claims[i], l)
+			}
+
+			if !sleepClock(ctx, clockOf(pins), ph.dwell) || allDone(claims) {
+				return
+			}
+		}
+	}
+}
+
+// orDefault returns d or def when d is zero
+func orDefault(d, def time.Duration) time.Duration {
+	if d == 0 {
+		return def
+	}
+
+	return d
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"periph.io/x/periph/conn/gpio"
+)
+
+// Defaults for Twinkle
+const (
+	DefaultTwinkleIntensity = 0.3
+	DefaultTwinkleInterval  = 400 * time.Millisecond
+)
+
+// minTwinkleDuty is the dimmest a twinkling pin is lit
+const minTwinkleDuty = 0.2
+
+// Twinkle sparkles the pins, each independently lighting at a random
+// brightness for around interval and then going dark. intensity, between 0
+// and 1, is the fraction of the time each pin is lit so 1 keeps every pin lit
+// while varying its brightness. The durations and brightness come from the
+// Rand of each pin, so a fixed seed reproduces the sparkle. It runs until ctx
+// is cancelled or every pin has been taken over by another command, the pins
+// are turned off when it ends.
+func Twinkle(ctx context.Context, pins []*PinCycle, intensity float64, interval time.Duration) {
+	claims := make([]context.Context, len(pins))
+	for i, p := range pins {
+		p.mu.Lock()
+		claims[i] = p.claim(ctx, ModeTwinkle)
+		p.mu.Unlock()
+	}
+	defer releaseAll(pins, claims)
+
+	var wg sync.WaitGroup
+	for i, p := range pins {
+		// each pin stops with its claim or when the whole twinkle is
+		// cancelled
+		pctx, cancel := context.WithCancel(claims[i])
+		stop := context.AfterFunc(ctx, cancel)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer stop()
+			defer cancel()
+			defer recoverPattern(pctx)
+
+			p.twinkle(pctx, intensity, interval)
+		}()
+	}
+
+	wg.Wait()
+}
+
+// twinkle drives a single pin of Twinkle until ctx is cancelled
+func (f *PinCycle) twinkle(ctx context.Context, intensity float64, interval time.Duration) {
+	c := f.carrier()
+	dark := time.Duration(float64(interval) * (1 - intensity) / intensity)
+
+	// start each pin at a different point so they do not light together
+	f.mu.Lock()
+	offset := time.Duration(f.random() * float64(interval+dark))
+	f.mu.Unlock()
+
+	if !f.sleep(ctx, offset) {
+		return
+	}
+
+	for {
+		f.mu.Lock()
+		lit := f.jitter(interval)
+		off := f.jitter(dark)
+		duty := minTwinkleDuty + (1-minTwinkleDuty)*f.random()
+		f.mu.Unlock()
+
+		// too frequent to publish, but reported by Brightness
+		if !f.setDuty(ctx, duty) {
+			return
+		}
+
+		for end := f.clock().Now().Add(lit); f.clock().Now().Before(end); {
+			if !c.pulse(ctx, duty) {
+				return
+			}
+		}
+
+		if !f.setDuty(ctx, 0) || f.write(ctx, gpio.Low) != nil || !f.sleep(ctx, off) {
+			return
+		}
+	}
+}
+
+// setDuty records the duty cycle the goroutine owning ctx is driving the pin
+// at, it returns false once ctx is cancelled
+func (f *PinCycle) setDuty(ctx context.Context, duty float64) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if ctx.Err() != nil {
+		return false
+	}
+
+	f.duty = duty
+	return true
+}
+
+// jitter returns a random duration between half and one and a half times d,
+// f.mu must be held
+func (f *PinCycle) jitter(d time.Duration) time.Duration {
+	return d/2 + time.Duration(f.random()*float64(d))
+}
+
+// random returns a random number in [0,1) from Rand, or the global math/rand
+// source when it is nil. f.mu must be held.
+func (f *PinCycle) random() float64 {
+	if f.Rand != nil {
+		return f.Rand.Float64()
+	}
+
+	return rand.Float64()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// dashboard is the single page UI served at /, it uses /status and /ws to
+// show the pins and the API to control them
+//
+//go:embed ui/index.html
+var dashboard []byte
+
+// openAPI describes every route in API, it is maintained by hand alongside
+// the route table in the API doc comment. Its Config schema also validates
+// the config file, see validateConfigSchema.
+//
+//go:embed ui/openapi.json
+var openAPI []byte
+
+// docs is a Swagger UI page for openAPI, the UI itself is loaded from a CDN
+//
+//go:embed ui/docs.html
+var docs []byte
+
+// handleRoot serves the dashboard for a plain GET /, the state of every pin
+// for GET /?mode= with no mode and passes anything else to handleMode, which
+// still accepts the original /?mode= form
+func (a *API) handleRoot(rw http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(rw, r)
+		return
+	}
+
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		if !r.URL.Query().Has("mode") {
+			rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+			rw.Write(dashboard)
+			return
+		}
+
+		// the original API turned every pin off for GET /?mode= with no
+		// value, it now only reports their state
+		if r.URL.Query().Get("mode") == "" {
+			writeResponse(rw, r, http.StatusOK, a.manager.Status())
+			return
+		}
+	}
+
+	a.handleMode(rw, r)
+}
+
+// handleOpenAPI serves the OpenAPI 3 document for the API
+func (a *API) handleOpenAPI(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Write(openAPI)
+}
+
+// handleDocs serves the Swagger UI page
+func (a *API) handleDocs(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.Write(docs)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"periph.io/x/periph/conn/gpio"
+	"periph.io/x/periph/conn/gpio/gpiotest"
+)
+
+// validateConfig loads the config file at path and builds everything it
+// describes against in memory pins, so no host driver is loaded and no pin
+// is driven, then writes a summary of it to w. statusPin overrides the
+// status pin of the config when it is not negative. Each board is given
+// simulatedBoardPins pins. Unlike at startup a pin which is not a GPIO of
+// its board is an error.
+func validateConfig(w io.Writer, path string, statusPin int) error {
+	c, err := LoadConfig(path)
+	if err != nil {
+		return err
+	}
+
+	if statusPin >= 0 {
+		c.StatusPin = &statusPin
+	}
+
+	if err := registerPins(func(p *gpiotest.Pin) gpio.PinIO { return p }); err != nil {
+		return err
+	}
+
+	if err := c.registerBoards(func(p *gpiotest.Pin) gpio.PinIO { return p }); err != nil {
+		return err
+	}
+
+	pins, failed, err := c.Build()
+	if err != nil {
+		return err
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("pin %s is not a GPIO of its board", pinLabel(failed[0].Board, failed[0].GPIO))
+	}
+
+	m := NewManager(pins, nil)
+
+	if _, err := c.BuildInputs(m); err != nil {
+		return err
+	}
+
+	groups, err := c.BuildGroups(m)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.BuildSchedules(m, groups); err != nil {
+		return err
+	}
+
+	if c.StatusPin != nil && (*c.StatusPin < 0 || *c.StatusPin >= simulatedPins) {
+		return fmt.Errorf("status pin GPIO%d is not a GPIO of the Raspberry Pi header", *c.StatusPin)
+	}
+
+	if _, err := c.BuildStatus(); err != nil {
+		return err
+	}
+
+	if path == "" {
+		fmt.Fprintln(w, "The default config is valid")
+	} else {
+		fmt.Fprintf(w, "%s is valid\n", path)
+	}
+
+	fmt.Fprintf(w, "%d pins:", len(pins))
+	for _, n := range pinNumbers(pins) {
+		fmt.Fprintf(w, " %s", pinLabel(pins[n].Board, n%boardStride))
+		if a := pins[n].Alias; a != "" {
+			fmt.Fprintf(w, " (%s)", a)
+		}
+	}
+	fmt.Fprintln(w)
+
+	for _, ic := range c.Inputs {
+		_, label, _ := c.resolve(ic.Toggle)
+		fmt.Fprintf(w, "input GPIO%d toggles %s\n", ic.GPIO, label)
+	}
+
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		members := []string{}
+		for _, n := range groups[name] {
+			members = append(members, pinLabel(pins[n].Board, n%boardStride))
+		}
+
+		fmt.Fprintf(w, "group %s: %s\n", name, strings.Join(members, " "))
+	}
+
+	for _, sc := range c.Schedules {
+		target := sc.Group
+		if target == "" {
+			_, target, _ = c.resolve(sc.Pin)
+		}
+
+		fmt.Fprintf(w, "schedule %q turns %s %s\n", sc.Spec, target, sc.Action)
+	}
+
+	if c.StatusPin != nil {
+		fmt.Fprintf(w, "status pin GPIO%d\n", *c.StatusPin)
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+)
+
+// Version, Commit and BuildDate describe the build, they are set when
+// building with
+//
+//	go build -ldflags "-X main.Version=1.2.0 -X main.Commit=$(git rev-parse --short HEAD) -X main.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// and are left as dev otherwise
+var (
+	Version   = "dev"
+	Commit    = "dev"
+	BuildDate = "dev"
+)
+
+// BuildInfo is the JSON returned by /version
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	Board     string `json:"board"`
+}
+
+// buildInfo describes this build running on board, the model reported by
+// the device tree or simulator
+func buildInfo(board string) BuildInfo {
+	return BuildInfo{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		Board:     board,
+	}
+}
+
+// handleVersion replies with the build and the board it is running on
+func (a *API) handleVersion(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(rw, "GET")
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, a.Build)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"periph.io/x/periph/conn/gpio"
+)
+
+var watchdogTrips = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "pigpio_watchdog_trips_total",
+	Help: "Number of times the watchdog forced a pin off, by pin.",
+}, []string{"pin"})
+
+// pet records that the goroutine driving the pin is still running, every
+// write made by the goroutine pets the pin
+func (f *PinCycle) pet() {
+	f.petted.Store(f.clock().Now().UnixNano())
+}
+
+// rest marks the calling goroutine as waiting for its next step until the
+// returned func is called, which pets the pin. A goroutine holding a level,
+// however long for, is healthy so is not forced off by the watchdog.
+func (f *PinCycle) rest() func() {
+	f.resting.Add(1)
+
+	return func() {
+		f.pet()
+		f.resting.Add(-1)
+	}
+}
+
+// stalled returns true if a goroutine driving the pin is neither resting nor
+// has been petted within timeout
+func (f *PinCycle) stalled(timeout time.Duration) bool {
+	return f.Goroutines() > int(f.resting.Load()) && f.clock().Now().Sub(f.lastPetted()) > timeout
+}
+
+// lastPetted returns when the pin was last petted
+func (f *PinCycle) lastPetted() time.Time {
+	return time.Unix(0, f.petted.Load())
+}
+
+// force drives the pin to OffMode without waiting for the goroutine driving
+// it, which may be stuck. When the goroutine is stuck holding the lock of the
+// pin the hardware is written directly.
+func (f *PinCycle) force(ctx context.Context) error {
+	if f.mu.TryLock() {
+		defer f.mu.Unlock()
+
+		_, err := f.stop(ctx)
+		return err
+	}
+
+	if f.OffMode == OffInput {
+		if in, ok := f.Pin.(gpio.PinIn); ok {
+			return in.In(gpio.Float, gpio.NoEdge)
+		}
+	}
+
+	l := gpio.Low
+	if f.OffMode == OffHigh {
+		l = gpio.High
+	}
+
+	if f.Inverted {
+		l = !l
+	}
+
+	return f.Pin.Out(l)
+}
+
+// Watchdog forces off any pin whose goroutine has not written to it within
+// timeout, checking every timeout/4 until ctx is cancelled. It guards
+// against a bug in a pattern leaving a pin stuck on, a goroutine resting
+// between steps or holding a level is not stalled. Each stall is only forced
+// once.
+func (m *Manager) Watchdog(ctx context.Context, timeout time.Duration) {
+	t := m.clock().NewTicker(timeout / 4)
+	defer t.Stop()
+
+	// forced is when each pin had last been petted when it was forced off
+	forced := map[*PinCycle]time.Time{}
+
+	for {
+		select {
+		case <-t.C():
+		case <-ctx.Done():
+			return
+		}
+
+		for _, p := range m.Ordered() {
+			last := p.lastPetted()
+			if !p.stalled(timeout) || forced[p].Equal(last) {
+				continue
+			}
+			forced[p] = last
+
+			logger.Error("Pin has not been serviced by its goroutine, forcing it off", "event", "watchdog", "pin", p.Pin.Name(), "since", last.Format(time.RFC3339Nano))
+			watchdogTrips.WithLabelValues(p.Pin.Name()).Inc()
+
+			err := p.force(ctx)
+			if err != nil {
+				logger.Error("Unable to force pin off", "event", "error", "pin", p.Pin.Name(), "error", err)
+			}
+
+			m.audit(ctx, p.Pin.Name(), "watchdog", err)
+		}
+	}
+}
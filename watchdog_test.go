@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"periph.io/x/periph/conn/gpio"
+)
+
+// stuckPin is a fakePin which blocks writes of High until release is closed,
+// as a goroutine stuck driving the pin would
+type stuckPin struct {
+	fakePin
+	release chan struct{}
+}
+
+func (p *stuckPin) Out(l gpio.Level) error {
+	if l == gpio.High {
+		<-p.release
+	}
+
+	return p.fakePin.Out(l)
+}
+
+func TestWatchdogLeavesHoldsOn(t *testing.T) {
+	steps, err := ParseSequence("on:200,off:10")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		start func(ctx context.Context, f *PinCycle) error
+	}{
+		{"brightness 1", func(ctx context.Context, f *PinCycle) error { return f.SetBrightness(ctx, 1) }},
+		{"fade to 1", func(ctx context.Context, f *PinCycle) error { return f.Fade(ctx, 1, 5*time.Millisecond) }},
+		{"sequence", func(ctx context.Context, f *PinCycle) error { return f.RunPattern(ctx, steps) }},
+		{"morse", func(ctx context.Context, f *PinCycle) error {
+			_, err := f.startMorse(ctx, "T", 100*time.Millisecond)
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			p := &fakePin{name: "GPIO14"}
+			f := &PinCycle{Pin: p}
+			m := NewManager(map[int]*PinCycle{14: f}, nil)
+			defer f.Stop(context.Background())
+
+			go m.Watchdog(ctx, 20*time.Millisecond)
+
+			if err := tt.start(ctx, f); err != nil {
+				t.Fatal(err)
+			}
+
+			// well past the timeout, but inside the first 200ms hold
+			time.Sleep(100 * time.Millisecond)
+
+			if !f.Running() {
+				t.Fatal("expected the watchdog to leave the pin running")
+			}
+
+			if levels := p.Levels(); levels[len(levels)-1] != gpio.High {
+				t.Fatalf("expected the pin to still be High, got %v", levels)
+			}
+		})
+	}
+}
+
+func TestWatchdogForcesStalledPinOff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p := &stuckPin{fakePin: fakePin{name: "GPIO14"}, release: make(chan struct{})}
+	f := &PinCycle{Pin: p}
+	m := NewManager(map[int]*PinCycle{14: f}, nil)
+	defer close(p.release)
+
+	go m.Watchdog(ctx, 20*time.Millisecond)
+	f.SetBrightness(ctx, 1)
+
+	// the goroutine is stuck writing with the pin locked, so the hardware is
+	// written directly
+	waitFor(t, "the pin to be forced off", func() bool {
+		levels := p.Levels()
+		return len(levels) > 0 && levels[len(levels)-1] == gpio.Low
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// streamWriteTimeout bounds how long a write to a WebSocket or /events
+// client may take before the client is considered dead
+const streamWriteTimeout = 5 * time.Second
+
+// upgrader accepts connections from the origin of the server and those
+// allowed by -cors-origins, see withCORS
+var upgrader = websocket.Upgrader{CheckOrigin: checkOrigin}
+
+// checkOrigin returns true if the origin of r is the host it was sent to, as
+// the default check of the upgrader does, or an allowed CORS origin
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || corsAllowed(r.Context()) {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// handleWS streams every pin event to the client as a JSON message, starting
+// with the current state of each pin
+func (a *API) handleWS(rw http.ResponseWriter, r *http.Request) {
+	events, unsubscribe, err := a.events.Subscribe("websocket " + r.RemoteAddr)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer unsubscribe()
+
+	conn, err := upgrader.Upgrade(rw, r, nil)
+	if err != nil {
+		// Upgrade has already replied to the client
+		logger.WarnContext(r.Context(), "Unable to upgrade WebSocket connection", "error", err)
+		return
+	}
+	defer conn.Close()
+
+	// the client never sends anything, reading is only used to notice when
+	// it goes away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for _, p := range a.manager.Ordered() {
+		if !a.sendWS(conn, p.Event()) {
+			return
+		}
+	}
+
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok || !a.sendWS(conn, e) {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// sendWS writes e to conn, returning false if the client has gone away
+func (a *API) sendWS(conn *websocket.Conn, e Event) bool {
+	conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	return conn.WriteJSON(e) == nil
+}